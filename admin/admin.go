@@ -0,0 +1,351 @@
+package admin
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rjhoppe/firelink/cache"
+	"github.com/rjhoppe/firelink/database"
+	"github.com/rjhoppe/firelink/models"
+	"gorm.io/gorm"
+)
+
+// SchemaVersion is bumped whenever the Dataset layout changes incompatibly
+const SchemaVersion = 1
+
+// Dataset is the versioned document produced by Export and accepted by Import
+type Dataset struct {
+	Version     int                             `json:"version"`
+	ExportedAt  time.Time                       `json:"exported_at"`
+	Drinks      []models.Drink                  `json:"drinks"`
+	Dinners     []models.Dinner                 `json:"dinners"`
+	History     []models.DinnerHistory          `json:"history"`
+	DrinkCache  map[string]models.DrinkResponse `json:"drink_cache"`
+	DinnerCache map[string]models.RecipeInfo    `json:"dinner_cache"`
+	// DrinkCacheExpiry and DinnerCacheExpiry hold when each cache entry expires. Entries
+	// missing from them, as in older exports, get the default cache TTL.
+	DrinkCacheExpiry  map[string]time.Time `json:"drink_cache_expiry,omitempty"`
+	DinnerCacheExpiry map[string]time.Time `json:"dinner_cache_expiry,omitempty"`
+}
+
+// Change describes a single record Import created or would create/update
+type Change struct {
+	Kind   string `json:"kind"`
+	Key    string `json:"key"`
+	Action string `json:"action"`
+}
+
+// ImportReport summarises the outcome of an import
+type ImportReport struct {
+	DryRun       bool     `json:"dry_run"`
+	Created      int      `json:"created"`
+	Updated      int      `json:"updated"`
+	Unchanged    int      `json:"unchanged"`
+	CacheEntries int      `json:"cache_entries"`
+	Changes      []Change `json:"changes"`
+}
+
+// upsert pairs an incoming record with the record it replaces, if any
+type upsert[T any] struct {
+	record   T
+	existing *T
+}
+
+// localKey identifies a local record across instances: the key it was imported under, or
+// else its local- id on this instance. The creation time tells apart records that happen to
+// have the same id on different instances.
+func localKey(originKey string, model gorm.Model) string {
+	if originKey != "" {
+		return originKey
+	}
+	return fmt.Sprintf("%s%d@%d", models.LocalIdPrefix, model.ID, model.CreatedAt.UnixMicro())
+}
+
+// drinkKey identifies a drink across instances by external id, or by localKey for local drinks
+func drinkKey(d models.Drink) string {
+	if d.ExternalId != "" {
+		return "external:" + d.ExternalId
+	}
+	return localKey(d.OriginKey, d.Model)
+}
+
+// dinnerKey identifies a dinner across instances by external id, or by localKey for local recipes
+func dinnerKey(d models.Dinner) string {
+	if d.ExternalId != "" {
+		return "external:" + d.ExternalId
+	}
+	return localKey(d.OriginKey, d.Model)
+}
+
+// localDinnerKeys maps the ids of local dinners to their dinnerKey
+func localDinnerKeys(dinners []models.Dinner) map[int32]string {
+	keys := map[int32]string{}
+	for _, dinner := range dinners {
+		if dinner.ExternalId == "" {
+			keys[int32(dinner.ID)] = dinnerKey(dinner)
+		}
+	}
+	return keys
+}
+
+// historyKey identifies a dinner history entry by recipe, event and time. Local recipes are
+// named by their dinnerKey from localKeys, since their ids differ between instances.
+func historyKey(localKeys map[int32]string) func(models.DinnerHistory) string {
+	return func(h models.DinnerHistory) string {
+		recipe := fmt.Sprint(h.RecipeId)
+		if h.Source == models.SourceLocal {
+			recipe = localKeys[h.RecipeId]
+			if recipe == "" {
+				recipe = models.LocalIdPrefix + fmt.Sprint(h.RecipeId)
+			}
+		}
+		return fmt.Sprintf("%s:%s:%s", recipe, h.Event, h.At.UTC().Format(time.RFC3339Nano))
+	}
+}
+
+// sameHistory treats history entries as immutable, so matching keys are never updated
+func sameHistory(a, b models.DinnerHistory) bool {
+	return true
+}
+
+func sameDrink(a, b models.Drink) bool {
+	return a.Name == b.Name && a.Category == b.Category && a.Glass == b.Glass &&
+		a.Ingredients == b.Ingredients && a.Instructions == b.Instructions && a.Source == b.Source
+}
+
+func sameDinner(a, b models.Dinner) bool {
+	return a.Title == b.Title && a.Url == b.Url && a.Instructions == b.Instructions &&
+		a.Ingredients == b.Ingredients && a.Source == b.Source
+}
+
+// index maps records by key
+func index[T any](records []T, key func(T) string) map[string]T {
+	byKey := make(map[string]T, len(records))
+	for _, record := range records {
+		byKey[key(record)] = record
+	}
+	return byKey
+}
+
+// plan works out which incoming records need creating or updating and records them on the
+// report. Incoming records are only compared with the stored records in byKey, and a key
+// appearing twice in the incoming records is rejected, since it is unclear which should win.
+func plan[T any](kind string, byKey map[string]T, incoming []T, key func(T) string, same func(a, b T) bool, report *ImportReport) ([]upsert[T], error) {
+	var upserts []upsert[T]
+	seen := make(map[string]bool, len(incoming))
+	for _, record := range incoming {
+		k := key(record)
+		if seen[k] {
+			return nil, fmt.Errorf("%s %q appears more than once", kind, k)
+		}
+		seen[k] = true
+
+		current, found := byKey[k]
+		switch {
+		case !found:
+			report.Created++
+			report.Changes = append(report.Changes, Change{Kind: kind, Key: k, Action: "create"})
+			upserts = append(upserts, upsert[T]{record: record})
+		case same(current, record):
+			report.Unchanged++
+		default:
+			report.Updated++
+			report.Changes = append(report.Changes, Change{Kind: kind, Key: k, Action: "update"})
+			upserts = append(upserts, upsert[T]{record: record, existing: &current})
+		}
+	}
+	return upserts, nil
+}
+
+// importPlan holds the records an import creates or updates
+type importPlan struct {
+	drinks  []upsert[models.Drink]
+	dinners []upsert[models.Dinner]
+	history []upsert[models.DinnerHistory]
+	// incomingKeys maps the ids of local dinners in the dataset to their keys
+	incomingKeys map[int32]string
+	// dinnerIds maps the keys of local dinners to their ids on this instance
+	dinnerIds map[string]uint
+}
+
+// planImport compares a dataset with the stored records and records the changes on report.
+// Local dinner history must refer to a dinner in the dataset, since its id only means
+// something on the instance that exported it.
+func planImport(dataset *Dataset, drinks []models.Drink, dinners []models.Dinner, history []models.DinnerHistory, report *ImportReport) (*importPlan, error) {
+	p := &importPlan{incomingKeys: localDinnerKeys(dataset.Dinners), dinnerIds: map[string]uint{}}
+	for _, dinner := range dinners {
+		if dinner.ExternalId == "" {
+			p.dinnerIds[dinnerKey(dinner)] = dinner.ID
+		}
+	}
+	for _, h := range dataset.History {
+		if _, found := p.incomingKeys[h.RecipeId]; h.Source == models.SourceLocal && !found {
+			return nil, fmt.Errorf("history of local recipe %d has no matching dinner", h.RecipeId)
+		}
+	}
+
+	var drinkErr, dinnerErr, historyErr error
+	p.drinks, drinkErr = plan("drink", index(drinks, drinkKey), dataset.Drinks, drinkKey, sameDrink, report)
+	p.dinners, dinnerErr = plan("dinner", index(dinners, dinnerKey), dataset.Dinners, dinnerKey, sameDinner, report)
+	storedHistory := index(history, historyKey(localDinnerKeys(dinners)))
+	p.history, historyErr = plan("history", storedHistory, dataset.History, historyKey(p.incomingKeys), sameHistory, report)
+	if err := errors.Join(drinkErr, dinnerErr, historyErr); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// apply writes the planned records with save. Created local records keep the key they were
+// imported under, and local dinner history is pointed at the ids its dinners have here.
+func (p *importPlan) apply(save func(record any) error) error {
+	for _, u := range p.drinks {
+		record := u.record
+		record.Model, record.OriginKey = gorm.Model{}, ""
+		if u.existing != nil {
+			record.Model, record.OriginKey = u.existing.Model, u.existing.OriginKey
+		} else if record.ExternalId == "" {
+			record.OriginKey = drinkKey(u.record)
+		}
+		if err := save(&record); err != nil {
+			return fmt.Errorf("drink %q: %w", record.Name, err)
+		}
+	}
+	for _, u := range p.dinners {
+		record := u.record
+		record.Model, record.OriginKey = gorm.Model{}, ""
+		if u.existing != nil {
+			record.Model, record.OriginKey = u.existing.Model, u.existing.OriginKey
+		} else if record.ExternalId == "" {
+			record.OriginKey = dinnerKey(u.record)
+		}
+		if err := save(&record); err != nil {
+			return fmt.Errorf("dinner %q: %w", record.Title, err)
+		}
+		if record.ExternalId == "" {
+			p.dinnerIds[dinnerKey(u.record)] = record.ID
+		}
+	}
+	for _, u := range p.history {
+		record := u.record
+		record.Model = gorm.Model{}
+		if record.Source == models.SourceLocal {
+			record.RecipeId = int32(p.dinnerIds[p.incomingKeys[record.RecipeId]])
+		}
+		if err := save(&record); err != nil {
+			return fmt.Errorf("history %q: %w", historyKey(p.incomingKeys)(u.record), err)
+		}
+	}
+	return nil
+}
+
+// defaultCacheTTL is how long imported cache entries without an expiry stay cached
+const defaultCacheTTL = 15 * 24 * time.Hour
+
+// restoreCache puts imported entries into a cache, keeping their exported expiry and
+// leaving out entries that have expired since
+func restoreCache[T any](c *cache.Cache[T], entries map[string]T, expiries map[string]time.Time) {
+	now := time.Now()
+	for key, record := range entries {
+		ttl := defaultCacheTTL
+		if expiry, ok := expiries[key]; ok {
+			ttl = expiry.Sub(now)
+		}
+		if ttl > 0 {
+			c.Set(key, record, ttl)
+		}
+	}
+}
+
+// Export returns every drink, dinner and cache entry as a versioned JSON document
+func Export(c *gin.Context, drinkCache *cache.Cache[models.DrinkResponse], dinnerCache *cache.Cache[models.RecipeInfo]) {
+	db := database.GetDB()
+
+	dataset := Dataset{
+		Version:           SchemaVersion,
+		ExportedAt:        time.Now().UTC(),
+		DrinkCache:        drinkCache.GetAll(),
+		DinnerCache:       dinnerCache.GetAll(),
+		DrinkCacheExpiry:  drinkCache.Expiries(),
+		DinnerCacheExpiry: dinnerCache.Expiries(),
+	}
+	if err := db.Find(&dataset.Drinks).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Error exporting drinks: %v", err)})
+		return
+	}
+	if err := db.Find(&dataset.Dinners).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Error exporting dinners: %v", err)})
+		return
+	}
+	if err := db.Find(&dataset.History).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Error exporting dinner history: %v", err)})
+		return
+	}
+
+	timestamp := time.Now().Format("2006-01-02_15-04-05")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "firelink_export_"+timestamp+".json"))
+	c.JSON(http.StatusOK, dataset)
+}
+
+// Import validates an exported dataset and upserts its records by external id, or for local
+// records by the local- id they had on the instance that first exported them.
+// With ?dry_run=true nothing is written and the report lists what would change.
+func Import(c *gin.Context, drinkCache *cache.Cache[models.DrinkResponse], dinnerCache *cache.Cache[models.RecipeInfo]) {
+	var dataset Dataset
+	if err := c.ShouldBindJSON(&dataset); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid dataset: %v", err)})
+		return
+	}
+	if dataset.Version != SchemaVersion {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Unsupported schema version %d, expected %d", dataset.Version, SchemaVersion)})
+		return
+	}
+
+	db := database.GetDB()
+	var existingDrinks []models.Drink
+	var existingDinners []models.Dinner
+	var existingHistory []models.DinnerHistory
+	if err := db.Find(&existingDrinks).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Error reading drinks: %v", err)})
+		return
+	}
+	if err := db.Find(&existingDinners).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Error reading dinners: %v", err)})
+		return
+	}
+	if err := db.Find(&existingHistory).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Error reading dinner history: %v", err)})
+		return
+	}
+
+	report := ImportReport{
+		DryRun:       c.Query("dry_run") == "true",
+		CacheEntries: len(dataset.DrinkCache) + len(dataset.DinnerCache),
+		Changes:      []Change{},
+	}
+	p, err := planImport(&dataset, existingDrinks, existingDinners, existingHistory, &report)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid dataset: %v", err)})
+		return
+	}
+
+	if report.DryRun {
+		c.JSON(http.StatusOK, report)
+		return
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		return p.apply(func(record any) error { return tx.Save(record).Error })
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Import failed: %v", err)})
+		return
+	}
+
+	restoreCache(drinkCache, dataset.DrinkCache, dataset.DrinkCacheExpiry)
+	restoreCache(dinnerCache, dataset.DinnerCache, dataset.DinnerCacheExpiry)
+
+	c.JSON(http.StatusOK, report)
+}
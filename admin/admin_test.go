@@ -0,0 +1,164 @@
+package admin
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/rjhoppe/firelink/cache"
+	"github.com/rjhoppe/firelink/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlan_Drinks(t *testing.T) {
+	existing := []models.Drink{
+		{Name: "Mojito", ExternalId: "11000", Glass: "Highball glass"},
+		{Name: "Negroni", ExternalId: "11003", Glass: "Old-fashioned glass"},
+		{Name: "House Punch", Source: models.SourceLocal},
+	}
+	existing[0].ID = 1
+	existing[1].ID = 2
+	existing[2].ID = 3
+
+	incoming := []models.Drink{
+		{Name: "Mojito", ExternalId: "11000", Glass: "Highball glass"},
+		{Name: "Negroni", ExternalId: "11003", Glass: "Coupe"},
+		{Name: "House Punch", Source: models.SourceLocal, Ingredients: "Rum, Juice"},
+		{Name: "Margarita", ExternalId: "11007"},
+	}
+	existing[2].OriginKey = "local-3@1"
+	incoming[2].OriginKey = "local-3@1"
+
+	report := ImportReport{}
+	upserts, err := plan("drink", index(existing, drinkKey), incoming, drinkKey, sameDrink, &report)
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, report.Created)
+	assert.Equal(t, 2, report.Updated)
+	assert.Equal(t, 1, report.Unchanged)
+	assert.Len(t, upserts, 3)
+
+	assert.Equal(t, Change{Kind: "drink", Key: "external:11003", Action: "update"}, report.Changes[0])
+	assert.Equal(t, uint(2), upserts[0].existing.ID)
+	assert.Equal(t, Change{Kind: "drink", Key: "local-3@1", Action: "update"}, report.Changes[1])
+	assert.Equal(t, Change{Kind: "drink", Key: "external:11007", Action: "create"}, report.Changes[2])
+	assert.Nil(t, upserts[2].existing)
+}
+
+func TestPlan_Dinners(t *testing.T) {
+	incoming := []models.Dinner{
+		{Title: "Pasta", ExternalId: "716429"},
+		{Title: "Grandma's Lasagna", Source: models.SourceLocal, OriginKey: "local-9@1"},
+	}
+
+	report := ImportReport{}
+	upserts, err := plan("dinner", nil, incoming, dinnerKey, sameDinner, &report)
+	require.NoError(t, err)
+
+	assert.Equal(t, 2, report.Created)
+	assert.Len(t, upserts, 2)
+	assert.Equal(t, "local-9@1", report.Changes[1].Key)
+}
+
+func TestPlan_RejectsDuplicateKeys(t *testing.T) {
+	existing := []models.Dinner{{Title: "Pasta", ExternalId: "716429"}}
+	existing[0].ID = 1
+	incoming := []models.Dinner{
+		{Title: "Pasta", ExternalId: "716429", Url: "first"},
+		{Title: "Pasta", ExternalId: "716429", Url: "second"},
+	}
+
+	report := ImportReport{}
+	_, err := plan("dinner", index(existing, dinnerKey), incoming, dinnerKey, sameDinner, &report)
+	assert.EqualError(t, err, `dinner "external:716429" appears more than once`)
+}
+
+func TestRestoreCache_KeepsExpiry(t *testing.T) {
+	drinks := cache.NewCache[models.DrinkResponse](10)
+	drinks.Set("Mojito", models.DrinkResponse{Name: "Mojito"}, time.Hour)
+	drinks.Set("Negroni", models.DrinkResponse{Name: "Negroni"}, time.Hour)
+	entries, expiries := drinks.GetAll(), drinks.Expiries()
+	expiries["Negroni"] = time.Now().Add(-time.Minute)
+	entries["Margarita"] = models.DrinkResponse{Name: "Margarita"}
+
+	restored := cache.NewCache[models.DrinkResponse](10)
+	restoreCache(restored, entries, expiries)
+
+	got := restored.Expiries()
+	assert.WithinDuration(t, expiries["Mojito"], got["Mojito"], time.Second)
+	assert.NotContains(t, got, "Negroni")
+	// Entries exported without an expiry get the default TTL
+	assert.WithinDuration(t, time.Now().Add(defaultCacheTTL), got["Margarita"], time.Second)
+}
+
+// memoryDB stands in for the database in import tests, handing out ids as records are saved
+type memoryDB struct {
+	epoch   time.Time
+	lastId  uint
+	drinks  []models.Drink
+	dinners []models.Dinner
+	history []models.DinnerHistory
+}
+
+func (db *memoryDB) save(record any) error {
+	switch r := record.(type) {
+	case *models.Drink:
+		db.lastId++
+		r.ID = db.lastId
+		db.drinks = append(db.drinks, *r)
+	case *models.Dinner:
+		if r.ID == 0 {
+			db.lastId++
+			r.ID, r.CreatedAt = db.lastId, db.epoch.Add(time.Duration(db.lastId)*time.Second)
+		}
+		db.dinners = append(db.dinners, *r)
+	case *models.DinnerHistory:
+		db.history = append(db.history, *r)
+	}
+	return nil
+}
+
+func (db *memoryDB) importDataset(t *testing.T, dataset Dataset) ImportReport {
+	report := ImportReport{}
+	p, err := planImport(&dataset, db.drinks, db.dinners, db.history, &report)
+	require.NoError(t, err)
+	require.NoError(t, p.apply(db.save))
+	return report
+}
+
+func TestImport_RoundTripsLocalRecipes(t *testing.T) {
+	// Two family recipes share a title, which the create endpoint allows
+	source := &memoryDB{epoch: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)}
+	for _, title := range []string{"Soup", "Soup"} {
+		require.NoError(t, source.save(&models.Dinner{Title: title, Source: models.SourceLocal, Instructions: title}))
+	}
+	at := time.Date(2026, 10, 1, 18, 0, 0, 0, time.UTC)
+	source.history = []models.DinnerHistory{{RecipeId: 2, Source: models.SourceLocal, Title: "Soup", Event: models.HistoryCooked, At: at}}
+
+	data, err := json.Marshal(Dataset{Version: SchemaVersion, Dinners: source.dinners, History: source.history})
+	require.NoError(t, err)
+	var exported Dataset
+	require.NoError(t, json.Unmarshal(data, &exported))
+
+	// Importing an instance's own export changes nothing
+	report := source.importDataset(t, exported)
+	assert.Equal(t, 3, report.Unchanged)
+	assert.Zero(t, report.Created)
+
+	// Another instance gives the recipes new ids, and the history follows them
+	target := &memoryDB{epoch: time.Date(2026, 5, 1, 0, 0, 0, 0, time.UTC)}
+	for _, title := range []string{"Soup", "Stew", "Soup"} {
+		require.NoError(t, target.save(&models.Dinner{Title: title, Source: models.SourceLocal, Instructions: title}))
+	}
+	report = target.importDataset(t, exported)
+	assert.Equal(t, 3, report.Created)
+	require.Len(t, target.dinners, 5)
+	assert.Equal(t, localKey("", source.dinners[1].Model), target.dinners[4].OriginKey)
+	require.Len(t, target.history, 1)
+	assert.Equal(t, int32(target.dinners[4].ID), target.history[0].RecipeId)
+
+	// Importing the same export again matches the imported recipes by their origin
+	report = target.importDataset(t, exported)
+	assert.Equal(t, 3, report.Unchanged)
+}
@@ -1,18 +1,23 @@
 package bartender
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
-	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/rjhoppe/firelink/cache"
 	"github.com/rjhoppe/firelink/database"
+	"github.com/rjhoppe/firelink/export"
 	"github.com/rjhoppe/firelink/models"
 	"github.com/rjhoppe/firelink/ntfy"
 	"github.com/rjhoppe/firelink/utils"
+	"gorm.io/gorm"
 )
 
 type DrinkService struct {
@@ -22,6 +27,17 @@ type DrinkService struct {
 	GetDrinkFromDBFunc    func(drinkName string, c *gin.Context, cache *cache.Cache[models.DrinkResponse])
 	GetAllCacheDrinksFunc func(c *gin.Context, cache *cache.Cache[models.DrinkResponse])
 	Notifier              ntfy.Notifier
+	HTTPClient            *http.Client
+	// LocalShare is the fraction of random drinks picked from the custom drinks, 0 to never mix them in
+	LocalShare float64
+}
+
+// httpClient returns the client used for CocktailDB requests
+func (s *DrinkService) httpClient() *http.Client {
+	if s.HTTPClient != nil {
+		return s.HTTPClient
+	}
+	return http.DefaultClient
 }
 
 // GatherIngredients builds a slice of non-empty ingredient strings.
@@ -44,16 +60,23 @@ func (s *DrinkService) GatherIngredients(drink models.GetRandomDrinkAPI) []strin
 // GetDrink fetches a valid random drink from the API.
 func (s *DrinkService) GetDrink(liquor string, c *gin.Context) (models.GetRandomDrinkAPI, error) {
 	url := "https://www.thecocktaildb.com/api/json/v1/1/random.php"
+	ctx := utils.RequestContext(c)
 	for {
-		resp, err := http.Get(url)
+		req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"body": "Error creating source api request"})
+			return models.GetRandomDrinkAPI{}, err
+		}
+		resp, err := s.httpClient().Do(req)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"body": "Error retrieving data from source api"})
 			return models.GetRandomDrinkAPI{}, err
 		}
-		defer resp.Body.Close()
 
 		var drink models.GetRandomDrinkAPI
-		if err := json.NewDecoder(resp.Body).Decode(&drink); err != nil {
+		err = json.NewDecoder(resp.Body).Decode(&drink)
+		resp.Body.Close()
+		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"body": "Error decoding api response body"})
 			return models.GetRandomDrinkAPI{}, err
 		}
@@ -78,25 +101,62 @@ func (s *DrinkService) GetDrink(liquor string, c *gin.Context) (models.GetRandom
 
 // GetRandomDrink handles the random drink endpoint.
 func (s *DrinkService) GetRandomDrinkFromApi(liquor string, c *gin.Context, cache *cache.Cache[models.DrinkResponse]) {
+	if liquor == "" {
+		if local, ok := s.pickLocal(); ok {
+			s.serveDrink(c, cache, localDrinkResponse(*local))
+			return
+		}
+	}
+
 	drink, err := s.GetDrinkFunc(liquor, c)
 	if err != nil {
 		return // Error already handled in getDrink
 	}
-	ingredients := s.GatherIngredientsFunc(drink)
-	ingredientsList := strings.Join(ingredients, ", ")
-	jsonResp := models.DrinkResponse{
+	s.serveDrink(c, cache, drinkResponse(drink, s.GatherIngredientsFunc(drink)))
+}
+
+// drinkResponse converts the first drink of a CocktailDB response into the shape returned by the API
+func drinkResponse(drink models.GetRandomDrinkAPI, ingredients []string) models.DrinkResponse {
+	return models.DrinkResponse{
 		Message:      "Drink of the Day",
 		ExternalId:   drink.Drinks[0].IDDrink,
 		Name:         drink.Drinks[0].StrDrink,
 		Category:     drink.Drinks[0].StrCategory,
 		Glass:        drink.Drinks[0].StrGlass,
-		Ingredients:  ingredientsList,
+		Ingredients:  strings.Join(ingredients, ", "),
 		Instructions: drink.Drinks[0].StrInstructions,
 	}
-	ttl := 15 * 24 * time.Hour
-	cache.Set(jsonResp.Name, jsonResp, ttl)
-	ntfy.NtfyDrinkOfTheDay(jsonResp, ntfy.NewNotifier("drink"))
-	c.JSON(http.StatusOK, jsonResp)
+}
+
+// cocktailDBLookupURL fetches a single CocktailDB drink by id
+const cocktailDBLookupURL = "https://www.thecocktaildb.com/api/json/v1/1/lookup.php?i="
+
+// errDrinkNotFound is returned when CocktailDB has no drink with the requested id
+var errDrinkNotFound = errors.New("drink not found")
+
+// lookupDrink fetches a drink from CocktailDB by its id
+func (s *DrinkService) lookupDrink(ctx context.Context, drinkId string) (models.DrinkResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", cocktailDBLookupURL+url.QueryEscape(drinkId), nil)
+	if err != nil {
+		return models.DrinkResponse{}, err
+	}
+	resp, err := s.httpClient().Do(req)
+	if err != nil {
+		return models.DrinkResponse{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return models.DrinkResponse{}, fmt.Errorf("CocktailDB returned status code %d", resp.StatusCode)
+	}
+
+	var drink models.GetRandomDrinkAPI
+	if err := json.NewDecoder(resp.Body).Decode(&drink); err != nil {
+		return models.DrinkResponse{}, err
+	}
+	if len(drink.Drinks) == 0 {
+		return models.DrinkResponse{}, errDrinkNotFound
+	}
+	return drinkResponse(drink, s.GatherIngredients(drink)), nil
 }
 
 // Saves top drink record on the cache to db if not already present
@@ -153,6 +213,67 @@ func (s *DrinkService) GetAllCacheDrinks(c *gin.Context, cache *cache.Cache[mode
 	for _, drink := range allDrinks {
 		drinkResponses = append(drinkResponses, drink)
 	}
-	ntfy.NtfyAllCacheDrinks(drinkResponses, ntfy.NewNotifier("drink"))
+	ntfy.NtfyAllCacheDrinks(utils.RequestContext(c), drinkResponses, ntfy.NewNotifier("drink"))
 	c.JSON(http.StatusOK, drinkResponses)
 }
+
+// ExportDrink renders a drink as Markdown, printable HTML or JSON. Custom drinks are found by
+// their "local-" id, CocktailDB drinks in the cache, the database or else CocktailDB itself.
+func (s *DrinkService) ExportDrink(drinkId string, c *gin.Context, cache *cache.Cache[models.DrinkResponse]) {
+	if !export.ValidateFormat(c) {
+		return
+	}
+	if strings.HasPrefix(drinkId, models.LocalIdPrefix) {
+		record, ok := findLocalDrink(c, drinkId)
+		if !ok {
+			return
+		}
+		export.Respond(c, "drink", "drink-"+drinkId, localDrinkResponse(*record))
+		return
+	}
+	if _, err := strconv.ParseUint(drinkId, 10, 32); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid drink ID"})
+		return
+	}
+
+	drink, found := cachedDrink(cache, drinkId)
+	if !found {
+		var record models.Drink
+		err := database.GetDB().Where("external_id = ?", drinkId).First(&record).Error
+		switch {
+		case err == nil:
+			drink = models.DrinkResponse{
+				ExternalId:   record.ExternalId,
+				Name:         record.Name,
+				Category:     record.Category,
+				Glass:        record.Glass,
+				Ingredients:  record.Ingredients,
+				Instructions: record.Instructions,
+				Source:       record.Source,
+			}
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			if drink, err = s.lookupDrink(utils.RequestContext(c), drinkId); errors.Is(err, errDrinkNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Drink not found: %s", drinkId)})
+				return
+			} else if err != nil {
+				c.JSON(http.StatusBadGateway, gin.H{"error": fmt.Sprintf("Error fetching drink: %v", err)})
+				return
+			}
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Error fetching drink: %v", err)})
+			return
+		}
+	}
+
+	export.Respond(c, "drink", "drink-"+drinkId, drink)
+}
+
+// cachedDrink finds a CocktailDB drink in the cache, which is keyed by name, by its id
+func cachedDrink(cache *cache.Cache[models.DrinkResponse], drinkId string) (models.DrinkResponse, bool) {
+	for _, drink := range cache.GetAll() {
+		if drink.ExternalId == drinkId {
+			return drink, true
+		}
+	}
+	return models.DrinkResponse{}, false
+}
@@ -1,15 +1,20 @@
 package bartender
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/rjhoppe/firelink/cache"
 	"github.com/rjhoppe/firelink/models"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // Mock Notifier
@@ -17,11 +22,11 @@ type MockNotifier struct {
 	Sent bool
 }
 
-func (m *MockNotifier) SendMessage(title, message string) error {
+func (m *MockNotifier) SendMessage(ctx context.Context, title, message string) error {
 	m.Sent = true
 	return nil
 }
-func (m *MockNotifier) SendFile(fileLoc string) error { return nil }
+func (m *MockNotifier) SendFile(ctx context.Context, fileLoc string) error { return nil }
 
 func TestGetRandomDrinkFromApi(t *testing.T) {
 	// Arrange
@@ -90,3 +95,85 @@ func TestGetRandomDrinkFromApi(t *testing.T) {
 		t.Logf("Cache key: %s", k)
 	}
 }
+
+func TestCreateDrink_InvalidBody(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("POST", "/bartender/drinks", strings.NewReader(`{"name": "House Old Fashioned"}`))
+	c.Request.Header.Set("Content-Type", "application/json")
+
+	service := &DrinkService{}
+	service.CreateDrink(c)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "Ingredients")
+}
+
+func TestGetLocalDrink_InvalidId(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+
+	(&DrinkService{}).GetLocalDrink(c, "local-mojito")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestExportDrink(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	testCache := cache.NewCache[models.DrinkResponse](10)
+	testCache.Set("Mojito", models.DrinkResponse{ExternalId: "11000", Name: "Mojito", Ingredients: "Rum, Mint"}, time.Hour)
+	service := &DrinkService{}
+
+	export := func(id, format string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("GET", "/bartender/drink/"+id+"/export?format="+format, nil)
+		service.ExportDrink(id, c, testCache)
+		return w
+	}
+
+	// The format is checked before anything is looked up
+	w := export("99999", "pdf")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "unsupported export format")
+
+	assert.Equal(t, http.StatusBadRequest, export("mojito", "md").Code)
+
+	w = export("11000", "json")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Disposition"), "drink-11000.json")
+	assert.Contains(t, w.Body.String(), `"name": "Mojito"`)
+}
+
+// rewriteTransport sends every request to a test server
+type rewriteTransport struct {
+	server *httptest.Server
+}
+
+func (t rewriteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	target, _ := url.Parse(t.server.URL)
+	req.URL.Scheme, req.URL.Host = target.Scheme, target.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestLookupDrink(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/json/v1/1/lookup.php", r.URL.Path)
+		if r.URL.Query().Get("i") != "11000" {
+			w.Write([]byte(`{"drinks": null}`))
+			return
+		}
+		w.Write([]byte(`{"drinks": [{"idDrink": "11000", "strDrink": "Mojito", "strIngredient1": "Rum", "strMeasure1": "2 oz"}]}`))
+	}))
+	defer server.Close()
+	service := &DrinkService{HTTPClient: &http.Client{Transport: rewriteTransport{server}}}
+
+	drink, err := service.lookupDrink(context.Background(), "11000")
+	require.NoError(t, err)
+	assert.Equal(t, "Mojito", drink.Name)
+	assert.Equal(t, "2 oz Rum", drink.Ingredients)
+
+	_, err = service.lookupDrink(context.Background(), "1")
+	assert.ErrorIs(t, err, errDrinkNotFound)
+}
@@ -0,0 +1,176 @@
+package bartender
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rjhoppe/firelink/cache"
+	"github.com/rjhoppe/firelink/database"
+	"github.com/rjhoppe/firelink/models"
+	"github.com/rjhoppe/firelink/ntfy"
+	"github.com/rjhoppe/firelink/utils"
+	"gorm.io/gorm"
+)
+
+// localDrinkResponse converts a locally authored Drink into the shape returned by the API
+func localDrinkResponse(drink models.Drink) models.DrinkResponse {
+	return models.DrinkResponse{
+		Message:      "Drink of the Day",
+		ExternalId:   models.LocalIdPrefix + strconv.FormatUint(uint64(drink.ID), 10),
+		Name:         drink.Name,
+		Category:     drink.Category,
+		Glass:        drink.Glass,
+		Ingredients:  drink.Ingredients,
+		Instructions: drink.Instructions,
+		Source:       models.SourceLocal,
+	}
+}
+
+// findLocalDrink looks up a locally authored drink by its database id, with or without
+// the "local-" prefix
+func findLocalDrink(c *gin.Context, drinkId string) (*models.Drink, bool) {
+	drinkId = strings.TrimPrefix(drinkId, models.LocalIdPrefix)
+	id, err := strconv.ParseUint(drinkId, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid drink ID"})
+		return nil, false
+	}
+
+	var drink models.Drink
+	err = database.GetDB().Where("id = ? AND source = ?", id, models.SourceLocal).First(&drink).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Local drink not found"})
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Error fetching drink: %v", err)})
+		return nil, false
+	}
+	return &drink, true
+}
+
+// CreateDrink stores a custom drink that has no upstream source
+func (s *DrinkService) CreateDrink(c *gin.Context) {
+	var req models.DrinkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	drink := models.Drink{
+		Name:         req.Name,
+		Category:     req.Category,
+		Glass:        req.Glass,
+		Ingredients:  req.Ingredients,
+		Instructions: req.Instructions,
+		Source:       models.SourceLocal,
+	}
+	if err := database.SaveToDB(database.GetDB(), &drink); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Error saving drink: %v", err)})
+		return
+	}
+	c.JSON(http.StatusCreated, localDrinkResponse(drink))
+}
+
+// UpdateDrink replaces the contents of a locally authored drink
+func (s *DrinkService) UpdateDrink(c *gin.Context, drinkId string) {
+	var req models.DrinkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	drink, ok := findLocalDrink(c, drinkId)
+	if !ok {
+		return
+	}
+
+	drink.Name = req.Name
+	drink.Category = req.Category
+	drink.Glass = req.Glass
+	drink.Ingredients = req.Ingredients
+	drink.Instructions = req.Instructions
+	if err := database.GetDB().Save(drink).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Error updating drink: %v", err)})
+		return
+	}
+	c.JSON(http.StatusOK, localDrinkResponse(*drink))
+}
+
+// DeleteDrink removes a locally authored drink
+func (s *DrinkService) DeleteDrink(c *gin.Context, drinkId string) {
+	drink, ok := findLocalDrink(c, drinkId)
+	if !ok {
+		return
+	}
+
+	if err := database.GetDB().Delete(drink).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Error deleting drink: %v", err)})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": fmt.Sprintf("Drink deleted: %s", drink.Name)})
+}
+
+// GetLocalDrink returns a locally authored drink by its database id
+func (s *DrinkService) GetLocalDrink(c *gin.Context, drinkId string) {
+	drink, ok := findLocalDrink(c, drinkId)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, localDrinkResponse(*drink))
+}
+
+// randomLocalDrink picks a random locally authored drink
+func randomLocalDrink() (*models.Drink, error) {
+	var drink models.Drink
+	err := database.GetDB().Where("source = ?", models.SourceLocal).Order("RANDOM()").First(&drink).Error
+	if err != nil {
+		return nil, err
+	}
+	return &drink, nil
+}
+
+// serveDrink caches, announces and returns the drink of the day
+func (s *DrinkService) serveDrink(c *gin.Context, cache *cache.Cache[models.DrinkResponse], drink models.DrinkResponse) {
+	ttl := 15 * 24 * time.Hour
+	cache.Set(drink.Name, drink, ttl)
+	ntfy.NtfyDrinkOfTheDay(utils.RequestContext(c), drink, ntfy.NewNotifier("drink"))
+	c.JSON(http.StatusOK, drink)
+}
+
+// GetRandomLocalDrink serves a random locally authored drink as the drink of the day
+func (s *DrinkService) GetRandomLocalDrink(c *gin.Context, cache *cache.Cache[models.DrinkResponse]) {
+	drink, err := randomLocalDrink()
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No local drinks found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Error fetching local drink: %v", err)})
+		return
+	}
+	s.serveDrink(c, cache, localDrinkResponse(*drink))
+}
+
+// pickLocal picks a custom drink for the random drink endpoint LocalShare of the time,
+// as long as there are any
+func (s *DrinkService) pickLocal() (*models.Drink, bool) {
+	if s.LocalShare <= 0 || database.GetDB() == nil || rand.Float64() >= s.LocalShare {
+		return nil, false
+	}
+	drink, err := randomLocalDrink()
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Printf("Failed to load local drinks: %v", err)
+		}
+		return nil, false
+	}
+	return drink, true
+}
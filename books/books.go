@@ -1,75 +1,176 @@
 package books
 
 import (
-	"encoding/json"
 	"fmt"
 	"net/http"
+	"os"
+	"slices"
+	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/rjhoppe/firelink/gutendex"
 	"github.com/rjhoppe/firelink/utils"
 )
 
-type CheckForBookAPI struct {
-	Count    int `json:"count"`
-	Next     any `json:"next"`
-	Previous any `json:"previous"`
-	Results  []struct {
-		ID      int    `json:"id"`
-		Title   string `json:"title"`
-		Authors []struct {
-			Name      string `json:"name"`
-			BirthYear int    `json:"birth_year"`
-			DeathYear int    `json:"death_year"`
-		} `json:"authors"`
-		Translators []any    `json:"translators"`
-		Subjects    []string `json:"subjects"`
-		Bookshelves []string `json:"bookshelves"`
-		Languages   []string `json:"languages"`
-		Copyright   bool     `json:"copyright"`
-		MediaType   string   `json:"media_type"`
-		Formats     struct {
-			TextHTML                    string `json:"text/html"`
-			ApplicationEpubZip          string `json:"application/epub+zip"`
-			ApplicationXMobipocketEbook string `json:"application/x-mobipocket-ebook"`
-			TextPlainCharsetUsASCII     string `json:"text/plain; charset=us-ascii"`
-			ApplicationRdfXML           string `json:"application/rdf+xml"`
-			ImageJpeg                   string `json:"image/jpeg"`
-			ApplicationOctetStream      string `json:"application/octet-stream"`
-		} `json:"formats,omitempty"`
-		DownloadCount int `json:"download_count"`
-	} `json:"results"`
+// Preferences are the languages and formats book lookups look for, most preferred first
+type Preferences struct {
+	Languages []string
+	Formats   []string
 }
 
-func CheckForBook(c *gin.Context, title string) {
-	var book CheckForBookAPI
+// splitList splits a comma separated list, dropping empty items
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.ToLower(strings.TrimSpace(item)); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// PreferencesFromEnv returns the household preferences from BOOK_LANGUAGES (default "en")
+// and BOOK_FORMATS (default "epub")
+func PreferencesFromEnv() Preferences {
+	prefs := Preferences{Languages: splitList(os.Getenv("BOOK_LANGUAGES")), Formats: splitList(os.Getenv("BOOK_FORMATS"))}
+	if len(prefs.Languages) == 0 {
+		prefs.Languages = []string{"en"}
+	}
+	if len(prefs.Formats) == 0 {
+		prefs.Formats = []string{"epub"}
+	}
+	return prefs
+}
+
+// withQuery overrides the preferences with the ?lang= and ?format= of a request
+func (p Preferences) withQuery(c *gin.Context) (Preferences, error) {
+	if languages := splitList(c.Query("lang")); len(languages) > 0 {
+		p.Languages = languages
+	}
+	if formats := splitList(c.Query("format")); len(formats) > 0 {
+		p.Formats = formats
+	}
+	for _, format := range p.Formats {
+		if _, ok := gutendex.FormatMimeTypes[format]; !ok || format == "cover" {
+			return p, fmt.Errorf("unknown format %q", format)
+		}
+	}
+	return p, nil
+}
+
+// BookOption is a search result with the languages and formats it is available in
+type BookOption struct {
+	ID        int      `json:"id"`
+	Title     string   `json:"title"`
+	Authors   []string `json:"authors"`
+	Languages []string `json:"languages"`
+	Formats   []string `json:"formats"`
+	Format    string   `json:"format,omitempty"`
+	URL       string   `json:"url,omitempty"`
+}
+
+// bookOption summarizes a Gutendex book
+func bookOption(book *gutendex.Book) BookOption {
+	option := BookOption{ID: book.ID, Title: book.Title, Authors: []string{}, Languages: book.Languages, Formats: []string{}}
+	for _, author := range book.Authors {
+		option.Authors = append(option.Authors, author.Name)
+	}
+	for format := range gutendex.FormatMimeTypes {
+		if _, ok := book.Format(format); ok && format != "cover" {
+			option.Formats = append(option.Formats, format)
+		}
+	}
+	slices.Sort(option.Formats)
+	return option
+}
+
+// rank returns the position of the first preferred item found in available,
+// or len(preferred) when none are
+func rank(preferred []string, available func(string) bool) int {
+	for i, item := range preferred {
+		if available(item) {
+			return i
+		}
+	}
+	return len(preferred)
+}
+
+// bestMatch picks the result best matching the preferences, first by language and then by
+// format, keeping Gutendex's popularity order on ties. It returns -1 when no result is in
+// a preferred language.
+func bestMatch(results []gutendex.Book, prefs Preferences) int {
+	best, bestLanguage, bestFormat := -1, len(prefs.Languages), len(prefs.Formats)+1
+	for i := range results {
+		language := rank(prefs.Languages, func(lang string) bool { return slices.Contains(results[i].Languages, lang) })
+		if language == len(prefs.Languages) {
+			continue
+		}
+		format := rank(prefs.Formats, func(format string) bool {
+			_, ok := results[i].Format(format)
+			return ok
+		})
+		if language < bestLanguage || (language == bestLanguage && format < bestFormat) {
+			best, bestLanguage, bestFormat = i, language, format
+		}
+	}
+	return best
+}
 
+// CheckForBook looks a title up on Project Gutenberg and reports the result best matching
+// the preferred languages and formats, along with the alternatives in other ones
+func CheckForBook(c *gin.Context, title string, client *gutendex.Client, defaults Preferences) {
 	if title == "help" {
-		c.JSON(http.StatusOK, gin.H{"body": "To see if an ebook is available at Project Gutenberg, send a book title to the /ebook/find/{title} endpoint"})
+		c.JSON(http.StatusOK, gin.H{"body": "To see if an ebook is available at Project Gutenberg, send a book title to the /ebook/find/{title} endpoint (?lang=en,fr&format=epub,mobi to change the preferred languages and formats)"})
+		return
 	}
 
-	url := "https://gutendex.com/books/?search=" + title
-	resp, err := http.Get(url)
+	prefs, err := defaults.withQuery(c)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"body": "Error retrieving data from source api"})
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&book); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"body": "Error decoding api response body"})
-	}
-	if book.Count > 0 {
-		if utils.ContainsString(book.Results[0].Languages, "en") {
-			if book.Results[0].Formats.ApplicationEpubZip != "" {
-				c.JSON(http.StatusOK, gin.H{"body": "Book found in epub format"})
-			} else {
-				c.JSON(http.StatusOK, gin.H{"body": "Book found, but not in epub format"})
-			}
-		}
-	} else {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	page, err := client.Search(utils.RequestContext(c), gutendex.Query{Search: title})
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": fmt.Sprintf("Error searching books: %v", err)})
+		return
+	}
+	if len(page.Results) == 0 {
 		c.JSON(http.StatusOK, gin.H{"body": "Book not found"})
+		return
+	}
+
+	best := bestMatch(page.Results, prefs)
+	alternatives := []BookOption{}
+	for i := range page.Results {
+		if i != best {
+			alternatives = append(alternatives, bookOption(&page.Results[i]))
+		}
+	}
+	response := gin.H{
+		"languages":    prefs.Languages,
+		"formats":      prefs.Formats,
+		"alternatives": alternatives,
 	}
-}
 
-func GetBook(c *gin.Context, title string) {
-	fmt.Println(title)
-	// gets the book from Project Gutenberg
-	return
+	if best < 0 {
+		response["body"] = fmt.Sprintf("Book found, but not in %s", strings.Join(prefs.Languages, " or "))
+		c.JSON(http.StatusOK, response)
+		return
+	}
+
+	match := bookOption(&page.Results[best])
+	for _, format := range prefs.Formats {
+		if link, ok := page.Results[best].Format(format); ok {
+			match.Format, match.URL = format, link
+			break
+		}
+	}
+	response["match"] = match
+	if match.Format != "" {
+		response["body"] = fmt.Sprintf("Book found in %s format", match.Format)
+	} else {
+		response["body"] = fmt.Sprintf("Book found, but not in %s format", strings.Join(prefs.Formats, " or "))
+	}
+	c.JSON(http.StatusOK, response)
 }
@@ -0,0 +1,90 @@
+package books
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rjhoppe/firelink/gutendex"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const findResults = `{"count": 3, "next": null, "previous": null, "results": [
+	{"id": 17489, "title": "Les misérables Tome I", "authors": [{"name": "Hugo, Victor"}], "languages": ["fr"],
+	 "formats": {"application/epub+zip": "https://www.gutenberg.org/ebooks/17489.epub3.images"}},
+	{"id": 135, "title": "Les Misérables", "authors": [{"name": "Hugo, Victor"}], "languages": ["en"],
+	 "formats": {"text/plain; charset=utf-8": "https://www.gutenberg.org/ebooks/135.txt.utf-8"}},
+	{"id": 48731, "title": "Les Misérables, v. 1/5", "authors": [{"name": "Hugo, Victor"}], "languages": ["en"],
+	 "formats": {"application/x-mobipocket-ebook": "https://www.gutenberg.org/ebooks/48731.kf8.images"}}
+]}`
+
+func findBook(t *testing.T, query string, prefs Preferences) map[string]any {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(findResults))
+	}))
+	t.Cleanup(server.Close)
+
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("GET", "/ebook/find/miserables"+query, nil)
+	CheckForBook(c, "miserables", gutendex.NewClient(gutendex.WithBaseURL(server.URL)), prefs)
+
+	var body map[string]any
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	return body
+}
+
+func TestCheckForBook_PicksPreferredFormat(t *testing.T) {
+	body := findBook(t, "", Preferences{Languages: []string{"en"}, Formats: []string{"epub", "mobi"}})
+
+	// The top result is French, and of the English ones only the second has a preferred format
+	assert.Equal(t, "Book found in mobi format", body["body"])
+	match := body["match"].(map[string]any)
+	assert.EqualValues(t, 48731, match["id"])
+	assert.Equal(t, "https://www.gutenberg.org/ebooks/48731.kf8.images", match["url"])
+	assert.Len(t, body["alternatives"], 2)
+}
+
+func TestCheckForBook_RequestOverridesDefaults(t *testing.T) {
+	body := findBook(t, "?lang=fr,en&format=txt", Preferences{Languages: []string{"en"}, Formats: []string{"epub"}})
+
+	// French comes first now, even though it has no txt copy
+	assert.Equal(t, "Book found, but not in txt format", body["body"])
+	match := body["match"].(map[string]any)
+	assert.EqualValues(t, 17489, match["id"])
+	assert.Equal(t, []any{"epub"}, match["formats"])
+}
+
+func TestCheckForBook_NoPreferredLanguage(t *testing.T) {
+	body := findBook(t, "", Preferences{Languages: []string{"de"}, Formats: []string{"epub"}})
+
+	assert.Equal(t, "Book found, but not in de", body["body"])
+	assert.Nil(t, body["match"])
+	assert.Len(t, body["alternatives"], 3)
+
+	body = findBook(t, "?format=pdf", Preferences{Languages: []string{"en"}, Formats: []string{"epub"}})
+	assert.Equal(t, `unknown format "pdf"`, body["error"])
+}
+
+func TestCheckForBook_UpstreamError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("GET", "/ebook/find/miserables", nil)
+	CheckForBook(c, "miserables", gutendex.NewClient(gutendex.WithBaseURL(server.URL)), Preferences{Languages: []string{"en"}, Formats: []string{"epub"}})
+
+	// Reported the same way as /ebook/search
+	assert.Equal(t, http.StatusBadGateway, w.Code)
+	var body map[string]any
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Contains(t, body["error"], "Error searching books")
+}
@@ -0,0 +1,193 @@
+package books
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rjhoppe/firelink/database"
+	"github.com/rjhoppe/firelink/mail"
+	"github.com/rjhoppe/firelink/models"
+	"github.com/rjhoppe/firelink/ntfy"
+	"github.com/rjhoppe/firelink/utils"
+	"gorm.io/gorm"
+)
+
+// ErrDeviceNotFound is returned by a DeviceStore when no device matches
+var ErrDeviceNotFound = errors.New("device not found")
+
+// deviceLimits are the largest attachments each kind of e-reader accepts by email
+var deviceLimits = map[string]int64{
+	"kindle": 50 << 20,
+}
+
+// DeviceStore persists the e-readers books can be sent to
+type DeviceStore interface {
+	Save(device *models.Device) error
+	List(user string) ([]models.Device, error)
+	Get(id uint) (*models.Device, error)
+	Delete(id uint) error
+}
+
+// DBDevices is a DeviceStore backed by the database
+type DBDevices struct{}
+
+func (s *DBDevices) Save(device *models.Device) error {
+	return database.GetDB().Save(device).Error
+}
+
+func (s *DBDevices) List(user string) ([]models.Device, error) {
+	var devices []models.Device
+	query := database.GetDB().Order("name")
+	if user != "" {
+		query = query.Where("\"user\" = ?", user)
+	}
+	err := query.Find(&devices).Error
+	return devices, err
+}
+
+func (s *DBDevices) Get(id uint) (*models.Device, error) {
+	var device models.Device
+	err := database.GetDB().First(&device, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrDeviceNotFound
+	}
+	return &device, err
+}
+
+func (s *DBDevices) Delete(id uint) error {
+	result := database.GetDB().Delete(&models.Device{}, id)
+	if result.Error == nil && result.RowsAffected == 0 {
+		return ErrDeviceNotFound
+	}
+	return result.Error
+}
+
+// MaxAttachmentSize returns the largest book the SMTP server is trusted with,
+// from SMTP_MAX_ATTACHMENT_MB (default 25)
+func MaxAttachmentSize() int64 {
+	return int64(utils.GetEnvInt("SMTP_MAX_ATTACHMENT_MB", 25)) << 20
+}
+
+// sizeLimit is the largest book that can be sent to a device
+func (l *Library) sizeLimit(device *models.Device) int64 {
+	limit := l.MaxAttachmentSize
+	if deviceLimit, ok := deviceLimits[device.Kind]; ok && (limit == 0 || deviceLimit < limit) {
+		limit = deviceLimit
+	}
+	return limit
+}
+
+// CreateDevice registers an e-reader email address for a user
+func (l *Library) CreateDevice(c *gin.Context) {
+	var req models.DeviceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	device := models.Device{User: req.User, Name: req.Name, Email: req.Email, Kind: req.Kind}
+	if device.Kind == "" {
+		device.Kind = "other"
+	}
+	if err := l.Devices.Save(&device); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Error saving device: %v", err)})
+		return
+	}
+	c.JSON(http.StatusCreated, device)
+}
+
+// GetDevices lists the registered devices, optionally only those of ?user=
+func (l *Library) GetDevices(c *gin.Context) {
+	devices, err := l.Devices.List(c.Query("user"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Error fetching devices: %v", err)})
+		return
+	}
+	if devices == nil {
+		devices = []models.Device{}
+	}
+	c.JSON(http.StatusOK, devices)
+}
+
+// DeleteDevice removes a registered device
+func (l *Library) DeleteDevice(c *gin.Context, deviceId string) {
+	id, err := strconv.ParseUint(deviceId, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid device ID"})
+		return
+	}
+	err = l.Devices.Delete(uint(id))
+	if errors.Is(err, ErrDeviceNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Device not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Error deleting device: %v", err)})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Device deleted"})
+}
+
+// SendToDevice emails a library book as an attachment to a registered e-reader
+func (l *Library) SendToDevice(c *gin.Context, bookId string) {
+	var req models.SendBookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	book, ok := l.findBook(c, bookId)
+	if !ok {
+		return
+	}
+	device, err := l.Devices.Get(req.DeviceId)
+	if errors.Is(err, ErrDeviceNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Device not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Error fetching device: %v", err)})
+		return
+	}
+
+	if limit := l.sizeLimit(device); limit > 0 && book.Size > limit {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("%s is %.1f MB, %s accepts at most %d MB", book.Title, float64(book.Size)/(1<<20), device.Name, limit>>20)})
+		return
+	}
+
+	data, err := os.ReadFile(filepath.Join(l.Dir, filepath.Base(book.FileName)))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Book file is missing from the library"})
+		return
+	}
+
+	ctx := utils.RequestContext(c)
+	err = l.Mailer.Send(ctx, mail.Message{
+		To:      []string{device.Email},
+		Subject: book.Title,
+		Body:    fmt.Sprintf("%s by %s, sent from firelink.", book.Title, book.Author),
+		Attachments: []mail.Attachment{{
+			Name:        book.FileName,
+			ContentType: contentTypes[book.Format],
+			Data:        data,
+		}},
+	})
+	if errors.Is(err, mail.ErrNotConfigured) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": fmt.Sprintf("Error sending book: %v", err)})
+		return
+	}
+
+	if l.Notifier != nil {
+		ntfy.NtfyBookSent(ctx, book.Title, device.Name, l.Notifier)
+	}
+	c.JSON(http.StatusOK, gin.H{"message": fmt.Sprintf("%s sent to %s", book.Title, device.Name)})
+}
@@ -0,0 +1,163 @@
+package books
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rjhoppe/firelink/mail"
+	"github.com/rjhoppe/firelink/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// MemoryDevices is an in-memory DeviceStore
+type MemoryDevices struct {
+	devices map[uint]models.Device
+}
+
+func (s *MemoryDevices) Save(device *models.Device) error {
+	if s.devices == nil {
+		s.devices = map[uint]models.Device{}
+	}
+	if device.ID == 0 {
+		device.ID = uint(len(s.devices) + 1)
+	}
+	s.devices[device.ID] = *device
+	return nil
+}
+
+func (s *MemoryDevices) List(user string) ([]models.Device, error) {
+	var devices []models.Device
+	for _, device := range s.devices {
+		if user == "" || device.User == user {
+			devices = append(devices, device)
+		}
+	}
+	return devices, nil
+}
+
+func (s *MemoryDevices) Get(id uint) (*models.Device, error) {
+	device, ok := s.devices[id]
+	if !ok {
+		return nil, ErrDeviceNotFound
+	}
+	return &device, nil
+}
+
+func (s *MemoryDevices) Delete(id uint) error {
+	if _, ok := s.devices[id]; !ok {
+		return ErrDeviceNotFound
+	}
+	delete(s.devices, id)
+	return nil
+}
+
+// RecordingSender captures sent messages instead of emailing them
+type RecordingSender struct {
+	Sent []mail.Message
+}
+
+func (s *RecordingSender) Send(ctx context.Context, msg mail.Message) error {
+	s.Sent = append(s.Sent, msg)
+	return nil
+}
+
+// MockNotifier records the last message sent
+type MockNotifier struct {
+	SentTitle   string
+	SentMessage string
+}
+
+func (m *MockNotifier) SendMessage(ctx context.Context, title, message string) error {
+	m.SentTitle = title
+	m.SentMessage = message
+	return nil
+}
+
+func (m *MockNotifier) SendFile(ctx context.Context, fileLoc string) error {
+	return nil
+}
+
+func sendRequest(library *Library, bookId, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("POST", "/ebook/library/"+bookId+"/send", bytes.NewBufferString(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	library.SendToDevice(c, bookId)
+	return w
+}
+
+func TestSendToDevice(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	downloads := 0
+	library := newTestLibrary(t, newGutenbergServer(t, &downloads))
+	sender := &RecordingSender{}
+	notifier := &MockNotifier{}
+	library.Devices = &MemoryDevices{}
+	library.Mailer = sender
+	library.Notifier = notifier
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("POST", "/ebook/download/2701", nil)
+	library.DownloadBook(c, "2701")
+	require.Equal(t, http.StatusCreated, w.Code)
+	require.NoError(t, library.Devices.Save(&models.Device{User: "ryan", Name: "Kindle", Email: "ryan@kindle.com", Kind: "kindle"}))
+
+	w = sendRequest(library, "1", `{"device_id": 1}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Len(t, sender.Sent, 1)
+	msg := sender.Sent[0]
+	assert.Equal(t, []string{"ryan@kindle.com"}, msg.To)
+	require.Len(t, msg.Attachments, 1)
+	assert.Equal(t, "2701-moby-dick-or-the-whale.epub", msg.Attachments[0].Name)
+	assert.Equal(t, "application/epub+zip", msg.Attachments[0].ContentType)
+	assert.Equal(t, epubBody, string(msg.Attachments[0].Data))
+	assert.Equal(t, "Book Sent", notifier.SentTitle)
+	assert.Contains(t, notifier.SentMessage, "Kindle")
+
+	w = sendRequest(library, "1", `{"device_id": 7}`)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = sendRequest(library, "1", `{}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestSendToDevice_TooLarge(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	sender := &RecordingSender{}
+	library := &Library{
+		Dir:               t.TempDir(),
+		Store:             &MemoryBooks{},
+		Devices:           &MemoryDevices{},
+		Mailer:            sender,
+		MaxAttachmentSize: 100 << 20,
+	}
+	require.NoError(t, library.Store.Save(&models.Book{Title: "Huge", Format: "epub", FileName: "huge.epub", Size: 60 << 20}))
+	require.NoError(t, library.Devices.Save(&models.Device{Name: "Kindle", Email: "me@kindle.com", Kind: "kindle"}))
+	require.NoError(t, library.Devices.Save(&models.Device{Name: "Kobo", Email: "me@example.com", Kind: "kobo"}))
+
+	// Kindle rejects attachments over 50 MB regardless of the SMTP limit
+	w := sendRequest(library, "1", `{"device_id": 1}`)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+
+	library.MaxAttachmentSize = 25 << 20
+	w = sendRequest(library, "1", `{"device_id": 2}`)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	assert.Empty(t, sender.Sent)
+}
+
+func TestCreateDevice_Invalid(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	library := &Library{Devices: &MemoryDevices{}}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("POST", "/ebook/devices", bytes.NewBufferString(`{"user":"ryan","name":"Kindle","email":"not-an-email"}`))
+	c.Request.Header.Set("Content-Type", "application/json")
+	library.CreateDevice(c)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
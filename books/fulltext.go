@@ -0,0 +1,83 @@
+package books
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rjhoppe/firelink/models"
+	"github.com/rjhoppe/firelink/textindex"
+)
+
+// indexable reports whether a library book can be searched inside
+func indexable(book *models.Book) bool {
+	return book.Format == "txt"
+}
+
+// indexBook adds a plain-text library book to the full-text index
+func (l *Library) indexBook(book *models.Book) error {
+	if l.Index == nil || !indexable(book) {
+		return nil
+	}
+	return l.Index.Add(book.ID, book.Title, filepath.Join(l.Dir, filepath.Base(book.FileName)))
+}
+
+// SearchText finds ?q= inside the plain-text books of the library, returning the book,
+// chapter, offset and a snippet of each match. ?limit= caps the results (default 20).
+func (l *Library) SearchText(c *gin.Context) {
+	if l.Index == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Full-text index is not available"})
+		return
+	}
+	query := strings.TrimSpace(c.Query("q"))
+	if len(textindex.Terms(query)) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing search query"})
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit < 1 || limit > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 100"})
+		return
+	}
+
+	hits, err := l.Index.Search(query, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Error searching library: %v", err)})
+		return
+	}
+	if hits == nil {
+		hits = []textindex.Hit{}
+	}
+	c.JSON(http.StatusOK, gin.H{"query": query, "results": hits})
+}
+
+// Reindex rebuilds the full-text index from the plain-text books in the library
+func (l *Library) Reindex(c *gin.Context) {
+	if l.Index == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Full-text index is not available"})
+		return
+	}
+	books, ok := l.libraryBooks(c)
+	if !ok {
+		return
+	}
+
+	indexed := 0
+	failed := []string{}
+	for i := range books {
+		if !indexable(&books[i]) {
+			continue
+		}
+		if err := l.indexBook(&books[i]); err != nil {
+			log.Printf("Could not index %s: %v", books[i].FileName, err)
+			failed = append(failed, fmt.Sprintf("%s: %v", books[i].Title, err))
+			continue
+		}
+		indexed++
+	}
+	c.JSON(http.StatusOK, gin.H{"indexed": indexed, "errors": failed})
+}
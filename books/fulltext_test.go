@@ -0,0 +1,107 @@
+package books
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rjhoppe/firelink/gutendex"
+	"github.com/rjhoppe/firelink/models"
+	"github.com/rjhoppe/firelink/textindex"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const taleOfTwoCities = `BOOK THE FIRST--RECALLED TO LIFE
+
+CHAPTER I.
+The Period
+
+It was the best of times, it was the worst of times, it was the age of
+wisdom, it was the age of foolishness.
+`
+
+func newTextLibrary(t *testing.T) *Library {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/books/98":
+			json.NewEncoder(w).Encode(gutendex.Book{
+				ID:      98,
+				Title:   "A Tale of Two Cities",
+				Formats: map[string]string{"text/plain; charset=utf-8": server.URL + "/files/98.txt"},
+			})
+		case "/files/98.txt":
+			fmt.Fprint(w, taleOfTwoCities)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	library := newTestLibrary(t, server)
+	index, err := textindex.Open(filepath.Join(library.Dir, "index"))
+	require.NoError(t, err)
+	library.Index = index
+	return library
+}
+
+func searchText(library *Library, target string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("GET", target, nil)
+	library.SearchText(c)
+	return w
+}
+
+func TestSearchText(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	library := newTextLibrary(t)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("POST", "/ebook/download/98?format=txt", nil)
+	library.DownloadBook(c, "98")
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	w = searchText(library, "/ebook/library/search?q=worst+of+times")
+	require.Equal(t, http.StatusOK, w.Code)
+	var resp struct {
+		Results []textindex.Hit `json:"results"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Len(t, resp.Results, 1)
+	hit := resp.Results[0]
+	assert.Equal(t, uint(1), hit.BookId)
+	assert.Equal(t, "A Tale of Two Cities", hit.Title)
+	assert.Equal(t, "CHAPTER I", hit.Chapter)
+	assert.Contains(t, hit.Snippet, "it was the **worst** **of** **times**")
+
+	w = searchText(library, "/ebook/library/search?q=--")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestReindex(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	library := newTextLibrary(t)
+	// A book stored before the index existed
+	_, _, err := library.store(strings.NewReader(taleOfTwoCities), "98-a-tale-of-two-cities.txt")
+	require.NoError(t, err)
+	require.NoError(t, library.Store.Save(&models.Book{Title: "A Tale of Two Cities", Format: "txt", FileName: "98-a-tale-of-two-cities.txt"}))
+	require.NoError(t, library.Store.Save(&models.Book{Title: "Scanned", Format: "pdf", FileName: "scanned.pdf"}))
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("POST", "/ebook/library/reindex", nil)
+	library.Reindex(c)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"indexed": 1, "errors": []}`, w.Body.String())
+
+	w = searchText(library, "/ebook/library/search?q=age+of+wisdom")
+	assert.Contains(t, w.Body.String(), "**wisdom**")
+}
@@ -0,0 +1,401 @@
+package books
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rjhoppe/firelink/database"
+	"github.com/rjhoppe/firelink/gutendex"
+	"github.com/rjhoppe/firelink/mail"
+	"github.com/rjhoppe/firelink/models"
+	"github.com/rjhoppe/firelink/ntfy"
+	"github.com/rjhoppe/firelink/textindex"
+	"github.com/rjhoppe/firelink/utils"
+	"gorm.io/gorm"
+)
+
+// ErrBookNotFound is returned by a BookStore when no book matches
+var ErrBookNotFound = errors.New("book not found")
+
+// downloadFormats are the formats that can be downloaded into the library
+var downloadFormats = []string{"epub", "mobi", "txt"}
+
+// BookStore persists the books in the local library
+type BookStore interface {
+	Save(book *models.Book) error
+	List() ([]models.Book, error)
+	Get(id uint) (*models.Book, error)
+	FindDownload(gutenbergId int, format string) (*models.Book, error)
+	FindByHash(sha256 string) (*models.Book, error)
+	// Search returns books whose title, author or subjects contain query
+	Search(query string) ([]models.Book, error)
+}
+
+// DBBooks is a BookStore backed by the database
+type DBBooks struct{}
+
+func (s *DBBooks) Save(book *models.Book) error {
+	return database.GetDB().Save(book).Error
+}
+
+func (s *DBBooks) List() ([]models.Book, error) {
+	var books []models.Book
+	err := database.GetDB().Order("title").Find(&books).Error
+	return books, err
+}
+
+func (s *DBBooks) Get(id uint) (*models.Book, error) {
+	var book models.Book
+	err := database.GetDB().First(&book, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrBookNotFound
+	}
+	return &book, err
+}
+
+func (s *DBBooks) FindDownload(gutenbergId int, format string) (*models.Book, error) {
+	var book models.Book
+	err := database.GetDB().Where("gutenberg_id = ? AND format = ?", gutenbergId, format).First(&book).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrBookNotFound
+	}
+	return &book, err
+}
+
+func (s *DBBooks) FindByHash(sha256 string) (*models.Book, error) {
+	var book models.Book
+	err := database.GetDB().Where("sha256 = ?", sha256).First(&book).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrBookNotFound
+	}
+	return &book, err
+}
+
+func (s *DBBooks) Search(query string) ([]models.Book, error) {
+	var books []models.Book
+	like := "%" + query + "%"
+	err := database.GetDB().
+		Where("title ILIKE ? OR author ILIKE ? OR subjects ILIKE ?", like, like, like).
+		Order("title").
+		Find(&books).Error
+	return books, err
+}
+
+// Library downloads books from Project Gutenberg, keeps them in Dir and
+// emails them to registered e-readers
+type Library struct {
+	Dir        string
+	Store      BookStore
+	Gutendex   *gutendex.Client
+	HTTPClient *http.Client
+
+	// DownloadClient fetches book files. It should have no overall timeout, since a
+	// large book can take a while; downloads are bounded by size and idle time instead.
+	DownloadClient      *http.Client
+	MaxDownloadSize     int64         // largest downloaded book, 0 for no limit
+	DownloadIdleTimeout time.Duration // how long a download may stall, 0 for no limit
+
+	MaxUploadSize int64 // largest accepted upload, 0 for no limit
+
+	Index *textindex.Index // full-text index of plain-text books, nil to disable
+
+	Devices           DeviceStore
+	Mailer            mail.Sender
+	Notifier          ntfy.Notifier
+	MaxAttachmentSize int64 // largest book emailed to a device, 0 for no limit
+}
+
+// LibraryDir returns the directory books are stored in, from FIRELINK_LIBRARY_DIR (default "library")
+func LibraryDir() string {
+	if dir := os.Getenv("FIRELINK_LIBRARY_DIR"); dir != "" {
+		return dir
+	}
+	return "library"
+}
+
+func (l *Library) httpClient() *http.Client {
+	if l.HTTPClient != nil {
+		return l.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+// MaxDownloadSize returns the largest book downloaded, from FIRELINK_DOWNLOAD_MAX_MB (default 500)
+func MaxDownloadSize() int64 {
+	return int64(utils.GetEnvInt("FIRELINK_DOWNLOAD_MAX_MB", 500)) << 20
+}
+
+// DownloadIdleTimeout returns how long a download may go without receiving data, from
+// GUTENDEX_DOWNLOAD_IDLE_TIMEOUT (default 30s)
+func DownloadIdleTimeout() time.Duration {
+	return utils.GetEnvDuration("GUTENDEX_DOWNLOAD_IDLE_TIMEOUT", 30*time.Second)
+}
+
+// errDownloadTooLarge is returned when a download exceeds MaxDownloadSize
+var errDownloadTooLarge = errors.New("download is too large")
+
+// idleReader reads a download, pushing its idle deadline back whenever data arrives
+type idleReader struct {
+	r       io.Reader
+	timer   *time.Timer
+	timeout time.Duration
+	left    int64 // bytes allowed before the download is too large, negative for no limit
+}
+
+func (r *idleReader) Read(p []byte) (int, error) {
+	if r.left >= 0 && int64(len(p)) > r.left+1 {
+		p = p[:r.left+1]
+	}
+	n, err := r.r.Read(p)
+	if r.timer != nil {
+		r.timer.Reset(r.timeout)
+	}
+	if r.left >= 0 {
+		if r.left -= int64(n); r.left < 0 {
+			return n, errDownloadTooLarge
+		}
+	}
+	return n, err
+}
+
+// download fetches a book file. The request is cancelled when no data arrives for
+// DownloadIdleTimeout, and reading fails once MaxDownloadSize is exceeded. The returned
+// cancel must be called once the body has been read.
+func (l *Library) download(ctx context.Context, link string) (*http.Response, io.Reader, context.CancelFunc, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	req, err := http.NewRequestWithContext(ctx, "GET", link, nil)
+	if err != nil {
+		cancel()
+		return nil, nil, nil, err
+	}
+	body := &idleReader{timeout: l.DownloadIdleTimeout, left: -1}
+	if l.MaxDownloadSize > 0 {
+		body.left = l.MaxDownloadSize
+	}
+	if l.DownloadIdleTimeout > 0 {
+		body.timer = time.AfterFunc(l.DownloadIdleTimeout, cancel)
+	}
+	stop := func() {
+		if body.timer != nil {
+			body.timer.Stop()
+		}
+		cancel()
+	}
+
+	client := l.DownloadClient
+	if client == nil {
+		client = l.httpClient()
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		stop()
+		return nil, nil, nil, err
+	}
+	body.r = resp.Body
+	return resp, body, stop, nil
+}
+
+var nonSlugChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+// fileName builds a readable, filesystem-safe name such as "2701-moby-dick.epub"
+func fileName(gutenbergId int, title, format string) string {
+	slug := strings.Trim(nonSlugChars.ReplaceAllString(strings.ToLower(title), "-"), "-")
+	if len(slug) > 60 {
+		slug = strings.TrimRight(slug[:60], "-")
+	}
+	if slug == "" {
+		return fmt.Sprintf("%d.%s", gutenbergId, format)
+	}
+	return fmt.Sprintf("%d-%s.%s", gutenbergId, slug, format)
+}
+
+// authorName returns the first listed author of a book
+func authorName(book *gutendex.Book) string {
+	if len(book.Authors) == 0 {
+		return ""
+	}
+	return book.Authors[0].Name
+}
+
+// applyGutenberg copies Gutenberg's title, author, subjects and language onto a library book
+func applyGutenberg(record *models.Book, book *gutendex.Book) {
+	record.Title = book.Title
+	record.Author = authorName(book)
+	record.Subjects = strings.Join(book.Subjects, models.ListSeparator)
+	if len(book.Languages) > 0 {
+		record.Language = book.Languages[0]
+	}
+}
+
+// store streams r into the library under name, returning its size and sha256 checksum.
+// The file is written to a temporary name first so a failed download never leaves a partial book.
+func (l *Library) store(r io.Reader, name string) (int64, string, error) {
+	if err := os.MkdirAll(l.Dir, 0755); err != nil {
+		return 0, "", fmt.Errorf("could not create library directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(l.Dir, ".download-*")
+	if err != nil {
+		return 0, "", fmt.Errorf("could not create file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hash), r)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return 0, "", fmt.Errorf("could not write file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(l.Dir, name)); err != nil {
+		return 0, "", fmt.Errorf("could not move file into library: %w", err)
+	}
+	return size, hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// DownloadBook downloads a Gutenberg book in ?format= (epub, mobi or txt, default epub)
+// into the library. Books already in the library are returned without downloading again.
+func (l *Library) DownloadBook(c *gin.Context, bookId string) {
+	id, err := strconv.Atoi(bookId)
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid book ID"})
+		return
+	}
+	format := c.DefaultQuery("format", "epub")
+	if !utils.ContainsString(downloadFormats, format) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Unsupported format %q, use one of %s", format, strings.Join(downloadFormats, ", "))})
+		return
+	}
+
+	existing, err := l.Store.FindDownload(id, format)
+	if err == nil {
+		c.JSON(http.StatusOK, existing)
+		return
+	}
+	if !errors.Is(err, ErrBookNotFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Error checking library: %v", err)})
+		return
+	}
+
+	ctx := utils.RequestContext(c)
+	book, err := l.Gutendex.Book(ctx, id)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": fmt.Sprintf("Error fetching book: %v", err)})
+		return
+	}
+	link, ok := book.Format(format)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Book %d is not available as %s", id, format)})
+		return
+	}
+
+	resp, body, stop, err := l.download(ctx, link)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": fmt.Sprintf("Error downloading book: %v", err)})
+		return
+	}
+	defer stop()
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		c.JSON(http.StatusBadGateway, gin.H{"error": fmt.Sprintf("Download returned status code %d", resp.StatusCode)})
+		return
+	}
+
+	record := models.Book{
+		GutenbergId: id,
+		Format:      format,
+		FileName:    fileName(id, book.Title, format),
+	}
+	applyGutenberg(&record, book)
+	if record.Size, record.Sha256, err = l.store(body, record.FileName); err != nil {
+		if errors.Is(err, errDownloadTooLarge) {
+			c.JSON(http.StatusBadGateway, gin.H{"error": fmt.Sprintf("Book is larger than %d MB", l.MaxDownloadSize>>20)})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Error storing book: %v", err)})
+		return
+	}
+	coverURL, _ := book.Format("cover")
+	l.enrich(ctx, &record, coverURL)
+
+	if err := l.Store.Save(&record); err != nil {
+		os.Remove(filepath.Join(l.Dir, record.FileName))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Error saving book: %v", err)})
+		return
+	}
+	if err := l.indexBook(&record); err != nil {
+		log.Printf("Could not index %s: %v", record.FileName, err)
+	}
+	c.JSON(http.StatusCreated, record)
+}
+
+// GetLibrary lists the books in the library
+func (l *Library) GetLibrary(c *gin.Context) {
+	books, err := l.Store.List()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Error fetching library: %v", err)})
+		return
+	}
+	if books == nil {
+		books = []models.Book{}
+	}
+	c.JSON(http.StatusOK, books)
+}
+
+// findBook looks up a library book by its database id
+func (l *Library) findBook(c *gin.Context, bookId string) (*models.Book, bool) {
+	id, err := strconv.ParseUint(bookId, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid book ID"})
+		return nil, false
+	}
+	book, err := l.Store.Get(uint(id))
+	if errors.Is(err, ErrBookNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Book not found"})
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Error fetching book: %v", err)})
+		return nil, false
+	}
+	return book, true
+}
+
+// contentTypes are the MIME types books are served with
+var contentTypes = map[string]string{
+	"epub": "application/epub+zip",
+	"mobi": "application/x-mobipocket-ebook",
+	"txt":  "text/plain; charset=utf-8",
+	"pdf":  "application/pdf",
+}
+
+// GetLibraryFile serves the file of a library book as an attachment
+func (l *Library) GetLibraryFile(c *gin.Context, bookId string) {
+	book, ok := l.findBook(c, bookId)
+	if !ok {
+		return
+	}
+
+	path := filepath.Join(l.Dir, filepath.Base(book.FileName))
+	if _, err := os.Stat(path); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Book file is missing from the library"})
+		return
+	}
+	if contentType, ok := contentTypes[book.Format]; ok {
+		c.Header("Content-Type", contentType)
+	}
+	c.FileAttachment(path, book.FileName)
+}
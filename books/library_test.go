@@ -0,0 +1,240 @@
+package books
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rjhoppe/firelink/gutendex"
+	"github.com/rjhoppe/firelink/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// MemoryBooks is an in-memory BookStore
+type MemoryBooks struct {
+	books []models.Book
+}
+
+func (s *MemoryBooks) Save(book *models.Book) error {
+	if book.ID == 0 {
+		book.ID = uint(len(s.books) + 1)
+		s.books = append(s.books, *book)
+		return nil
+	}
+	s.books[book.ID-1] = *book
+	return nil
+}
+
+func (s *MemoryBooks) List() ([]models.Book, error) {
+	return s.books, nil
+}
+
+func (s *MemoryBooks) Get(id uint) (*models.Book, error) {
+	if id == 0 || int(id) > len(s.books) {
+		return nil, ErrBookNotFound
+	}
+	return &s.books[id-1], nil
+}
+
+func (s *MemoryBooks) FindDownload(gutenbergId int, format string) (*models.Book, error) {
+	for i := range s.books {
+		if s.books[i].GutenbergId == gutenbergId && s.books[i].Format == format {
+			return &s.books[i], nil
+		}
+	}
+	return nil, ErrBookNotFound
+}
+
+func (s *MemoryBooks) FindByHash(sha256 string) (*models.Book, error) {
+	for i := range s.books {
+		if s.books[i].Sha256 == sha256 {
+			return &s.books[i], nil
+		}
+	}
+	return nil, ErrBookNotFound
+}
+
+func (s *MemoryBooks) Search(query string) ([]models.Book, error) {
+	var books []models.Book
+	query = strings.ToLower(query)
+	for _, book := range s.books {
+		text := strings.ToLower(book.Title + " " + book.Author + " " + book.Subjects)
+		if strings.Contains(text, query) {
+			books = append(books, book)
+		}
+	}
+	return books, nil
+}
+
+const epubBody = "PK fake epub contents"
+
+// newGutenbergServer serves book 2701 as Gutendex metadata plus an epub file,
+// counting how many times the file was downloaded
+func newGutenbergServer(t *testing.T, downloads *int) *httptest.Server {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/books/2701":
+			json.NewEncoder(w).Encode(gutendex.Book{
+				ID:        2701,
+				Title:     "Moby Dick; Or, The Whale",
+				Authors:   []gutendex.Person{{Name: "Melville, Herman"}},
+				Languages: []string{"en"},
+				Formats:   map[string]string{"application/epub+zip": server.URL + "/files/2701.epub"},
+			})
+		case "/files/2701.epub":
+			*downloads++
+			fmt.Fprint(w, epubBody)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func newTestLibrary(t *testing.T, server *httptest.Server) *Library {
+	return &Library{
+		Dir:      t.TempDir(),
+		Store:    &MemoryBooks{},
+		Gutendex: gutendex.NewClient(gutendex.WithBaseURL(server.URL)),
+	}
+}
+
+func TestDownloadBook(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	downloads := 0
+	library := newTestLibrary(t, newGutenbergServer(t, &downloads))
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("POST", "/ebook/download/2701", nil)
+	library.DownloadBook(c, "2701")
+
+	require.Equal(t, http.StatusCreated, w.Code)
+	var book models.Book
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &book))
+	sum := sha256.Sum256([]byte(epubBody))
+	assert.Equal(t, "2701-moby-dick-or-the-whale.epub", book.FileName)
+	assert.Equal(t, "Melville, Herman", book.Author)
+	assert.Equal(t, int64(len(epubBody)), book.Size)
+	assert.Equal(t, hex.EncodeToString(sum[:]), book.Sha256)
+
+	data, err := os.ReadFile(filepath.Join(library.Dir, book.FileName))
+	require.NoError(t, err)
+	assert.Equal(t, epubBody, string(data))
+
+	// A second request is served from the library
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("POST", "/ebook/download/2701", nil)
+	library.DownloadBook(c, "2701")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 1, downloads)
+}
+
+func TestDownloadBook_SizeAndIdleLimits(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	downloads := 0
+	library := newTestLibrary(t, newGutenbergServer(t, &downloads))
+	download := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("POST", "/ebook/download/2701", nil)
+		library.DownloadBook(c, "2701")
+		return w
+	}
+
+	library.MaxDownloadSize = int64(len(epubBody)) - 1
+	assert.Equal(t, http.StatusBadGateway, download().Code)
+
+	// The idle timeout only applies while waiting for data, not to the whole download
+	library.MaxDownloadSize = int64(len(epubBody))
+	library.DownloadIdleTimeout = time.Second
+	assert.Equal(t, http.StatusCreated, download().Code)
+
+	entries, _ := os.ReadDir(library.Dir)
+	assert.Len(t, entries, 1)
+}
+
+func TestDownload_StallIsCancelled(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("partial"))
+		w.(http.Flusher).Flush()
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	library := &Library{DownloadIdleTimeout: 50 * time.Millisecond}
+	resp, body, stop, err := library.download(context.Background(), server.URL)
+	require.NoError(t, err)
+	defer stop()
+	defer resp.Body.Close()
+	_, err = io.ReadAll(body)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestDownloadBook_UnavailableFormat(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	downloads := 0
+	library := newTestLibrary(t, newGutenbergServer(t, &downloads))
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("POST", "/ebook/download/2701?format=mobi", nil)
+	library.DownloadBook(c, "2701")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("POST", "/ebook/download/2701?format=pdf", nil)
+	library.DownloadBook(c, "2701")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	entries, _ := os.ReadDir(library.Dir)
+	assert.Empty(t, entries)
+}
+
+func TestGetLibraryFile(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	downloads := 0
+	library := newTestLibrary(t, newGutenbergServer(t, &downloads))
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("POST", "/ebook/download/2701", nil)
+	library.DownloadBook(c, "2701")
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("GET", "/ebook/library/1/file", nil)
+	library.GetLibraryFile(c, "1")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/epub+zip", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Header().Get("Content-Disposition"), "2701-moby-dick-or-the-whale.epub")
+	assert.Equal(t, epubBody, w.Body.String())
+
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("GET", "/ebook/library/9/file", nil)
+	library.GetLibraryFile(c, "9")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,215 @@
+package books
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rjhoppe/firelink/epub"
+	"github.com/rjhoppe/firelink/models"
+	"github.com/rjhoppe/firelink/utils"
+)
+
+// coversDir is the library subdirectory cached covers are kept in
+const coversDir = "covers"
+
+// maxCoverDownload bounds the size of a downloaded cover image
+const maxCoverDownload = 10 << 20
+
+// coverExtensions maps cover media types to file extensions
+var coverExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+// mergeMetadata fills the empty fields of a book from its EPUB metadata,
+// keeping anything already known from Gutenberg or entered by hand
+func mergeMetadata(book *models.Book, metadata *epub.Metadata) {
+	if book.Title == "" {
+		book.Title = metadata.Title
+	}
+	if book.Author == "" && len(metadata.Authors) > 0 {
+		book.Author = metadata.Authors[0]
+	}
+	if book.Language == "" {
+		book.Language = metadata.Language
+	}
+	if book.Subjects == "" {
+		book.Subjects = strings.Join(metadata.Subjects, models.ListSeparator)
+	}
+	if book.Description == "" {
+		book.Description = metadata.Description
+	}
+	if book.Publisher == "" {
+		book.Publisher = metadata.Publisher
+	}
+	if book.Identifiers == "" {
+		identifiers := make([]string, 0, len(metadata.Identifiers))
+		for _, identifier := range metadata.Identifiers {
+			if identifier.Scheme != "" {
+				identifiers = append(identifiers, strings.ToLower(identifier.Scheme)+":"+identifier.Value)
+			} else {
+				identifiers = append(identifiers, identifier.Value)
+			}
+		}
+		book.Identifiers = strings.Join(identifiers, models.ListSeparator)
+	}
+}
+
+// metadataFields lists the descriptive fields of a book that a refresh re-derives
+func metadataFields(book *models.Book) []*string {
+	return []*string{&book.Title, &book.Author, &book.Language, &book.Subjects, &book.Description, &book.Publisher, &book.Identifiers}
+}
+
+// writeCover stores a cover image in the covers directory, named after the book's checksum
+func (l *Library) writeCover(book *models.Book, data []byte, contentType string) error {
+	ext, ok := coverExtensions[strings.SplitN(contentType, ";", 2)[0]]
+	if !ok {
+		return fmt.Errorf("unsupported cover type %q", contentType)
+	}
+	if err := os.MkdirAll(filepath.Join(l.Dir, coversDir), 0755); err != nil {
+		return fmt.Errorf("could not create covers directory: %w", err)
+	}
+	name := book.Sha256
+	if len(name) > 16 {
+		name = name[:16]
+	}
+	if name == "" {
+		name = fmt.Sprintf("book-%d", book.ID)
+	}
+	name += ext
+	if err := os.WriteFile(filepath.Join(l.Dir, coversDir, name), data, 0644); err != nil {
+		return fmt.Errorf("could not write cover: %w", err)
+	}
+	// A cover of another type leaves the old file behind under a different extension
+	if book.CoverFile != "" && book.CoverFile != name {
+		os.Remove(filepath.Join(l.Dir, coversDir, filepath.Base(book.CoverFile)))
+	}
+	book.CoverFile = name
+	return nil
+}
+
+// downloadCover fetches a cover image from coverURL
+func (l *Library) downloadCover(ctx context.Context, coverURL string) ([]byte, string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", coverURL, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	resp, err := l.httpClient().Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("cover returned status code %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxCoverDownload))
+	if err != nil {
+		return nil, "", err
+	}
+	contentType := resp.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = http.DetectContentType(data)
+	}
+	return data, contentType, nil
+}
+
+// enrich merges the EPUB metadata onto a library book and caches its cover, preferring
+// coverURL and falling back to the cover inside the EPUB. Failures are logged rather than
+// returned since a book without metadata or a cover is still usable.
+func (l *Library) enrich(ctx context.Context, book *models.Book, coverURL string) {
+	path := filepath.Join(l.Dir, filepath.Base(book.FileName))
+	if book.Format == "epub" {
+		if metadata, err := epub.ReadFile(path); err != nil {
+			log.Printf("Could not read metadata of %s: %v", book.FileName, err)
+		} else {
+			mergeMetadata(book, metadata)
+		}
+	}
+
+	if coverURL != "" {
+		data, contentType, err := l.downloadCover(ctx, coverURL)
+		if err == nil {
+			err = l.writeCover(book, data, contentType)
+		}
+		if err == nil {
+			return
+		}
+		log.Printf("Could not cache cover of %s: %v", book.FileName, err)
+	}
+	if book.Format == "epub" {
+		data, contentType, err := epub.Cover(path)
+		if err == nil {
+			err = l.writeCover(book, data, contentType)
+		}
+		if err != nil && !errors.Is(err, epub.ErrNoCover) {
+			log.Printf("Could not extract cover of %s: %v", book.FileName, err)
+		}
+	}
+}
+
+// RefreshMetadata re-reads the metadata and cover of a library book. The stored fields are
+// replaced by what Gutenberg and the EPUB say now, and only kept where neither has a value.
+func (l *Library) RefreshMetadata(c *gin.Context, bookId string) {
+	book, ok := l.findBook(c, bookId)
+	if !ok {
+		return
+	}
+
+	previous := *book
+	for _, field := range metadataFields(book) {
+		*field = ""
+	}
+
+	ctx := utils.RequestContext(c)
+	coverURL := ""
+	if book.GutenbergId > 0 && l.Gutendex != nil {
+		if gutenbergBook, err := l.Gutendex.Book(ctx, book.GutenbergId); err == nil {
+			applyGutenberg(book, gutenbergBook)
+			coverURL, _ = gutenbergBook.Format("cover")
+		}
+	}
+	l.enrich(ctx, book, coverURL)
+
+	kept := metadataFields(&previous)
+	for i, field := range metadataFields(book) {
+		if *field == "" {
+			*field = *kept[i]
+		}
+	}
+
+	if err := l.Store.Save(book); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Error saving book: %v", err)})
+		return
+	}
+	c.JSON(http.StatusOK, book)
+}
+
+// GetCover serves the cached cover of a library book
+func (l *Library) GetCover(c *gin.Context, bookId string) {
+	book, ok := l.findBook(c, bookId)
+	if !ok {
+		return
+	}
+	if book.CoverFile == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Book has no cover"})
+		return
+	}
+
+	path := filepath.Join(l.Dir, coversDir, filepath.Base(book.CoverFile))
+	if _, err := os.Stat(path); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Cover is missing from the library"})
+		return
+	}
+	c.Header("Cache-Control", "public, max-age=86400")
+	c.File(path)
+}
@@ -0,0 +1,169 @@
+package books
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rjhoppe/firelink/epub"
+	"github.com/rjhoppe/firelink/gutendex"
+	"github.com/rjhoppe/firelink/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// buildEpub returns a minimal EPUB whose OPF declares a description and a PNG cover
+func buildEpub(t *testing.T) []byte {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	// The mimetype entry comes first and uncompressed, which is how EPUBs are recognised
+	mimetype, err := w.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store})
+	require.NoError(t, err)
+	mimetype.Write([]byte("application/epub+zip"))
+	for name, content := range map[string]string{
+		"META-INF/container.xml": `<container><rootfiles><rootfile full-path="content.opf" media-type="application/oebps-package+xml"/></rootfiles></container>`,
+		"content.opf": `<package><metadata>
+			<title>Pride and Prejudice (EPUB title)</title>
+			<creator>Jane Austen</creator>
+			<description>A novel of manners.</description>
+			<publisher>Project Gutenberg</publisher>
+			<identifier scheme="URI">http://www.gutenberg.org/1342</identifier>
+			<meta name="cover" content="cover"/>
+		</metadata><manifest><item id="cover" href="cover.png" media-type="image/png"/></manifest></package>`,
+		"cover.png": "embedded png",
+	} {
+		f, err := w.Create(name)
+		require.NoError(t, err)
+		f.Write([]byte(content))
+	}
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+// newCoverServer serves book 1342 with an EPUB and, when withCover is set, a JPEG cover URL
+func newCoverServer(t *testing.T, withCover bool) *httptest.Server {
+	book := buildEpub(t)
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/books/1342":
+			formats := map[string]string{"application/epub+zip": server.URL + "/files/1342.epub"}
+			if withCover {
+				formats["image/jpeg"] = server.URL + "/files/1342.jpg"
+			}
+			json.NewEncoder(w).Encode(gutendex.Book{
+				ID:      1342,
+				Title:   "Pride and Prejudice",
+				Authors: []gutendex.Person{{Name: "Austen, Jane"}},
+				Formats: formats,
+			})
+		case "/files/1342.epub":
+			w.Write(book)
+		case "/files/1342.jpg":
+			w.Header().Set("Content-Type", "image/jpeg")
+			w.Write([]byte("gutenberg jpeg"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func downloadAndCover(t *testing.T, library *Library) (models.Book, *httptest.ResponseRecorder) {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("POST", "/ebook/download/1342", nil)
+	library.DownloadBook(c, "1342")
+	require.Equal(t, http.StatusCreated, w.Code)
+	var book models.Book
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &book))
+
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("GET", "/ebook/library/1/cover", nil)
+	library.GetCover(c, "1")
+	return book, w
+}
+
+func TestDownloadBook_Enriched(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	library := newTestLibrary(t, newCoverServer(t, true))
+
+	book, cover := downloadAndCover(t, library)
+	// Gutenberg's own metadata wins, the EPUB fills in what it lacks
+	assert.Equal(t, "Pride and Prejudice", book.Title)
+	assert.Equal(t, "Austen, Jane", book.Author)
+	assert.Equal(t, "A novel of manners.", book.Description)
+	assert.Equal(t, "Project Gutenberg", book.Publisher)
+	assert.Equal(t, "uri:http://www.gutenberg.org/1342", book.Identifiers)
+	assert.Equal(t, book.Sha256[:16]+".jpg", book.CoverFile)
+
+	require.Equal(t, http.StatusOK, cover.Code)
+	assert.Equal(t, "gutenberg jpeg", cover.Body.String())
+}
+
+func TestDownloadBook_EmbeddedCover(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	library := newTestLibrary(t, newCoverServer(t, false))
+
+	book, cover := downloadAndCover(t, library)
+	assert.Equal(t, book.Sha256[:16]+".png", book.CoverFile)
+	require.Equal(t, http.StatusOK, cover.Code)
+	assert.Equal(t, "embedded png", cover.Body.String())
+}
+
+func TestMergeMetadata_KeepsExisting(t *testing.T) {
+	book := models.Book{Title: "My Title", Subjects: "Cooking"}
+	mergeMetadata(&book, &epub.Metadata{
+		Title:       "EPUB Title",
+		Authors:     []string{"Someone"},
+		Language:    "fr",
+		Subjects:    []string{"Other"},
+		Identifiers: []epub.Identifier{{Scheme: "ISBN", Value: "978"}, {Value: "urn:uuid:1"}},
+	})
+	assert.Equal(t, "My Title", book.Title)
+	assert.Equal(t, "Someone", book.Author)
+	assert.Equal(t, "fr", book.Language)
+	assert.Equal(t, "Cooking", book.Subjects)
+	assert.Equal(t, "isbn:978; urn:uuid:1", book.Identifiers)
+}
+
+func TestRefreshMetadata_Overwrites(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	library := newTestLibrary(t, newCoverServer(t, true))
+	book, _ := downloadAndCover(t, library)
+
+	stored, err := library.Store.Get(book.ID)
+	require.NoError(t, err)
+	stored.Title, stored.Author, stored.Description = "Wrong Title", "Nobody", "Stale description"
+	stored.Identifiers = ""
+	require.NoError(t, library.Store.Save(stored))
+
+	// Gutenberg no longer lists a cover, so the one inside the EPUB replaces it
+	library.Gutendex = gutendex.NewClient(gutendex.WithBaseURL(newCoverServer(t, false).URL))
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("POST", "/ebook/library/1/metadata", nil)
+	library.RefreshMetadata(c, "1")
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var refreshed models.Book
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &refreshed))
+	assert.Equal(t, "Pride and Prejudice", refreshed.Title)
+	assert.Equal(t, "Austen, Jane", refreshed.Author)
+	assert.Equal(t, "A novel of manners.", refreshed.Description)
+	assert.Equal(t, "uri:http://www.gutenberg.org/1342", refreshed.Identifiers)
+	assert.Equal(t, book.Sha256[:16]+".png", refreshed.CoverFile)
+
+	entries, err := os.ReadDir(filepath.Join(library.Dir, coversDir))
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, refreshed.CoverFile, entries[0].Name())
+}
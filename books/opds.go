@@ -0,0 +1,237 @@
+package books
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rjhoppe/firelink/models"
+	"github.com/rjhoppe/firelink/opds"
+)
+
+// Paths of the OPDS catalog
+const (
+	opdsRoot       = "/opds"
+	opdsSearch     = "/opds/opensearch.xml"
+	opdsRecent     = "/opds/recent"
+	opdsAuthors    = "/opds/authors"
+	opdsSubjects   = "/opds/subjects"
+	opdsAll        = "/opds/all"
+	opdsRecentSize = 50
+)
+
+// subjectList splits the stored subjects of a book
+func subjectList(book models.Book) []string {
+	if book.Subjects == "" {
+		return nil
+	}
+	return strings.Split(book.Subjects, models.ListSeparator)
+}
+
+// latestUpdate is the newest change across books, used as a feed's updated time
+func latestUpdate(books []models.Book) time.Time {
+	var latest time.Time
+	for _, book := range books {
+		if book.UpdatedAt.After(latest) {
+			latest = book.UpdatedAt
+		}
+	}
+	return latest
+}
+
+// bookEntry describes a library book with an acquisition link to its file
+func bookEntry(book models.Book) opds.Entry {
+	entry := opds.Entry{
+		Title:    book.Title,
+		ID:       fmt.Sprintf("urn:firelink:book:%d", book.ID),
+		Updated:  opds.Timestamp(book.UpdatedAt),
+		Language: book.Language,
+		Links: []opds.Link{{
+			Rel:  opds.RelAcquisition,
+			Href: fmt.Sprintf("/ebook/library/%d/file", book.ID),
+			Type: strings.SplitN(contentTypes[book.Format], ";", 2)[0],
+		}},
+	}
+	if book.Author != "" {
+		entry.Authors = []opds.Author{{Name: book.Author}}
+	}
+	for _, subject := range subjectList(book) {
+		entry.Categories = append(entry.Categories, opds.Category{Term: subject, Label: subject})
+	}
+	if book.CoverFile != "" {
+		cover := fmt.Sprintf("/ebook/library/%d/cover", book.ID)
+		entry.Links = append(entry.Links,
+			opds.Link{Rel: opds.RelImage, Href: cover},
+			opds.Link{Rel: opds.RelThumbnail, Href: cover},
+		)
+	}
+	switch {
+	case book.Description != "":
+		entry.Content = &opds.Content{Type: "text", Text: book.Description}
+	case book.GutenbergId > 0:
+		entry.Content = &opds.Content{Type: "text", Text: fmt.Sprintf("Project Gutenberg #%d", book.GutenbergId)}
+	}
+	return entry
+}
+
+// acquisitionFeed writes books as an acquisition feed
+func acquisitionFeed(c *gin.Context, id, title string, books []models.Book) {
+	feed := opds.NewFeed(id, title, c.Request.URL.RequestURI(), opds.AcquisitionType, opdsRoot, opdsSearch, latestUpdate(books))
+	feed.Links = append(feed.Links, opds.Link{Rel: opds.RelUp, Href: opdsRoot, Type: opds.NavigationType})
+	feed.Entries = []opds.Entry{}
+	for _, book := range books {
+		feed.Entries = append(feed.Entries, bookEntry(book))
+	}
+	opds.Respond(c, opds.AcquisitionType, feed)
+}
+
+// libraryBooks lists the library, writing an error response on failure
+func (l *Library) libraryBooks(c *gin.Context) ([]models.Book, bool) {
+	books, err := l.Store.List()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Error fetching library: %v", err)})
+		return nil, false
+	}
+	return books, true
+}
+
+// OPDSRoot is the start of the catalog, linking to the navigation and acquisition feeds
+func (l *Library) OPDSRoot(c *gin.Context) {
+	books, ok := l.libraryBooks(c)
+	if !ok {
+		return
+	}
+	updated := latestUpdate(books)
+	feed := opds.NewFeed("urn:firelink:opds", "firelink library", opdsRoot, opds.NavigationType, opdsRoot, opdsSearch, updated)
+	recent := opds.NavigationEntry("urn:firelink:opds:recent", "Recently added", opdsRecent, opds.AcquisitionType, "The newest books in the library", updated)
+	recent.Links[0].Rel = opds.RelNew
+	feed.Entries = []opds.Entry{
+		recent,
+		opds.NavigationEntry("urn:firelink:opds:authors", "By author", opdsAuthors, opds.NavigationType, "Browse books by author", updated),
+		opds.NavigationEntry("urn:firelink:opds:subjects", "By subject", opdsSubjects, opds.NavigationType, "Browse books by subject", updated),
+		opds.NavigationEntry("urn:firelink:opds:all", "All books", opdsAll, opds.AcquisitionType, fmt.Sprintf("%d books", len(books)), updated),
+	}
+	opds.Respond(c, opds.NavigationType, feed)
+}
+
+// OPDSRecent lists the most recently added books
+func (l *Library) OPDSRecent(c *gin.Context) {
+	books, ok := l.libraryBooks(c)
+	if !ok {
+		return
+	}
+	sort.SliceStable(books, func(i, j int) bool { return books[i].CreatedAt.After(books[j].CreatedAt) })
+	if len(books) > opdsRecentSize {
+		books = books[:opdsRecentSize]
+	}
+	acquisitionFeed(c, "urn:firelink:opds:recent", "Recently added", books)
+}
+
+// OPDSAll lists every book in the library
+func (l *Library) OPDSAll(c *gin.Context) {
+	books, ok := l.libraryBooks(c)
+	if !ok {
+		return
+	}
+	acquisitionFeed(c, "urn:firelink:opds:all", "All books", books)
+}
+
+// groupNavigation writes a navigation feed with one entry per group, linking to
+// path?name=<group> for the books in it
+func groupNavigation(c *gin.Context, id, title, path string, groups map[string][]models.Book) {
+	names := make([]string, 0, len(groups))
+	for name := range groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var all []models.Book
+	for _, books := range groups {
+		all = append(all, books...)
+	}
+	feed := opds.NewFeed(id, title, path, opds.NavigationType, opdsRoot, opdsSearch, latestUpdate(all))
+	feed.Links = append(feed.Links, opds.Link{Rel: opds.RelUp, Href: opdsRoot, Type: opds.NavigationType})
+	feed.Entries = []opds.Entry{}
+	for _, name := range names {
+		books := groups[name]
+		feed.Entries = append(feed.Entries, opds.NavigationEntry(
+			id+":"+url.QueryEscape(name),
+			name,
+			path+"?name="+url.QueryEscape(name),
+			opds.AcquisitionType,
+			fmt.Sprintf("%d books", len(books)),
+			latestUpdate(books),
+		))
+	}
+	opds.Respond(c, opds.NavigationType, feed)
+}
+
+// OPDSAuthors lists the authors in the library, or the books of ?name=
+func (l *Library) OPDSAuthors(c *gin.Context) {
+	books, ok := l.libraryBooks(c)
+	if !ok {
+		return
+	}
+	groups := map[string][]models.Book{}
+	for _, book := range books {
+		author := book.Author
+		if author == "" {
+			author = "Unknown"
+		}
+		groups[author] = append(groups[author], book)
+	}
+
+	if name := c.Query("name"); name != "" {
+		acquisitionFeed(c, "urn:firelink:opds:authors:"+url.QueryEscape(name), name, groups[name])
+		return
+	}
+	groupNavigation(c, "urn:firelink:opds:authors", "By author", opdsAuthors, groups)
+}
+
+// OPDSSubjects lists the subjects in the library, or the books of ?name=
+func (l *Library) OPDSSubjects(c *gin.Context) {
+	books, ok := l.libraryBooks(c)
+	if !ok {
+		return
+	}
+	groups := map[string][]models.Book{}
+	for _, book := range books {
+		for _, subject := range subjectList(book) {
+			groups[subject] = append(groups[subject], book)
+		}
+	}
+
+	if name := c.Query("name"); name != "" {
+		acquisitionFeed(c, "urn:firelink:opds:subjects:"+url.QueryEscape(name), name, groups[name])
+		return
+	}
+	groupNavigation(c, "urn:firelink:opds:subjects", "By subject", opdsSubjects, groups)
+}
+
+// OPDSSearch returns the library books matching ?q= as an acquisition feed
+func (l *Library) OPDSSearch(c *gin.Context) {
+	query := strings.TrimSpace(c.Query("q"))
+	if query == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing search query"})
+		return
+	}
+	books, err := l.Store.Search(query)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Error searching library: %v", err)})
+		return
+	}
+	acquisitionFeed(c, "urn:firelink:opds:search:"+url.QueryEscape(query), fmt.Sprintf("Search: %s", query), books)
+}
+
+// OPDSOpenSearch describes the catalog search for e-reader apps
+func (l *Library) OPDSOpenSearch(c *gin.Context) {
+	opds.Respond(c, opds.OpenSearchType, opds.NewOpenSearch(
+		"firelink",
+		"Search the firelink library by title, author or subject",
+		"/opds/search?q={searchTerms}",
+	))
+}
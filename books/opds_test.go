@@ -0,0 +1,106 @@
+package books
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rjhoppe/firelink/models"
+	"github.com/rjhoppe/firelink/opds"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newOPDSLibrary(t *testing.T) *Library {
+	store := &MemoryBooks{}
+	added := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, book := range []models.Book{
+		{Title: "Emma", Author: "Austen, Jane", Subjects: "England -- Fiction; Love stories", Format: "epub"},
+		{Title: "Persuasion", Author: "Austen, Jane", Subjects: "Love stories", Format: "epub"},
+		{Title: "Dracula", Author: "Stoker, Bram", Subjects: "Vampires -- Fiction", Format: "mobi"},
+	} {
+		book.CreatedAt = added.AddDate(0, 0, i)
+		book.UpdatedAt = book.CreatedAt
+		require.NoError(t, store.Save(&book))
+	}
+	return &Library{Store: store}
+}
+
+func opdsRequest(target string, handle func(c *gin.Context)) (*httptest.ResponseRecorder, opds.Feed) {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("GET", target, nil)
+	handle(c)
+
+	var feed opds.Feed
+	xml.Unmarshal(w.Body.Bytes(), &feed)
+	return w, feed
+}
+
+func entryTitles(feed opds.Feed) []string {
+	var titles []string
+	for _, entry := range feed.Entries {
+		titles = append(titles, entry.Title)
+	}
+	return titles
+}
+
+func TestOPDSRoot(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	library := newOPDSLibrary(t)
+
+	w, feed := opdsRequest("/opds", library.OPDSRoot)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, opds.NavigationType+";charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Equal(t, []string{"Recently added", "By author", "By subject", "All books"}, entryTitles(feed))
+	assert.Equal(t, opds.RelNew, feed.Entries[0].Links[0].Rel)
+	assert.Equal(t, "2026-01-03T00:00:00Z", feed.Updated)
+}
+
+func TestOPDSRecent(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	library := newOPDSLibrary(t)
+
+	w, feed := opdsRequest("/opds/recent", library.OPDSRecent)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []string{"Dracula", "Persuasion", "Emma"}, entryTitles(feed))
+
+	dracula := feed.Entries[0]
+	require.Len(t, dracula.Links, 1)
+	assert.Equal(t, opds.RelAcquisition, dracula.Links[0].Rel)
+	assert.Equal(t, "/ebook/library/3/file", dracula.Links[0].Href)
+	assert.Equal(t, "application/x-mobipocket-ebook", dracula.Links[0].Type)
+	assert.Equal(t, "Stoker, Bram", dracula.Authors[0].Name)
+}
+
+func TestOPDSAuthorsAndSubjects(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	library := newOPDSLibrary(t)
+
+	_, feed := opdsRequest("/opds/authors", library.OPDSAuthors)
+	assert.Equal(t, []string{"Austen, Jane", "Stoker, Bram"}, entryTitles(feed))
+	assert.Equal(t, "/opds/authors?name=Austen%2C+Jane", feed.Entries[0].Links[0].Href)
+
+	_, feed = opdsRequest("/opds/authors?name=Austen%2C+Jane", library.OPDSAuthors)
+	assert.Equal(t, []string{"Emma", "Persuasion"}, entryTitles(feed))
+
+	_, feed = opdsRequest("/opds/subjects", library.OPDSSubjects)
+	assert.Equal(t, []string{"England -- Fiction", "Love stories", "Vampires -- Fiction"}, entryTitles(feed))
+
+	_, feed = opdsRequest("/opds/subjects?name=Love+stories", library.OPDSSubjects)
+	assert.Equal(t, []string{"Emma", "Persuasion"}, entryTitles(feed))
+}
+
+func TestOPDSSearch(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	library := newOPDSLibrary(t)
+
+	_, feed := opdsRequest("/opds/search?q=vampire", library.OPDSSearch)
+	assert.Equal(t, []string{"Dracula"}, entryTitles(feed))
+
+	w, _ := opdsRequest("/opds/search", library.OPDSSearch)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -0,0 +1,375 @@
+package books
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rjhoppe/firelink/database"
+	"github.com/rjhoppe/firelink/models"
+	"github.com/rjhoppe/firelink/ntfy"
+	"github.com/rjhoppe/firelink/utils"
+	"gorm.io/gorm"
+)
+
+// ErrNoPassageBook is returned when no reading list book has a plain-text copy to send from
+var ErrNoPassageBook = errors.New("no reading list book with a downloaded txt copy")
+
+// sentenceSlack is how many extra words a passage may run on to finish its sentence
+const sentenceSlack = 60
+
+// PassageStore persists the state of daily passages
+type PassageStore interface {
+	Load() (*models.PassageState, error)
+	Save(state *models.PassageState) error
+}
+
+// DBPassages is a PassageStore backed by the database
+type DBPassages struct{}
+
+func (s *DBPassages) Load() (*models.PassageState, error) {
+	var state models.PassageState
+	err := database.GetDB().First(&state).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &models.PassageState{}, nil
+	}
+	return &state, err
+}
+
+func (s *DBPassages) Save(state *models.PassageState) error {
+	return database.GetDB().Save(state).Error
+}
+
+// Passages sends the next few hundred words of a reading list book every morning,
+// like a serialized novel
+type Passages struct {
+	Library  *Library
+	Reading  ReadingStore
+	State    PassageStore
+	Notifier ntfy.Notifier
+	Words    int    // words per passage
+	At       string // local time passages are sent, as "15:04"
+}
+
+// PassageWords returns the passage length from PASSAGE_WORDS (default 300)
+func PassageWords() int {
+	return utils.GetEnvInt("PASSAGE_WORDS", 300)
+}
+
+// PassageTime returns when passages are sent from PASSAGE_TIME (default "07:00")
+func PassageTime() string {
+	if at := os.Getenv("PASSAGE_TIME"); at != "" {
+		return at
+	}
+	return "07:00"
+}
+
+// textBounds returns where the body of a Gutenberg text starts and ends, leaving out
+// the license header and footer
+func textBounds(text string) (int, int) {
+	start, end := 0, len(text)
+	if i := strings.Index(text, "*** START OF"); i >= 0 {
+		if eol := strings.IndexByte(text[i:], '\n'); eol >= 0 {
+			start = i + eol + 1
+		}
+	}
+	if i := strings.Index(text, "*** END OF"); i >= start {
+		end = i
+	}
+	return start, end
+}
+
+// nextPassage cuts about words words from text starting at offset, running on to the end
+// of the sentence when it is close. It returns the passage and the offset after it.
+func nextPassage(text string, offset, words int) (string, int) {
+	start, end := textBounds(text)
+	offset = max(offset, start)
+	if offset >= end {
+		return "", end
+	}
+
+	count := 0
+	inWord := false
+	cut := end
+	for i, r := range text[offset:end] {
+		pos := offset + i
+		if unicode.IsSpace(r) {
+			if inWord {
+				count++
+				inWord = false
+				previous, _ := utf8.DecodeLastRuneInString(text[:pos])
+				if count >= words+sentenceSlack || (count >= words && strings.ContainsRune(".!?\"”", previous)) {
+					cut = pos
+					break
+				}
+			}
+			continue
+		}
+		inWord = true
+	}
+
+	passage := strings.Join(strings.Fields(text[offset:cut]), " ")
+	return passage, cut
+}
+
+// entryBook returns the plain-text library copy of a reading list entry
+func (p *Passages) entryBook(entry *models.ReadingEntry) (*models.Book, error) {
+	if entry.GutenbergId == nil {
+		return nil, ErrBookNotFound
+	}
+	return p.Library.Store.FindDownload(*entry.GutenbergId, "txt")
+}
+
+// pickEntry chooses the book passages come from: the current one, otherwise the first
+// book being read, otherwise the first book wanted, that has a txt copy in the library
+func (p *Passages) pickEntry(state *models.PassageState) (*models.ReadingEntry, *models.Book, error) {
+	if state.EntryId != 0 {
+		entry, err := p.Reading.Get(state.EntryId)
+		if err == nil && entry.Status != models.ReadingFinished {
+			if book, err := p.entryBook(entry); err == nil {
+				return entry, book, nil
+			}
+		}
+	}
+
+	for _, status := range []string{models.ReadingReading, models.ReadingWantToRead} {
+		entries, err := p.Reading.List(status)
+		if err != nil {
+			return nil, nil, err
+		}
+		for i := range entries {
+			if book, err := p.entryBook(&entries[i]); err == nil {
+				state.EntryId = entries[i].ID
+				return &entries[i], book, nil
+			}
+		}
+	}
+	return nil, nil, ErrNoPassageBook
+}
+
+// advance moves to the next passage, sending it when send is set. It returns the
+// passage and the book's progress in percent.
+func (p *Passages) advance(ctx context.Context, send bool) (string, int, *models.ReadingEntry, error) {
+	state, err := p.State.Load()
+	if err != nil {
+		return "", 0, nil, err
+	}
+	entry, book, err := p.pickEntry(state)
+	if err != nil {
+		return "", 0, nil, err
+	}
+	data, err := os.ReadFile(filepath.Join(p.Library.Dir, filepath.Base(book.FileName)))
+	if err != nil {
+		return "", 0, nil, fmt.Errorf("could not read %s: %w", book.FileName, err)
+	}
+
+	text := string(data)
+	passage, offset := nextPassage(text, entry.PassageOffset, p.Words)
+	start, end := textBounds(text)
+	percent := 100
+	if end > start {
+		percent = min(100, (offset-start)*100/(end-start))
+	}
+
+	if send && passage != "" {
+		if err := ntfy.NtfyPassage(ctx, entry.Title, percent, passage, p.Notifier); err != nil {
+			return "", 0, nil, err
+		}
+		now := time.Now()
+		state.LastSentAt = &now
+	}
+
+	// Progress follows the passages, and reaching the end finishes the book
+	now := time.Now()
+	entry.PassageOffset = offset
+	if percent > entry.Progress || offset >= end {
+		progress := percent
+		applyProgress(entry, models.ReadingProgressRequest{Progress: &progress}, now)
+	}
+	if err := p.Reading.Save(entry); err != nil {
+		return "", 0, nil, err
+	}
+	if entry.Status == models.ReadingFinished {
+		state.EntryId = 0
+	}
+	if err := p.State.Save(state); err != nil {
+		return "", 0, nil, err
+	}
+	return passage, percent, entry, nil
+}
+
+// Send sends the next passage unless passages are paused
+func (p *Passages) Send(ctx context.Context) error {
+	state, err := p.State.Load()
+	if err != nil {
+		return err
+	}
+	if state.Paused {
+		return nil
+	}
+	_, _, _, err = p.advance(ctx, true)
+	return err
+}
+
+// nextRun returns the next time passages are due after now
+func nextRun(at string, now time.Time) (time.Time, error) {
+	clock, err := time.Parse("15:04", at)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid passage time %q, use HH:MM", at)
+	}
+	next := time.Date(now.Year(), now.Month(), now.Day(), clock.Hour(), clock.Minute(), 0, 0, now.Location())
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next, nil
+}
+
+// Run sends a passage every day at p.At until ctx is done
+func (p *Passages) Run(ctx context.Context) {
+	for {
+		next, err := nextRun(p.At, time.Now())
+		if err != nil {
+			log.Printf("WARNING - daily passages disabled: %v", err)
+			return
+		}
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		p.sendScheduled(ctx)
+	}
+}
+
+// sendScheduled sends the daily passage. It runs outside gin's recovery, so a panic is
+// logged rather than allowed to take the server down.
+func (p *Passages) sendScheduled(ctx context.Context) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Daily passage panicked: %v", r)
+		}
+	}()
+	if err := p.Send(ctx); err != nil && !errors.Is(err, ErrNoPassageBook) {
+		log.Printf("Could not send daily passage: %v", err)
+	}
+}
+
+// respondPassageError maps passage errors to responses
+func respondPassageError(c *gin.Context, err error) {
+	if errors.Is(err, ErrNoPassageBook) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Add a book with a downloaded txt copy to the reading list first"})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Error with daily passage: %v", err)})
+}
+
+// GetPassageState returns the book passages come from, how far along it is and when the next one is due
+func (p *Passages) GetPassageState(c *gin.Context) {
+	state, err := p.State.Load()
+	if err != nil {
+		respondPassageError(c, err)
+		return
+	}
+	response := gin.H{"paused": state.Paused, "last_sent_at": state.LastSentAt, "words": p.Words}
+	if next, err := nextRun(p.At, time.Now()); err == nil && !state.Paused {
+		response["next_at"] = next
+	}
+	if entry, _, err := p.pickEntry(state); err == nil {
+		response["entry"] = entry
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// setPaused pauses or resumes daily passages
+func (p *Passages) setPaused(c *gin.Context, paused bool) {
+	state, err := p.State.Load()
+	if err == nil {
+		state.Paused = paused
+		err = p.State.Save(state)
+	}
+	if err != nil {
+		respondPassageError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"paused": paused})
+}
+
+// PausePassages stops daily passages until they are resumed
+func (p *Passages) PausePassages(c *gin.Context) {
+	p.setPaused(c, true)
+}
+
+// ResumePassages starts daily passages again
+func (p *Passages) ResumePassages(c *gin.Context) {
+	p.setPaused(c, false)
+}
+
+// SkipPassage moves past the next passage without sending it
+func (p *Passages) SkipPassage(c *gin.Context) {
+	passage, percent, entry, err := p.advance(utils.RequestContext(c), false)
+	if err != nil {
+		respondPassageError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"skipped": passage, "progress": percent, "entry": entry})
+}
+
+// SendPassage sends the next passage now, even while paused
+func (p *Passages) SendPassage(c *gin.Context) {
+	passage, percent, entry, err := p.advance(utils.RequestContext(c), true)
+	if err != nil {
+		respondPassageError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"passage": passage, "progress": percent, "entry": entry})
+}
+
+// SetPassageBook changes which reading list book passages come from. Each book
+// remembers its own position, so switching back continues where it stopped.
+func (p *Passages) SetPassageBook(c *gin.Context) {
+	var req models.PassageBookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	entry, err := p.Reading.Get(req.EntryId)
+	if errors.Is(err, ErrEntryNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Reading list entry not found"})
+		return
+	}
+	if err != nil {
+		respondPassageError(c, err)
+		return
+	}
+	if entry.Status == models.ReadingFinished {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("%s is already finished", entry.Title)})
+		return
+	}
+	if _, err := p.entryBook(entry); err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Download a txt copy of %s first", entry.Title)})
+		return
+	}
+
+	state, err := p.State.Load()
+	if err == nil {
+		state.EntryId = entry.ID
+		err = p.State.Save(state)
+	}
+	if err != nil {
+		respondPassageError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"entry": entry})
+}
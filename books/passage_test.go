@@ -0,0 +1,169 @@
+package books
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rjhoppe/firelink/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// MemoryPassages is an in-memory PassageStore
+type MemoryPassages struct {
+	state models.PassageState
+}
+
+func (s *MemoryPassages) Load() (*models.PassageState, error) {
+	state := s.state
+	return &state, nil
+}
+
+func (s *MemoryPassages) Save(state *models.PassageState) error {
+	s.state = *state
+	return nil
+}
+
+const gutenbergText = `The Project Gutenberg eBook of Tiny Tales
+*** START OF THE PROJECT GUTENBERG EBOOK TINY TALES ***
+
+One two three four five. Six seven
+eight nine ten eleven twelve. Thirteen fourteen.
+*** END OF THE PROJECT GUTENBERG EBOOK TINY TALES ***
+License text that should never be sent.
+`
+
+func newTestPassages(t *testing.T) (*Passages, *MockNotifier, *MemoryReading) {
+	library := &Library{Dir: t.TempDir(), Store: &MemoryBooks{}}
+	require.NoError(t, os.WriteFile(filepath.Join(library.Dir, "7-tiny-tales.txt"), []byte(gutenbergText), 0644))
+	require.NoError(t, library.Store.Save(&models.Book{GutenbergId: 7, Title: "Tiny Tales", Format: "txt", FileName: "7-tiny-tales.txt"}))
+
+	reading := &MemoryReading{}
+	// A manual entry without a Gutenberg copy is passed over
+	require.NoError(t, reading.Save(&models.ReadingEntry{Title: "Paper Book", Status: models.ReadingReading}))
+	require.NoError(t, reading.Save(&models.ReadingEntry{GutenbergId: intPtr(7), Title: "Tiny Tales", Status: models.ReadingWantToRead}))
+
+	notifier := &MockNotifier{}
+	return &Passages{
+		Library:  library,
+		Reading:  reading,
+		State:    &MemoryPassages{},
+		Notifier: notifier,
+		Words:    4,
+		At:       "07:00",
+	}, notifier, reading
+}
+
+func TestNextPassage(t *testing.T) {
+	passage, offset := nextPassage(gutenbergText, 0, 4)
+	// Runs on to finish the sentence and joins hard-wrapped lines
+	assert.Equal(t, "One two three four five.", passage)
+
+	passage, offset = nextPassage(gutenbergText, offset, 4)
+	assert.Equal(t, "Six seven eight nine ten eleven twelve.", passage)
+
+	passage, offset = nextPassage(gutenbergText, offset, 4)
+	assert.Equal(t, "Thirteen fourteen.", passage)
+
+	passage, _ = nextPassage(gutenbergText, offset, 4)
+	assert.Empty(t, passage)
+}
+
+func TestPassages_SendUntilFinished(t *testing.T) {
+	passages, notifier, reading := newTestPassages(t)
+
+	require.NoError(t, passages.Send(context.Background()))
+	assert.Equal(t, "📖 Daily Passage", notifier.SentTitle)
+	assert.True(t, strings.HasPrefix(notifier.SentMessage, "Tiny Tales ("))
+	assert.True(t, strings.HasSuffix(notifier.SentMessage, "One two three four five."))
+
+	entry, _ := reading.Get(2)
+	assert.Equal(t, models.ReadingReading, entry.Status)
+	assert.Greater(t, entry.Progress, 0)
+
+	require.NoError(t, passages.Send(context.Background()))
+	require.NoError(t, passages.Send(context.Background()))
+	assert.True(t, strings.HasSuffix(notifier.SentMessage, "Thirteen fourteen."))
+	assert.NotContains(t, notifier.SentMessage, "License")
+
+	entry, _ = reading.Get(2)
+	assert.Equal(t, models.ReadingFinished, entry.Status)
+	assert.Equal(t, 100, entry.Progress)
+
+	// Nothing is left to send from
+	assert.ErrorIs(t, passages.Send(context.Background()), ErrNoPassageBook)
+}
+
+func TestPassages_PauseAndSkip(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	passages, notifier, reading := newTestPassages(t)
+
+	call := func(handle func(c *gin.Context), body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("POST", "/ebook/passage", bytes.NewBufferString(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		handle(c)
+		return w
+	}
+
+	require.Equal(t, http.StatusOK, call(passages.PausePassages, "").Code)
+	require.NoError(t, passages.Send(context.Background()))
+	assert.Empty(t, notifier.SentMessage)
+
+	w := call(passages.SkipPassage, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "One two three four five.")
+	assert.Empty(t, notifier.SentMessage)
+
+	require.Equal(t, http.StatusOK, call(passages.ResumePassages, "").Code)
+	require.NoError(t, passages.Send(context.Background()))
+	assert.True(t, strings.HasSuffix(notifier.SentMessage, "Six seven eight nine ten eleven twelve."))
+
+	// Switching to a book without a txt copy is refused
+	assert.Equal(t, http.StatusConflict, call(passages.SetPassageBook, `{"entry_id": 1}`).Code)
+	assert.Equal(t, http.StatusOK, call(passages.SetPassageBook, `{"entry_id": 2}`).Code)
+	entry, _ := reading.Get(2)
+	assert.NotZero(t, entry.PassageOffset)
+}
+
+func TestNextRun(t *testing.T) {
+	now := time.Date(2026, 10, 19, 8, 30, 0, 0, time.Local)
+	next, err := nextRun("07:00", now)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2026, 10, 20, 7, 0, 0, 0, time.Local), next)
+
+	next, err = nextRun("21:15", now)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2026, 10, 19, 21, 15, 0, 0, time.Local), next)
+
+	_, err = nextRun("7am", now)
+	assert.Error(t, err)
+}
+
+// panickingPassages stands in for a store whose database is gone
+type panickingPassages struct{}
+
+func (panickingPassages) Load() (*models.PassageState, error) {
+	panic("nil database")
+}
+
+func (panickingPassages) Save(state *models.PassageState) error {
+	panic("nil database")
+}
+
+func TestPassages_ScheduledSendRecovers(t *testing.T) {
+	passages, notifier, _ := newTestPassages(t)
+	passages.State = panickingPassages{}
+
+	assert.NotPanics(t, func() { passages.sendScheduled(context.Background()) })
+	assert.Empty(t, notifier.SentMessage)
+}
@@ -0,0 +1,287 @@
+package books
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rjhoppe/firelink/database"
+	"github.com/rjhoppe/firelink/gutendex"
+	"github.com/rjhoppe/firelink/models"
+	"github.com/rjhoppe/firelink/utils"
+	"gorm.io/gorm"
+)
+
+// ErrEntryNotFound is returned by a ReadingStore when no entry matches
+var ErrEntryNotFound = errors.New("reading list entry not found")
+
+// ReadingStore persists the reading list
+type ReadingStore interface {
+	Save(entry *models.ReadingEntry) error
+	List(status string) ([]models.ReadingEntry, error)
+	Get(id uint) (*models.ReadingEntry, error)
+	Delete(id uint) error
+	// FinishedBetween returns the entries finished in [from, to)
+	FinishedBetween(from, to time.Time) ([]models.ReadingEntry, error)
+}
+
+// DBReading is a ReadingStore backed by the database
+type DBReading struct{}
+
+func (s *DBReading) Save(entry *models.ReadingEntry) error {
+	return database.GetDB().Save(entry).Error
+}
+
+func (s *DBReading) List(status string) ([]models.ReadingEntry, error) {
+	var entries []models.ReadingEntry
+	query := database.GetDB().Order("updated_at DESC")
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	err := query.Find(&entries).Error
+	return entries, err
+}
+
+func (s *DBReading) Get(id uint) (*models.ReadingEntry, error) {
+	var entry models.ReadingEntry
+	err := database.GetDB().First(&entry, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrEntryNotFound
+	}
+	return &entry, err
+}
+
+func (s *DBReading) Delete(id uint) error {
+	result := database.GetDB().Delete(&models.ReadingEntry{}, id)
+	if result.Error == nil && result.RowsAffected == 0 {
+		return ErrEntryNotFound
+	}
+	return result.Error
+}
+
+func (s *DBReading) FinishedBetween(from, to time.Time) ([]models.ReadingEntry, error) {
+	var entries []models.ReadingEntry
+	err := database.GetDB().
+		Where("status = ? AND finished_at >= ? AND finished_at < ?", models.ReadingFinished, from, to).
+		Order("finished_at").
+		Find(&entries).Error
+	return entries, err
+}
+
+// ReadingList tracks what is being read, how far along it is and what was finished
+type ReadingList struct {
+	Store    ReadingStore
+	Gutendex *gutendex.Client
+}
+
+// setStatus moves an entry to a new state, stamping start and finish dates
+func setStatus(entry *models.ReadingEntry, status string, now time.Time) {
+	entry.Status = status
+	switch status {
+	case models.ReadingWantToRead:
+		entry.Progress = 0
+		entry.StartedAt, entry.FinishedAt = nil, nil
+	case models.ReadingReading:
+		if entry.StartedAt == nil {
+			entry.StartedAt = &now
+		}
+		entry.FinishedAt = nil
+	case models.ReadingFinished:
+		if entry.StartedAt == nil {
+			entry.StartedAt = &now
+		}
+		if entry.FinishedAt == nil {
+			entry.FinishedAt = &now
+		}
+		entry.Progress = 100
+	}
+}
+
+// applyProgress updates an entry from a progress request. Progress moves an unstarted
+// book to reading and reaching 100% finishes it, unless a status is given explicitly.
+func applyProgress(entry *models.ReadingEntry, req models.ReadingProgressRequest, now time.Time) {
+	if req.Pages != nil {
+		entry.Pages = *req.Pages
+	}
+	if req.Words != nil {
+		entry.Words = *req.Words
+	}
+	if req.Rating != nil {
+		entry.Rating = req.Rating
+	}
+
+	if req.Status != nil {
+		setStatus(entry, *req.Status, now)
+	}
+	if req.Progress == nil {
+		return
+	}
+	entry.Progress = *req.Progress
+	if req.Status != nil {
+		return
+	}
+	switch {
+	case entry.Progress == 100:
+		setStatus(entry, models.ReadingFinished, now)
+	case entry.Progress > 0 && entry.Status != models.ReadingReading:
+		setStatus(entry, models.ReadingReading, now)
+	}
+}
+
+// AddEntry adds a Gutenberg book or a manual entry to the reading list
+func (r *ReadingList) AddEntry(c *gin.Context) {
+	var req models.ReadingEntryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	entry := models.ReadingEntry{
+		GutenbergId: req.GutenbergId,
+		Title:       req.Title,
+		Author:      req.Author,
+		Pages:       req.Pages,
+		Words:       req.Words,
+	}
+	if entry.Title == "" && r.Gutendex != nil {
+		book, err := r.Gutendex.Book(utils.RequestContext(c), *req.GutenbergId)
+		if err != nil {
+			c.JSON(http.StatusBadGateway, gin.H{"error": fmt.Sprintf("Error fetching book: %v", err)})
+			return
+		}
+		entry.Title = book.Title
+		if entry.Author == "" {
+			entry.Author = authorName(book)
+		}
+	}
+
+	status := req.Status
+	if status == "" {
+		status = models.ReadingWantToRead
+	}
+	setStatus(&entry, status, time.Now())
+
+	if err := r.Store.Save(&entry); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Error saving entry: %v", err)})
+		return
+	}
+	c.JSON(http.StatusCreated, entry)
+}
+
+// GetEntries lists the reading list, optionally filtered by ?status=
+func (r *ReadingList) GetEntries(c *gin.Context) {
+	entries, err := r.Store.List(c.Query("status"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Error fetching reading list: %v", err)})
+		return
+	}
+	if entries == nil {
+		entries = []models.ReadingEntry{}
+	}
+	c.JSON(http.StatusOK, entries)
+}
+
+// findEntry looks up a reading list entry by its database id
+func (r *ReadingList) findEntry(c *gin.Context, entryId string) (*models.ReadingEntry, bool) {
+	id, err := strconv.ParseUint(entryId, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid entry ID"})
+		return nil, false
+	}
+	entry, err := r.Store.Get(uint(id))
+	if errors.Is(err, ErrEntryNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Reading list entry not found"})
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Error fetching entry: %v", err)})
+		return nil, false
+	}
+	return entry, true
+}
+
+// UpdateProgress changes the status, percent progress or rating of an entry
+func (r *ReadingList) UpdateProgress(c *gin.Context, entryId string) {
+	var req models.ReadingProgressRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	entry, ok := r.findEntry(c, entryId)
+	if !ok {
+		return
+	}
+	applyProgress(entry, req, time.Now())
+	if err := r.Store.Save(entry); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Error updating entry: %v", err)})
+		return
+	}
+	c.JSON(http.StatusOK, entry)
+}
+
+// DeleteEntry removes a book from the reading list
+func (r *ReadingList) DeleteEntry(c *gin.Context, entryId string) {
+	entry, ok := r.findEntry(c, entryId)
+	if !ok {
+		return
+	}
+	if err := r.Store.Delete(entry.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Error deleting entry: %v", err)})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": fmt.Sprintf("Removed from reading list: %s", entry.Title)})
+}
+
+// ReadingStats summarises a year of reading
+type ReadingStats struct {
+	Year          int                   `json:"year"`
+	BooksFinished int                   `json:"books_finished"`
+	PagesRead     int                   `json:"pages_read"`
+	WordsRead     int                   `json:"words_read"`
+	AverageRating *float64              `json:"average_rating,omitempty"`
+	Books         []models.ReadingEntry `json:"books"`
+}
+
+// readingStats totals the books finished in a year
+func readingStats(year int, finished []models.ReadingEntry) ReadingStats {
+	stats := ReadingStats{Year: year, BooksFinished: len(finished), Books: finished}
+	if stats.Books == nil {
+		stats.Books = []models.ReadingEntry{}
+	}
+
+	ratings, total := 0, 0
+	for _, entry := range finished {
+		stats.PagesRead += entry.Pages
+		stats.WordsRead += entry.Words
+		if entry.Rating != nil {
+			ratings++
+			total += *entry.Rating
+		}
+	}
+	if ratings > 0 {
+		average := float64(total) / float64(ratings)
+		stats.AverageRating = &average
+	}
+	return stats
+}
+
+// GetStats returns the reading summary of ?year= (default the current year)
+func (r *ReadingList) GetStats(c *gin.Context) {
+	year, err := strconv.Atoi(c.DefaultQuery("year", strconv.Itoa(time.Now().Year())))
+	if err != nil || year < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid year"})
+		return
+	}
+
+	from := time.Date(year, time.January, 1, 0, 0, 0, 0, time.Local)
+	finished, err := r.Store.FinishedBetween(from, from.AddDate(1, 0, 0))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Error fetching reading stats: %v", err)})
+		return
+	}
+	c.JSON(http.StatusOK, readingStats(year, finished))
+}
@@ -0,0 +1,155 @@
+package books
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rjhoppe/firelink/gutendex"
+	"github.com/rjhoppe/firelink/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// MemoryReading is an in-memory ReadingStore
+type MemoryReading struct {
+	entries map[uint]models.ReadingEntry
+	nextId  uint
+}
+
+func (s *MemoryReading) Save(entry *models.ReadingEntry) error {
+	if s.entries == nil {
+		s.entries = map[uint]models.ReadingEntry{}
+	}
+	if entry.ID == 0 {
+		s.nextId++
+		entry.ID = s.nextId
+	}
+	s.entries[entry.ID] = *entry
+	return nil
+}
+
+func (s *MemoryReading) List(status string) ([]models.ReadingEntry, error) {
+	var entries []models.ReadingEntry
+	for _, entry := range s.entries {
+		if status == "" || entry.Status == status {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+func (s *MemoryReading) Get(id uint) (*models.ReadingEntry, error) {
+	entry, ok := s.entries[id]
+	if !ok {
+		return nil, ErrEntryNotFound
+	}
+	return &entry, nil
+}
+
+func (s *MemoryReading) Delete(id uint) error {
+	delete(s.entries, id)
+	return nil
+}
+
+func (s *MemoryReading) FinishedBetween(from, to time.Time) ([]models.ReadingEntry, error) {
+	var entries []models.ReadingEntry
+	for _, entry := range s.entries {
+		if entry.FinishedAt != nil && !entry.FinishedAt.Before(from) && entry.FinishedAt.Before(to) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+func readingRequest(method, body string, handle func(c *gin.Context)) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(method, "/ebook/reading", bytes.NewBufferString(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	handle(c)
+	return w
+}
+
+func intPtr(i int) *int {
+	return &i
+}
+
+func TestApplyProgress(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	entry := models.ReadingEntry{}
+	setStatus(&entry, models.ReadingWantToRead, now)
+
+	applyProgress(&entry, models.ReadingProgressRequest{Progress: intPtr(30)}, now)
+	assert.Equal(t, models.ReadingReading, entry.Status)
+	require.NotNil(t, entry.StartedAt)
+	assert.Equal(t, now, *entry.StartedAt)
+
+	later := now.AddDate(0, 0, 10)
+	applyProgress(&entry, models.ReadingProgressRequest{Progress: intPtr(100), Rating: intPtr(4)}, later)
+	assert.Equal(t, models.ReadingFinished, entry.Status)
+	assert.Equal(t, now, *entry.StartedAt)
+	assert.Equal(t, later, *entry.FinishedAt)
+	assert.Equal(t, 4, *entry.Rating)
+
+	status := models.ReadingWantToRead
+	applyProgress(&entry, models.ReadingProgressRequest{Status: &status}, later)
+	assert.Equal(t, 0, entry.Progress)
+	assert.Nil(t, entry.StartedAt)
+	assert.Nil(t, entry.FinishedAt)
+}
+
+func TestReadingList_AddFromGutenberg(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	downloads := 0
+	server := newGutenbergServer(t, &downloads)
+	list := &ReadingList{Store: &MemoryReading{}, Gutendex: gutendex.NewClient(gutendex.WithBaseURL(server.URL))}
+
+	w := readingRequest("POST", `{"gutenberg_id": 2701, "pages": 635}`, list.AddEntry)
+	require.Equal(t, http.StatusCreated, w.Code)
+	var entry models.ReadingEntry
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &entry))
+	assert.Equal(t, "Moby Dick; Or, The Whale", entry.Title)
+	assert.Equal(t, "Melville, Herman", entry.Author)
+	assert.Equal(t, models.ReadingWantToRead, entry.Status)
+
+	w = readingRequest("POST", `{"author": "Nobody"}`, list.AddEntry)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = readingRequest("PATCH", `{"progress": 140}`, func(c *gin.Context) { list.UpdateProgress(c, "1") })
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestReadingList_Stats(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := &MemoryReading{}
+	list := &ReadingList{Store: store}
+
+	finished := func(title string, at time.Time, pages, words int, rating *int) {
+		entry := models.ReadingEntry{Title: title, Pages: pages, Words: words, Rating: rating}
+		setStatus(&entry, models.ReadingFinished, at)
+		require.NoError(t, store.Save(&entry))
+	}
+	finished("Emma", time.Date(2025, 2, 1, 0, 0, 0, 0, time.Local), 400, 160000, intPtr(5))
+	finished("Persuasion", time.Date(2025, 11, 3, 0, 0, 0, 0, time.Local), 250, 87000, intPtr(4))
+	finished("Dracula", time.Date(2024, 10, 31, 0, 0, 0, 0, time.Local), 420, 160000, nil)
+	require.NoError(t, store.Save(&models.ReadingEntry{Title: "Ulysses", Status: models.ReadingReading, Progress: 10}))
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("GET", "/ebook/reading/stats?year=2025", nil)
+	list.GetStats(c)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	var stats ReadingStats
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &stats))
+	assert.Equal(t, 2, stats.BooksFinished)
+	assert.Equal(t, 650, stats.PagesRead)
+	assert.Equal(t, 247000, stats.WordsRead)
+	require.NotNil(t, stats.AverageRating)
+	assert.Equal(t, 4.5, *stats.AverageRating)
+}
@@ -0,0 +1,71 @@
+package books
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rjhoppe/firelink/gutendex"
+	"github.com/rjhoppe/firelink/utils"
+)
+
+// maxFollowPages bounds how many Next links a single search follows
+const maxFollowPages = 5
+
+// SearchBooks searches Project Gutenberg with ?q=&author=&lang=&topic=&page=.
+// ?pages=N follows up to N Next links and merges their results.
+func SearchBooks(c *gin.Context, client *gutendex.Client) {
+	search := strings.TrimSpace(c.Query("q") + " " + c.Query("author"))
+	query := gutendex.Query{Search: search, Topic: c.Query("topic")}
+	if lang := c.Query("lang"); lang != "" {
+		query.Languages = strings.Split(lang, ",")
+	}
+
+	var err error
+	if query.Page, err = strconv.Atoi(c.DefaultQuery("page", "1")); err != nil || query.Page < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid page"})
+		return
+	}
+	pages, err := strconv.Atoi(c.DefaultQuery("pages", "1"))
+	if err != nil || pages < 1 || pages > maxFollowPages {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("pages must be between 1 and %d", maxFollowPages)})
+		return
+	}
+
+	ctx := utils.RequestContext(c)
+	page, err := client.Search(ctx, query)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": fmt.Sprintf("Error searching books: %v", err)})
+		return
+	}
+
+	results := page.Results
+	last := page
+	for followed := 1; followed < pages && last.Next != nil; followed++ {
+		next, err := client.NextPage(ctx, last)
+		if err != nil {
+			c.JSON(http.StatusBadGateway, gin.H{"error": fmt.Sprintf("Error following next page: %v", err)})
+			return
+		}
+		results = append(results, next.Results...)
+		last = next
+	}
+
+	var nextPage *int
+	if last.Next != nil {
+		n := query.Page + pages
+		nextPage = &n
+	}
+	if results == nil {
+		results = []gutendex.Book{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"count":     page.Count,
+		"page":      query.Page,
+		"next_page": nextPage,
+		"results":   results,
+	})
+}
@@ -0,0 +1,114 @@
+package books
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rjhoppe/firelink/gutendex"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newSearchServer serves three pages of one book each and records the queries it receives.
+// Page 4 and beyond answer with a server error, and when broken is set page 3 links to it.
+func newSearchServer(t *testing.T, queries *[]string, broken bool) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*queries = append(*queries, r.URL.RawQuery)
+		n, err := strconv.Atoi(r.URL.Query().Get("page"))
+		if err != nil {
+			n = 1
+		}
+		if n > 3 {
+			http.Error(w, "boom", http.StatusServiceUnavailable)
+			return
+		}
+		page := gutendex.Page{Count: 3, Results: []gutendex.Book{{ID: n, Title: fmt.Sprintf("Book %d", n)}}}
+		if n < 3 || broken {
+			next := fmt.Sprintf("https://gutendex.com/books/?page=%d", n+1)
+			page.Next = &next
+		}
+		json.NewEncoder(w).Encode(page)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+type searchResponse struct {
+	Count    int             `json:"count"`
+	Page     int             `json:"page"`
+	NextPage *int            `json:"next_page"`
+	Results  []gutendex.Book `json:"results"`
+}
+
+func search(t *testing.T, client *gutendex.Client, query string) (*httptest.ResponseRecorder, searchResponse) {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("GET", "/ebook/search?"+query, nil)
+	SearchBooks(c, client)
+	var response searchResponse
+	if w.Code == http.StatusOK {
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	}
+	return w, response
+}
+
+func TestSearchBooks(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var queries []string
+	client := gutendex.NewClient(gutendex.WithBaseURL(newSearchServer(t, &queries, false).URL))
+
+	// The author is searched alongside the title and more pages are followed on request
+	w, response := search(t, client, "q=moby&author=melville&lang=en,fr&topic=sea&page=2&pages=2")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []string{"languages=en%2Cfr&page=2&search=moby+melville&topic=sea", "page=3"}, queries)
+	assert.Equal(t, 3, response.Count)
+	assert.Equal(t, 2, response.Page)
+	assert.Nil(t, response.NextPage)
+	require.Len(t, response.Results, 2)
+	assert.Equal(t, []int{2, 3}, []int{response.Results[0].ID, response.Results[1].ID})
+
+	// A single page points at the page after it
+	w, response = search(t, client, "q=moby")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NotNil(t, response.NextPage)
+	assert.Equal(t, 2, *response.NextPage)
+	assert.Len(t, response.Results, 1)
+}
+
+func TestSearchBooks_PaginationBounds(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var queries []string
+	client := gutendex.NewClient(gutendex.WithBaseURL(newSearchServer(t, &queries, false).URL))
+
+	for _, query := range []string{"page=0", "page=two", "pages=0", "pages=6", "pages=many"} {
+		w, _ := search(t, client, query)
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
+	// Invalid requests never reach Gutendex
+	assert.Empty(t, queries)
+
+	w, response := search(t, client, "pages=5")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Len(t, response.Results, 3)
+}
+
+func TestSearchBooks_UpstreamErrors(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var queries []string
+	client := gutendex.NewClient(gutendex.WithBaseURL(newSearchServer(t, &queries, false).URL))
+
+	w, _ := search(t, client, "page=4")
+	assert.Equal(t, http.StatusBadGateway, w.Code)
+	assert.Contains(t, w.Body.String(), "Error searching books")
+
+	// Following a Next link that fails is reported the same way
+	client = gutendex.NewClient(gutendex.WithBaseURL(newSearchServer(t, &queries, true).URL))
+	w, _ = search(t, client, "page=3&pages=2")
+	assert.Equal(t, http.StatusBadGateway, w.Code)
+	assert.Contains(t, w.Body.String(), "Error following next page")
+}
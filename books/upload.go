@@ -0,0 +1,137 @@
+package books
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gabriel-vasile/mimetype"
+	"github.com/gin-gonic/gin"
+	"github.com/rjhoppe/firelink/models"
+	"github.com/rjhoppe/firelink/utils"
+)
+
+// uploadFormats maps the detected MIME types accepted by uploads to library formats
+var uploadFormats = map[string]string{
+	"application/epub+zip":           "epub",
+	"application/pdf":                "pdf",
+	"application/x-mobipocket-ebook": "mobi",
+}
+
+// MaxUploadSize returns the largest accepted upload, from FIRELINK_UPLOAD_MAX_MB (default 200)
+func MaxUploadSize() int64 {
+	return int64(utils.GetEnvInt("FIRELINK_UPLOAD_MAX_MB", 200)) << 20
+}
+
+// uploadFileName names an uploaded book after its original file name and checksum,
+// such as "family-recipes-3f2a9c1e.epub"
+func uploadFileName(original, sha, format string) string {
+	base := strings.TrimSuffix(filepath.Base(original), filepath.Ext(original))
+	slug := strings.Trim(nonSlugChars.ReplaceAllString(strings.ToLower(base), "-"), "-")
+	if len(slug) > 60 {
+		slug = strings.TrimRight(slug[:60], "-")
+	}
+	if slug == "" {
+		slug = "upload"
+	}
+	return fmt.Sprintf("%s-%s.%s", slug, sha[:8], format)
+}
+
+// hashFile returns the sha256 checksum of r
+func hashFile(r io.Reader) (string, error) {
+	hash := sha256.New()
+	if _, err := io.Copy(hash, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// UploadBook stores a personal epub, pdf or mobi sent as the multipart "file" field.
+// Optional "title" and "author" fields override the metadata read from the file.
+// Uploading a file already in the library returns the existing book.
+func (l *Library) UploadBook(c *gin.Context) {
+	if l.MaxUploadSize > 0 {
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, l.MaxUploadSize)
+	}
+	header, err := c.FormFile("file")
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("Upload is larger than %d MB", l.MaxUploadSize>>20)})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Missing file: %v", err)})
+		return
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Error reading upload: %v", err)})
+		return
+	}
+	defer file.Close()
+
+	// Trust the file contents rather than the client's file name or content type
+	detected, err := mimetype.DetectReader(file)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Error reading upload: %v", err)})
+		return
+	}
+	format, ok := uploadFormats[detected.String()]
+	if !ok {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": fmt.Sprintf("Unsupported file type %s, upload an epub, pdf or mobi", detected.String())})
+		return
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Error reading upload: %v", err)})
+		return
+	}
+	sha, err := hashFile(file)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Error reading upload: %v", err)})
+		return
+	}
+	existing, err := l.Store.FindByHash(sha)
+	if err == nil {
+		c.JSON(http.StatusOK, existing)
+		return
+	}
+	if !errors.Is(err, ErrBookNotFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Error checking library: %v", err)})
+		return
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Error reading upload: %v", err)})
+		return
+	}
+	record := models.Book{
+		Title:    strings.TrimSpace(c.PostForm("title")),
+		Author:   strings.TrimSpace(c.PostForm("author")),
+		Format:   format,
+		FileName: uploadFileName(header.Filename, sha, format),
+	}
+	if record.Size, record.Sha256, err = l.store(file, record.FileName); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Error storing book: %v", err)})
+		return
+	}
+
+	l.enrich(utils.RequestContext(c), &record, "")
+	if record.Title == "" {
+		record.Title = strings.TrimSuffix(filepath.Base(header.Filename), filepath.Ext(header.Filename))
+	}
+
+	if err := l.Store.Save(&record); err != nil {
+		os.Remove(filepath.Join(l.Dir, record.FileName))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Error saving book: %v", err)})
+		return
+	}
+	c.JSON(http.StatusCreated, record)
+}
@@ -0,0 +1,90 @@
+package books
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rjhoppe/firelink/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func uploadRequest(t *testing.T, library *Library, filename string, data []byte, fields map[string]string) *httptest.ResponseRecorder {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	for key, value := range fields {
+		form.WriteField(key, value)
+	}
+	part, err := form.CreateFormFile("file", filename)
+	require.NoError(t, err)
+	part.Write(data)
+	require.NoError(t, form.Close())
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("POST", "/ebook/upload", &body)
+	c.Request.Header.Set("Content-Type", form.FormDataContentType())
+	library.UploadBook(c)
+	return w
+}
+
+func TestUploadBook_Epub(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	library := &Library{Dir: t.TempDir(), Store: &MemoryBooks{}}
+	data := buildEpub(t)
+
+	w := uploadRequest(t, library, "Pride & Prejudice.epub", data, map[string]string{"title": "P&P"})
+	require.Equal(t, http.StatusCreated, w.Code)
+	var book models.Book
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &book))
+	assert.Equal(t, "epub", book.Format)
+	assert.Equal(t, "P&P", book.Title)
+	assert.Equal(t, "Jane Austen", book.Author)
+	assert.Equal(t, "A novel of manners.", book.Description)
+	assert.Equal(t, "pride-prejudice-"+book.Sha256[:8]+".epub", book.FileName)
+	assert.NotEmpty(t, book.CoverFile)
+
+	stored, err := os.ReadFile(filepath.Join(library.Dir, book.FileName))
+	require.NoError(t, err)
+	assert.Equal(t, data, stored)
+
+	// The same contents under another name are recognised as a duplicate
+	w = uploadRequest(t, library, "copy.epub", data, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	books, _ := library.Store.List()
+	assert.Len(t, books, 1)
+}
+
+func TestUploadBook_Pdf(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	library := &Library{Dir: t.TempDir(), Store: &MemoryBooks{}}
+
+	w := uploadRequest(t, library, "Manual.pdf", []byte("%PDF-1.7\n%fake pdf\n"), nil)
+	require.Equal(t, http.StatusCreated, w.Code)
+	var book models.Book
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &book))
+	assert.Equal(t, "pdf", book.Format)
+	assert.Equal(t, "Manual", book.Title)
+}
+
+func TestUploadBook_Rejected(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	library := &Library{Dir: t.TempDir(), Store: &MemoryBooks{}, MaxUploadSize: 1 << 10}
+
+	// The file name claims epub but the contents are plain text
+	w := uploadRequest(t, library, "notes.epub", []byte("just some notes"), nil)
+	assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+
+	w = uploadRequest(t, library, "big.pdf", append([]byte("%PDF-1.7\n"), make([]byte, 2<<10)...), nil)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+
+	entries, _ := os.ReadDir(library.Dir)
+	assert.Empty(t, entries)
+}
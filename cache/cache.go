@@ -99,6 +99,21 @@ func (c *Cache[T]) GetAll() map[string]T {
 	return allEntries
 }
 
+// Expiries returns when each non-expired cache entry expires.
+func (c *Cache[T]) Expiries() map[string]time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expiries := make(map[string]time.Time)
+	for key, elem := range c.data {
+		entry := elem.Value.(*CacheEntry[T])
+		if time.Now().Before(entry.Expiry) {
+			expiries[key] = entry.Expiry
+		}
+	}
+	return expiries
+}
+
 // BackupCache creates a backup of the cache as a cache.json. file
 func (c *Cache[T]) BackupCache(cacheDir string, data map[string]T) error {
 	filename := "cache.json"
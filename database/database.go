@@ -1,6 +1,7 @@
 package database
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
@@ -37,7 +38,7 @@ func InitDB() {
 	}
 
 	// Migrate the schema
-	DB.AutoMigrate(&models.Dinner{}, &models.Drink{})
+	DB.AutoMigrate(&models.Dinner{}, &models.Drink{}, &models.DinnerHistory{}, &models.Book{}, &models.Device{}, &models.ReadingEntry{}, &models.PassageState{}, &models.Notification{})
 }
 
 func GetDB() *gorm.DB {
@@ -60,13 +61,13 @@ func GetRecord(record interface{}) error {
 	return DB.First(record).Error
 }
 
-func BackupDB(filename string) error {
+func BackupDB(ctx context.Context, filename string) error {
 	user := os.Getenv("POSTGRES_USER")
 	db := os.Getenv("POSTGRES_DB")
 	host := os.Getenv("POSTGRES_HOST")
 	password := os.Getenv("POSTGRES_PASSWORD")
 
-	cmd := exec.Command("pg_dump", "-U", user, "-h", host, db)
+	cmd := exec.CommandContext(ctx, "pg_dump", "-U", user, "-h", host, db)
 	cmd.Env = append(os.Environ(), "PGPASSWORD="+password)
 
 	out, err := cmd.Output()
@@ -81,7 +82,7 @@ func BackupDB(filename string) error {
 		return fmt.Errorf("failed to write backup file: %w", err)
 	}
 
-	ntfy.NtfyDBBackup(fileLoc, ntfy.NewNotifier("system"))
+	ntfy.NtfyDBBackup(ctx, fileLoc, ntfy.NewNotifier("system"))
 
 	return nil
 }
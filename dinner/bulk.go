@@ -0,0 +1,197 @@
+package dinner
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rjhoppe/firelink/cache"
+	"github.com/rjhoppe/firelink/database"
+	"github.com/rjhoppe/firelink/models"
+	"github.com/rjhoppe/firelink/utils"
+)
+
+// maxBulkRecipes bounds the number of ids accepted by GetRecipesBulk
+const maxBulkRecipes = 100
+
+// parseRecipeIds parses a comma-separated list of Spoonacular and "local-" recipe ids,
+// dropping duplicates
+func parseRecipeIds(value string) ([]string, error) {
+	var ids []string
+	seen := map[string]bool{}
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		number, local := localRecipeId(part)
+		id, err := strconv.ParseInt(number, 10, 32)
+		if err != nil || id < 0 {
+			return nil, fmt.Errorf("Invalid recipe ID: %s", part)
+		}
+		key := recipeKey(int32(id), "")
+		if local {
+			key = recipeKey(int32(id), models.SourceLocal)
+		}
+		if !seen[key] {
+			seen[key] = true
+			ids = append(ids, key)
+		}
+	}
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("Missing query parameter ids")
+	}
+	if len(ids) > maxBulkRecipes {
+		return nil, fmt.Errorf("At most %d recipe ids can be requested at once", maxBulkRecipes)
+	}
+	return ids, nil
+}
+
+// savedRecipes loads saved Spoonacular recipes for the given ids in one query
+func savedRecipes(ids []int32) (map[int32]models.RecipeInfo, error) {
+	found := map[int32]models.RecipeInfo{}
+	db := database.GetDB()
+	if db == nil || len(ids) == 0 {
+		return found, nil
+	}
+
+	externalIds := make([]string, len(ids))
+	for i, id := range ids {
+		externalIds[i] = strconv.Itoa(int(id))
+	}
+	var dinners []models.Dinner
+	if err := db.Where("external_id IN ?", externalIds).Find(&dinners).Error; err != nil {
+		return nil, err
+	}
+	for _, dinner := range dinners {
+		id, err := strconv.Atoi(dinner.ExternalId)
+		if err != nil {
+			continue
+		}
+		found[int32(id)] = models.RecipeInfo{
+			Title:        dinner.Title,
+			Id:           int32(id),
+			Url:          dinner.Url,
+			Instructions: dinner.Instructions,
+			Ingredients:  dinner.Ingredients,
+		}
+	}
+	return found, nil
+}
+
+// localRecipes loads locally authored recipes for the given database ids in one query
+func localRecipes(ids []int32) (map[int32]models.RecipeInfo, error) {
+	found := map[int32]models.RecipeInfo{}
+	db := database.GetDB()
+	if db == nil || len(ids) == 0 {
+		return found, nil
+	}
+
+	var dinners []models.Dinner
+	if err := db.Where("id IN ? AND source = ?", ids, models.SourceLocal).Find(&dinners).Error; err != nil {
+		return nil, err
+	}
+	for _, dinner := range dinners {
+		found[int32(dinner.ID)] = localRecipeInfo(dinner)
+	}
+	return found, nil
+}
+
+// storedRecipes resolves recipes from the cache and the database, returning the
+// Spoonacular ids that still have to be fetched
+func storedRecipes(ids []string, cache *cache.Cache[models.RecipeInfo]) (map[string]models.RecipeInfo, []int32, error) {
+	found := map[string]models.RecipeInfo{}
+	var misses, local []int32
+	for _, key := range ids {
+		number, isLocal := localRecipeId(key)
+		id, _ := strconv.Atoi(number)
+		if isLocal {
+			local = append(local, int32(id))
+		} else if recipe, ok := cache.Get(key); ok {
+			found[key] = recipe
+		} else {
+			misses = append(misses, int32(id))
+		}
+	}
+
+	locals, err := localRecipes(local)
+	if err != nil {
+		return nil, nil, err
+	}
+	for id, recipe := range locals {
+		found[recipeKey(id, models.SourceLocal)] = recipe
+	}
+
+	saved, err := savedRecipes(misses)
+	if err != nil {
+		return nil, nil, err
+	}
+	var remaining []int32
+	for _, id := range misses {
+		if recipe, ok := saved[id]; ok {
+			found[strconv.Itoa(int(id))] = recipe
+			cache.Set(strconv.Itoa(int(id)), recipe, recipeTTL)
+		} else {
+			remaining = append(remaining, id)
+		}
+	}
+	return found, remaining, nil
+}
+
+// fetchRecipes fetches recipes from Spoonacular in a single bulk request, adding them to
+// found and the cache
+func fetchRecipes(c *gin.Context, ids []int32, found map[string]models.RecipeInfo, cache *cache.Cache[models.RecipeInfo], apiClient SpoonacularClient) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	results, err := apiClient.GetRecipeInformationBulk(utils.RequestContext(c), ids)
+	if err != nil {
+		return err
+	}
+	for i := range results {
+		recipe := recipeInfoFromApi(&results[i])
+		found[strconv.Itoa(int(recipe.Id))] = recipe
+		cache.Set(strconv.Itoa(int(recipe.Id)), recipe, recipeTTL)
+	}
+	return nil
+}
+
+// GetRecipesBulk returns several recipes at once for ?ids=1,2,local-3, in the order requested.
+// Custom recipes are read from the database, and ids that could not be resolved are listed
+// under "missing".
+func GetRecipesBulk(c *gin.Context, cache *cache.Cache[models.RecipeInfo], apiClient SpoonacularClient) {
+	ids, err := parseRecipeIds(c.Query("ids"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	found, remaining, err := storedRecipes(ids, cache)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Error reading saved recipes: %v", err)})
+		return
+	}
+	err = fetchRecipes(c, remaining, found, cache, apiClient)
+	if err != nil && len(found) == 0 {
+		respondUpstreamError(c, "fetching recipes", err)
+		return
+	}
+
+	recipes := []models.RecipeInfo{}
+	missing := []string{}
+	for _, id := range ids {
+		if recipe, ok := found[id]; ok {
+			recipes = append(recipes, recipe)
+		} else {
+			missing = append(missing, id)
+		}
+	}
+
+	body := gin.H{"recipes": recipes, "missing": missing}
+	if err != nil {
+		body["error"] = err.Error()
+	}
+	c.JSON(http.StatusOK, body)
+}
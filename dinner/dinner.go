@@ -2,8 +2,10 @@ package dinner
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"html"
+	"log"
 	"net/http"
 	"regexp"
 	"strconv"
@@ -13,9 +15,11 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/rjhoppe/firelink/cache"
 	"github.com/rjhoppe/firelink/database"
+	"github.com/rjhoppe/firelink/export"
 	"github.com/rjhoppe/firelink/models"
 	"github.com/rjhoppe/firelink/ntfy"
 	"github.com/rjhoppe/firelink/spoonacularapi"
+	"github.com/rjhoppe/firelink/utils"
 )
 
 // cleanHTMLContent removes HTML tags and decodes HTML entities
@@ -41,55 +45,171 @@ func cleanHTMLContent(content string) string {
 type SpoonacularClient interface {
 	GetRandomRecipes(ctx context.Context, count int) (*spoonacularapi.RandomRecipesResponse, error)
 	GetRecipeInformation(ctx context.Context, id int32) (*spoonacularapi.RecipeInformationOverride, error)
+	SearchRecipes(ctx context.Context, params spoonacularapi.SearchParams) (*spoonacularapi.SearchRecipesResponse, error)
+	GetSimilarRecipes(ctx context.Context, id int32, number int) ([]spoonacularapi.SimilarRecipe, error)
+	AutocompleteRecipeSearch(ctx context.Context, query string, number int) ([]spoonacularapi.AutocompleteResult, error)
+	GetRecipeInformationBulk(ctx context.Context, ids []int32) ([]spoonacularapi.RecipeInformationOverride, error)
 }
 
-func GetRandomRecipes(c *gin.Context, apiClient SpoonacularClient) {
-	result, err := apiClient.GetRandomRecipes(context.Background(), 3)
+// maxRandomCalls bounds how many times /dinner/random asks Spoonacular for fresh recipes
+const maxRandomCalls = 3
+
+// pickFreshRecipes asks for random recipes until three have not been seen within the repeat
+// window. If the call budget runs out, the remaining slots are filled with repeats.
+func pickFreshRecipes(ctx context.Context, apiClient SpoonacularClient, seen map[string]bool) ([]spoonacularapi.Recipe, error) {
+	var candidates []spoonacularapi.Recipe
+	picked := map[int32]bool{}
+	fresh := 0
+
+	for call := 0; call < maxRandomCalls && fresh < 3; call++ {
+		result, err := apiClient.GetRandomRecipes(ctx, 3)
+		if err != nil {
+			return nil, err
+		}
+		for _, recipe := range result.Recipes {
+			if picked[recipe.Id] {
+				continue
+			}
+			picked[recipe.Id] = true
+			candidates = append(candidates, recipe)
+			if !seen[recipeKey(recipe.Id, models.SourceApi)] {
+				fresh++
+			}
+		}
+	}
+	return preferFresh(candidates, seen, 3), nil
+}
+
+// preferFresh returns up to count recipes, taking those not seen within the repeat window
+// first and filling the remaining slots with repeats
+func preferFresh(recipes []spoonacularapi.Recipe, seen map[string]bool, count int) []spoonacularapi.Recipe {
+	var fresh, repeats []spoonacularapi.Recipe
+	for _, recipe := range recipes {
+		if seen[recipeKey(recipe.Id, models.SourceApi)] {
+			repeats = append(repeats, recipe)
+		} else {
+			fresh = append(fresh, recipe)
+		}
+	}
+	recipes = append(fresh, repeats...)
+	if len(recipes) > count {
+		recipes = recipes[:count]
+	}
+	return recipes
+}
+
+// suggestion is a recipe offered by /dinner/random, from Spoonacular or the local recipes
+type suggestion struct {
+	Id     int32
+	Title  string
+	Source string
+}
+
+// mixInLocal builds the three suggestions, giving the last slot to a local recipe when there
+// is one, and more slots when Spoonacular provided fewer than three recipes
+func mixInLocal(recipes []spoonacularapi.Recipe, local []models.Dinner) []suggestion {
+	localSlots := 0
+	if len(local) > 0 {
+		localSlots = min(len(local), max(1, 3-len(recipes)))
+	}
+	var suggestions []suggestion
+	for _, recipe := range recipes[:min(len(recipes), 3-localSlots)] {
+		suggestions = append(suggestions, suggestion{Id: recipe.Id, Title: recipe.Title, Source: models.SourceApi})
+	}
+	for _, recipe := range local[:localSlots] {
+		suggestions = append(suggestions, suggestion{Id: int32(recipe.ID), Title: recipe.Title, Source: models.SourceLocal})
+	}
+	return suggestions
+}
+
+// GetRandomRecipes suggests three recipes not suggested or cooked recently, mixing in the
+// local recipes with Spoonacular's
+func GetRandomRecipes(c *gin.Context, apiClient SpoonacularClient, history HistoryStore) {
+	ctx := utils.RequestContext(c)
+	now := time.Now()
+	seen, err := recentRecipeIds(history, now)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Error reading dinner history: %v", err)})
+		return
+	}
+
+	recipes, err := pickFreshRecipes(ctx, apiClient, seen)
+	if errors.Is(err, spoonacularapi.ErrQuotaExhausted) {
+		// Fall back to saved recipes while the quota is protected
+		recipes, err = randomRecipesFromDB(3, seen)
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Error fetching random recipes: %v", err)})
 		return
 	}
 
-	recipes := result.Recipes
-	if len(recipes) < 3 {
+	suggestions := mixInLocal(recipes, randomLocalRecipes(3, seen))
+	if len(suggestions) < 3 {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Not enough recipes returned"})
 		return
 	}
 
-	for _, recipe := range recipes {
-		ntfy.NtfyRandomRecipes(recipe.Id, recipe.Title, ntfy.NewNotifier("dinner"))
+	if history != nil {
+		var entries []models.DinnerHistory
+		for _, recipe := range suggestions {
+			entries = append(entries, models.DinnerHistory{RecipeId: recipe.Id, Source: recipe.Source, Title: recipe.Title, Event: models.HistorySuggested, At: now})
+		}
+		if err := history.Record(entries...); err != nil {
+			log.Printf("Failed to record dinner history: %v", err)
+		}
+	}
+
+	for _, recipe := range suggestions {
+		ntfy.NtfyRandomRecipes(ctx, recipeKey(recipe.Id, recipe.Source), recipe.Title, ntfy.NewNotifier("dinner"))
 	}
 
 	jsonResp := models.RandomRecipes{
-		RecipeOne:   fmt.Sprintf("%v: %v", recipes[0].Id, recipes[0].Title),
-		RecipeTwo:   fmt.Sprintf("%v: %v", recipes[1].Id, recipes[1].Title),
-		RecipeThree: fmt.Sprintf("%v: %v", recipes[2].Id, recipes[2].Title),
+		RecipeOne:   fmt.Sprintf("%v: %v", recipeKey(suggestions[0].Id, suggestions[0].Source), suggestions[0].Title),
+		RecipeTwo:   fmt.Sprintf("%v: %v", recipeKey(suggestions[1].Id, suggestions[1].Source), suggestions[1].Title),
+		RecipeThree: fmt.Sprintf("%v: %v", recipeKey(suggestions[2].Id, suggestions[2].Source), suggestions[2].Title),
 	}
 
 	c.JSON(http.StatusOK, jsonResp)
 }
 
-func GetRecipeFromApi(c *gin.Context, recipeId string, cache *cache.Cache[models.RecipeInfo], apiClient SpoonacularClient) {
+// errInvalidRecipeId is returned when a recipe id is not a valid Spoonacular id
+var errInvalidRecipeId = errors.New("Invalid recipe ID")
+
+// lookupRecipe returns a recipe from the cache, or fetches and caches it from the API.
+// The boolean reports whether the recipe was freshly fetched.
+func lookupRecipe(ctx context.Context, recipeId string, cache *cache.Cache[models.RecipeInfo], apiClient SpoonacularClient) (models.RecipeInfo, bool, error) {
 	cacheRecipe, found := cache.Get(recipeId)
 	if found {
 		fmt.Printf("Found %v in cache!\n", recipeId)
-		c.JSON(http.StatusOK, cacheRecipe)
-		return
+		return cacheRecipe, false, nil
 	}
 
 	recipeIdInt64, err := strconv.ParseInt(recipeId, 10, 32)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid recipe ID"})
-		return
+		return models.RecipeInfo{}, false, errInvalidRecipeId
 	}
 
-	result, err := apiClient.GetRecipeInformation(context.Background(), int32(recipeIdInt64))
+	result, err := apiClient.GetRecipeInformation(ctx, int32(recipeIdInt64))
+	if errors.Is(err, spoonacularapi.ErrQuotaExhausted) {
+		// Fall back to a saved copy while the quota is protected
+		if data, dbErr := recipeFromDB(recipeId); dbErr == nil {
+			return data, false, nil
+		}
+	}
 	if err != nil {
-		// Try to print the raw response if possible (if your client exposes it)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Error fetching recipe: %v", err)})
-		return
+		return models.RecipeInfo{}, false, fmt.Errorf("Error fetching recipe: %w", err)
 	}
 
+	data := recipeInfoFromApi(result)
+	cache.Set(recipeId, data, recipeTTL)
+	return data, true, nil
+}
+
+// recipeTTL is how long recipes fetched from Spoonacular stay cached
+const recipeTTL = 15 * 24 * time.Hour
+
+// recipeInfoFromApi flattens a Spoonacular recipe into the shape returned by the API
+func recipeInfoFromApi(result *spoonacularapi.RecipeInformationOverride) models.RecipeInfo {
 	// Ingredients
 	var ingredients []string
 	for _, ingredient := range result.ExtendedIngredients {
@@ -97,19 +217,79 @@ func GetRecipeFromApi(c *gin.Context, recipeId string, cache *cache.Cache[models
 	}
 	ingredientsStr := strings.Join(ingredients, ", ")
 
-	ttl := 15 * 24 * time.Hour
-	data := models.RecipeInfo{
+	// Some recipes have no original source and only exist on Spoonacular
+	url := result.SourceURL
+	if url == "" {
+		url = result.SpoonacularSourceURL
+	}
+
+	return models.RecipeInfo{
 		Title:        cleanHTMLContent(result.Title),
 		Id:           int32(result.ID),
-		Url:          result.SourceName,
+		Url:          url,
 		Instructions: cleanHTMLContent(result.Instructions),
 		Ingredients:  ingredientsStr,
 	}
-	cache.Set(recipeId, data, ttl)
-	ntfy.NtfyRecipe(&data, ntfy.NewNotifier("dinner"))
+}
+
+// respondLookupError maps a lookupRecipe error onto an HTTP response
+func respondLookupError(c *gin.Context, err error) {
+	if errors.Is(err, errInvalidRecipeId) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, spoonacularapi.ErrQuotaExhausted) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
+
+// GetRecipeFromApi returns a recipe by its Spoonacular id, or a local recipe by its "local-" id
+func GetRecipeFromApi(c *gin.Context, recipeId string, cache *cache.Cache[models.RecipeInfo], apiClient SpoonacularClient) {
+	if _, local := localRecipeId(recipeId); local {
+		GetLocalRecipe(c, recipeId)
+		return
+	}
+
+	ctx := utils.RequestContext(c)
+	data, fetched, err := lookupRecipe(ctx, recipeId, cache, apiClient)
+	if err != nil {
+		respondLookupError(c, err)
+		return
+	}
+
+	if fetched {
+		ntfy.NtfyRecipe(ctx, &data, ntfy.NewNotifier("dinner"))
+	}
 	c.JSON(http.StatusOK, data)
 }
 
+// ExportRecipe renders a recipe as Markdown, printable HTML or JSON. Custom recipes are
+// exported from the database by their "local-" id.
+func ExportRecipe(c *gin.Context, recipeId string, cache *cache.Cache[models.RecipeInfo], apiClient SpoonacularClient) {
+	if !export.ValidateFormat(c) {
+		return
+	}
+	if _, local := localRecipeId(recipeId); local {
+		recipe, ok := findLocalRecipe(c, recipeId)
+		if !ok {
+			return
+		}
+		data := localRecipeInfo(*recipe)
+		export.Respond(c, "recipe", "recipe-"+recipeKey(data.Id, data.Source), data)
+		return
+	}
+
+	data, _, err := lookupRecipe(utils.RequestContext(c), recipeId, cache, apiClient)
+	if err != nil {
+		respondLookupError(c, err)
+		return
+	}
+
+	export.Respond(c, "recipe", fmt.Sprintf("recipe-%d", data.Id), data)
+}
+
 func GetRecipeFromDB(c *gin.Context, recipeId string, cache *cache.Cache[models.RecipeInfo]) {
 	cacheRecipe, found := cache.Get(recipeId)
 	if found {
@@ -117,24 +297,71 @@ func GetRecipeFromDB(c *gin.Context, recipeId string, cache *cache.Cache[models.
 		return
 	}
 
+	recipeInfo, err := recipeFromDB(recipeId)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	cache.Set(recipeId, recipeInfo, 0)
+	c.JSON(http.StatusOK, recipeInfo)
+}
+
+// recipeFromDB loads a saved Spoonacular recipe by its external id
+func recipeFromDB(recipeId string) (models.RecipeInfo, error) {
 	db := database.GetDB()
 	var recipe models.Dinner
 	db.Where("external_id = ?", recipeId).First(&recipe)
 	recipeIdInt, err := strconv.Atoi(recipe.ExternalId)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Error converting recipe ID: %v", err)})
-		return
+		return models.RecipeInfo{}, fmt.Errorf("Error converting recipe ID: %v", err)
 	}
 
-	recipeInfo := models.RecipeInfo{
+	return models.RecipeInfo{
 		Title:        recipe.Title,
 		Id:           int32(recipeIdInt),
 		Url:          recipe.Url,
 		Instructions: recipe.Instructions,
 		Ingredients:  recipe.Ingredients,
+	}, nil
+}
+
+// maxSavedCandidates bounds how many saved recipes the quota fallback considers at once
+const maxSavedCandidates = 10
+
+// randomRecipesFromDB picks saved Spoonacular recipes when the API cannot be used, preferring
+// those not seen within the repeat window
+func randomRecipesFromDB(count int, seen map[string]bool) ([]spoonacularapi.Recipe, error) {
+	var dinners []models.Dinner
+	err := database.GetDB().Where("external_id <> ''").Order("RANDOM()").Limit(maxSavedCandidates).Find(&dinners).Error
+	if err != nil {
+		return nil, err
 	}
-	cache.Set(recipeId, recipeInfo, 0)
-	c.JSON(http.StatusOK, recipeInfo)
+
+	var recipes []spoonacularapi.Recipe
+	for _, dinner := range dinners {
+		id, err := strconv.Atoi(dinner.ExternalId)
+		if err != nil {
+			continue
+		}
+		recipes = append(recipes, spoonacularapi.Recipe{Id: int32(id), Title: dinner.Title})
+	}
+	return preferFresh(recipes, seen, count), nil
+}
+
+// QuotaReporter exposes the Spoonacular quota usage captured by the client
+type QuotaReporter interface {
+	Quota() spoonacularapi.Quota
+	QuotaThreshold() float64
+	Exhausted() bool
+}
+
+// GetQuota returns the Spoonacular daily quota usage
+func GetQuota(c *gin.Context, reporter QuotaReporter) {
+	c.JSON(http.StatusOK, gin.H{
+		"quota":     reporter.Quota(),
+		"threshold": reporter.QuotaThreshold(),
+		"exhausted": reporter.Exhausted(),
+	})
 }
 
 func SaveRecipe(c *gin.Context, cache *cache.Cache[models.RecipeInfo], recipe *models.RecipeInfo) {
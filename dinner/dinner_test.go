@@ -8,15 +8,20 @@ import (
 	"net/http/httptest"
 	"net/url"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
 	spoonacular "github.com/ddsky/spoonacular-api-clients/go"
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 	"github.com/rjhoppe/firelink/cache"
 	"github.com/rjhoppe/firelink/models"
+	"github.com/rjhoppe/firelink/ntfy"
 	"github.com/rjhoppe/firelink/spoonacularapi"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
 )
 
 // MockSpoonacularClient is a mockable implementation of your custom client
@@ -39,7 +44,25 @@ func (m *MockSpoonacularAdapter) GetRandomRecipes(ctx context.Context, number in
 	return &spoonacularapi.RandomRecipesResponse{}, nil
 }
 
-type ErrorMockSpoonacularAdapter struct{}
+func (m *MockSpoonacularAdapter) SearchRecipes(ctx context.Context, params spoonacularapi.SearchParams) (*spoonacularapi.SearchRecipesResponse, error) {
+	return &spoonacularapi.SearchRecipesResponse{}, nil
+}
+
+func (m *MockSpoonacularAdapter) GetSimilarRecipes(ctx context.Context, id int32, number int) ([]spoonacularapi.SimilarRecipe, error) {
+	return nil, nil
+}
+
+func (m *MockSpoonacularAdapter) AutocompleteRecipeSearch(ctx context.Context, query string, number int) ([]spoonacularapi.AutocompleteResult, error) {
+	return nil, nil
+}
+
+func (m *MockSpoonacularAdapter) GetRecipeInformationBulk(ctx context.Context, ids []int32) ([]spoonacularapi.RecipeInformationOverride, error) {
+	return nil, nil
+}
+
+type ErrorMockSpoonacularAdapter struct {
+	MockSpoonacularAdapter
+}
 
 func (m *ErrorMockSpoonacularAdapter) GetRecipeInformation(ctx context.Context, id int32) (*spoonacularapi.RecipeInformationOverride, error) {
 	return nil, fmt.Errorf("API error")
@@ -105,7 +128,7 @@ func TestGetRandomRecipes(t *testing.T) {
 	c, _ := gin.CreateTestContext(w)
 
 	// Call the handler
-	GetRandomRecipes(c, adapter)
+	GetRandomRecipes(c, adapter, nil)
 
 	// Assert the response
 	assert.Equal(t, http.StatusOK, w.Code)
@@ -223,3 +246,408 @@ func TestGetRecipeFromApi_ApiError(t *testing.T) {
 	assert.Equal(t, http.StatusInternalServerError, w.Code)
 	assert.Contains(t, w.Body.String(), "Error fetching recipe")
 }
+
+func TestCreateRecipe_InvalidBody(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("POST", "/dinner/recipes", strings.NewReader(`{"title": "Grandma's Lasagna"}`))
+	c.Request.Header.Set("Content-Type", "application/json")
+
+	CreateRecipe(c)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "Instructions")
+}
+
+func TestLocalRecipeInfo(t *testing.T) {
+	recipe := models.Dinner{Title: "Grandma's Lasagna", Instructions: "Layer and bake", Ingredients: "Noodles, Sauce"}
+	recipe.ID = 7
+
+	info := localRecipeInfo(recipe)
+
+	assert.Equal(t, int32(7), info.Id)
+	assert.Equal(t, "Grandma's Lasagna", info.Title)
+	assert.Equal(t, models.SourceLocal, info.Source)
+}
+
+type MemoryHistory struct {
+	Entries []models.DinnerHistory
+}
+
+func (m *MemoryHistory) Record(entries ...models.DinnerHistory) error {
+	m.Entries = append(m.Entries, entries...)
+	return nil
+}
+
+func (m *MemoryHistory) Since(since time.Time) ([]models.DinnerHistory, error) {
+	var recent []models.DinnerHistory
+	for _, entry := range m.Entries {
+		if !entry.At.Before(since) {
+			recent = append(recent, entry)
+		}
+	}
+	return recent, nil
+}
+
+// SequenceSpoonacularAdapter returns the next batch of random recipes on each call
+type SequenceSpoonacularAdapter struct {
+	MockSpoonacularAdapter
+	Batches [][]spoonacularapi.Recipe
+	Calls   int
+}
+
+func (m *SequenceSpoonacularAdapter) GetRandomRecipes(ctx context.Context, number int) (*spoonacularapi.RandomRecipesResponse, error) {
+	batch := m.Batches[m.Calls%len(m.Batches)]
+	m.Calls++
+	return &spoonacularapi.RandomRecipesResponse{Recipes: batch}, nil
+}
+
+func TestGetRandomRecipes_SkipsRecentHistory(t *testing.T) {
+	history := &MemoryHistory{Entries: []models.DinnerHistory{
+		{RecipeId: 1, Event: models.HistoryCooked, At: time.Now().Add(-48 * time.Hour)},
+		{RecipeId: 2, Event: models.HistorySuggested, At: time.Now().Add(-72 * time.Hour)},
+		{RecipeId: 3, Event: models.HistorySuggested, At: time.Now().AddDate(0, -2, 0)},
+	}}
+	adapter := &SequenceSpoonacularAdapter{Batches: [][]spoonacularapi.Recipe{
+		{{Id: 1, Title: "Recipe 1"}, {Id: 2, Title: "Recipe 2"}, {Id: 3, Title: "Recipe 3"}},
+		{{Id: 4, Title: "Recipe 4"}, {Id: 1, Title: "Recipe 1"}, {Id: 5, Title: "Recipe 5"}},
+	}}
+
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+
+	GetRandomRecipes(c, adapter, history)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 2, adapter.Calls)
+
+	var response models.RandomRecipes
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, "3: Recipe 3", response.RecipeOne)
+	assert.Equal(t, "4: Recipe 4", response.RecipeTwo)
+	assert.Equal(t, "5: Recipe 5", response.RecipeThree)
+
+	assert.Len(t, history.Entries, 6)
+	assert.Equal(t, models.HistorySuggested, history.Entries[5].Event)
+}
+
+func TestGetRandomRecipes_FallsBackToRepeats(t *testing.T) {
+	history := &MemoryHistory{Entries: []models.DinnerHistory{
+		{RecipeId: 1, Event: models.HistoryCooked, At: time.Now()},
+	}}
+	adapter := &SequenceSpoonacularAdapter{Batches: [][]spoonacularapi.Recipe{
+		{{Id: 1, Title: "Recipe 1"}, {Id: 2, Title: "Recipe 2"}, {Id: 3, Title: "Recipe 3"}},
+	}}
+
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+
+	GetRandomRecipes(c, adapter, history)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, maxRandomCalls, adapter.Calls)
+
+	var response models.RandomRecipes
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, "1: Recipe 1", response.RecipeThree)
+}
+
+func TestPreferFresh(t *testing.T) {
+	// Saved recipes used while the quota is exhausted honour the repeat window too
+	saved := []spoonacularapi.Recipe{{Id: 1, Title: "Recipe 1"}, {Id: 2, Title: "Recipe 2"}, {Id: 3, Title: "Recipe 3"}, {Id: 4, Title: "Recipe 4"}}
+	seen := map[string]bool{"1": true, "3": true, "local-2": true}
+
+	recipes := preferFresh(saved, seen, 3)
+	require.Len(t, recipes, 3)
+	assert.Equal(t, []int32{2, 4, 1}, []int32{recipes[0].Id, recipes[1].Id, recipes[2].Id})
+
+	assert.Len(t, preferFresh(saved[:2], seen, 3), 2)
+}
+
+// ContextRecordingAdapter remembers the context it was called with
+type ContextRecordingAdapter struct {
+	MockSpoonacularAdapter
+	Ctx context.Context
+}
+
+func (m *ContextRecordingAdapter) GetRecipeInformation(ctx context.Context, id int32) (*spoonacularapi.RecipeInformationOverride, error) {
+	m.Ctx = ctx
+	return nil, ctx.Err()
+}
+
+func TestGetRecipeFromApi_UsesRequestContext(t *testing.T) {
+	adapter := &ContextRecordingAdapter{}
+
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	ctx, cancel := context.WithCancel(context.Background())
+	c.Request = httptest.NewRequest("GET", "/dinner/recipe/42", nil).WithContext(ctx)
+	cancel()
+
+	GetRecipeFromApi(c, "42", cache.NewCache[models.RecipeInfo](10), adapter)
+
+	assert.Equal(t, ctx, adapter.Ctx)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Contains(t, w.Body.String(), "context canceled")
+}
+
+func TestSearchRecipes(t *testing.T) {
+	var query url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/recipes/complexSearch", r.URL.Path)
+		query = r.URL.Query()
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"results": [{"id": 716429, "title": "Pasta with Garlic"}], "offset": 0, "number": 5, "totalResults": 42}`))
+	}))
+	defer server.Close()
+
+	adapter := &spoonacularapi.SpoonacularAdapter{RealClient: spoonacularapi.NewClient("fake-api-key", spoonacularapi.WithBaseURL(server.URL))}
+
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("GET", "/dinner/search?q=pasta&diet=vegetarian&number=5", nil)
+
+	SearchRecipes(c, adapter)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "pasta", query.Get("query"))
+	assert.Equal(t, "vegetarian", query.Get("diet"))
+	assert.Equal(t, "5", query.Get("number"))
+	assert.Empty(t, query.Get("cuisine"))
+
+	var response struct {
+		Results []spoonacularapi.SearchResult `json:"results"`
+		Total   int                           `json:"total"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, 42, response.Total)
+	assert.Equal(t, "Pasta with Garlic", response.Results[0].Title)
+}
+
+func TestRespondSearch_QuotaExhaustedKeepsLocal(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	local := []models.RecipeInfo{{Id: 4, Title: "Grandma's Pasta", Source: models.SourceLocal}}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	respondSearch(c, spoonacularapi.SearchParams{Query: "pasta"}, local, nil, spoonacularapi.ErrQuotaExhausted)
+	require.Equal(t, http.StatusOK, w.Code)
+	var response struct {
+		Local   []models.RecipeInfo `json:"local"`
+		Skipped bool                `json:"spoonacular_skipped"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.True(t, response.Skipped)
+	assert.Equal(t, local, response.Local)
+
+	// Without local matches there is nothing to show
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	respondSearch(c, spoonacularapi.SearchParams{Query: "pasta"}, []models.RecipeInfo{}, nil, spoonacularapi.ErrQuotaExhausted)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+}
+
+func TestAutocompleteRecipes_MissingQuery(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("GET", "/dinner/autocomplete", nil)
+
+	AutocompleteRecipes(c, &MockSpoonacularAdapter{})
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestGetSimilarRecipes(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/recipes/716429/similar", r.URL.Path)
+		assert.Equal(t, "2", r.URL.Query().Get("number"))
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[{"id": 1, "title": "Similar 1"}, {"id": 2, "title": "Similar 2"}]`))
+	}))
+	defer server.Close()
+
+	adapter := &spoonacularapi.SpoonacularAdapter{RealClient: spoonacularapi.NewClient("fake-api-key", spoonacularapi.WithBaseURL(server.URL))}
+
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("GET", "/dinner/recipe/716429/similar?number=2", nil)
+
+	GetSimilarRecipes(c, "716429", adapter)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "Similar 2")
+}
+
+func TestGetRecipesBulk_FetchesOnlyMisses(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		assert.Equal(t, "/recipes/informationBulk", r.URL.Path)
+		assert.Equal(t, "3,2", r.URL.Query().Get("ids"))
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[
+			{"id": 2, "title": "Recipe 2", "extendedIngredients": [{"amount": 1, "unit": "cup", "name": "rice"}]},
+			{"id": 3, "title": "Recipe 3"}
+		]`))
+	}))
+	defer server.Close()
+
+	adapter := &spoonacularapi.SpoonacularAdapter{RealClient: spoonacularapi.NewClient("fake-api-key", spoonacularapi.WithBaseURL(server.URL))}
+	testCache := cache.NewCache[models.RecipeInfo](10)
+	testCache.Set("1", models.RecipeInfo{Id: 1, Title: "Cached Recipe"}, 5*time.Minute)
+
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("GET", "/dinner/recipes?ids=3,1,2,3", nil)
+
+	GetRecipesBulk(c, testCache, adapter)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 1, calls)
+
+	var response struct {
+		Recipes []models.RecipeInfo `json:"recipes"`
+		Missing []string            `json:"missing"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Len(t, response.Recipes, 3)
+	assert.Equal(t, "Recipe 3", response.Recipes[0].Title)
+	assert.Equal(t, "Cached Recipe", response.Recipes[1].Title)
+	assert.Equal(t, "1cup of rice", response.Recipes[2].Ingredients)
+	assert.Empty(t, response.Missing)
+
+	cached, found := testCache.Get("2")
+	assert.True(t, found)
+	assert.Equal(t, "Recipe 2", cached.Title)
+}
+
+func TestParseRecipeIds(t *testing.T) {
+	ids, err := parseRecipeIds("1, 2,,2, local-2,local-2")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1", "2", "local-2"}, ids)
+
+	_, err = parseRecipeIds("1,abc")
+	assert.Error(t, err)
+
+	_, err = parseRecipeIds("local-")
+	assert.Error(t, err)
+
+	_, err = parseRecipeIds("")
+	assert.Error(t, err)
+}
+
+func TestMixInLocal(t *testing.T) {
+	upstream := []spoonacularapi.Recipe{{Id: 1, Title: "Recipe 1"}, {Id: 2, Title: "Recipe 2"}, {Id: 3, Title: "Recipe 3"}}
+	local := []models.Dinner{{Model: gorm.Model{ID: 7}, Title: "Grandma's Lasagna"}, {Model: gorm.Model{ID: 8}, Title: "Aunt's Stew"}}
+
+	suggestions := mixInLocal(upstream, local)
+	require.Len(t, suggestions, 3)
+	assert.Equal(t, suggestion{Id: 2, Title: "Recipe 2", Source: models.SourceApi}, suggestions[1])
+	assert.Equal(t, suggestion{Id: 7, Title: "Grandma's Lasagna", Source: models.SourceLocal}, suggestions[2])
+
+	// Local recipes fill the slots Spoonacular could not
+	suggestions = mixInLocal(upstream[:1], local)
+	require.Len(t, suggestions, 3)
+	assert.Equal(t, models.SourceLocal, suggestions[1].Source)
+
+	assert.Len(t, mixInLocal(upstream, nil), 3)
+}
+
+func TestRecentRecipeIds_KeepsLocalIdsApart(t *testing.T) {
+	history := &MemoryHistory{Entries: []models.DinnerHistory{
+		{RecipeId: 7, Source: models.SourceLocal, Event: models.HistoryCooked, At: time.Now()},
+		{RecipeId: 8, Event: models.HistorySuggested, At: time.Now()},
+	}}
+
+	seen, err := recentRecipeIds(history, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, map[string]bool{"local-7": true, "8": true}, seen)
+	assert.Equal(t, "local-7", recipeKey(7, models.SourceLocal))
+}
+
+func TestExportRecipe_LocalIdSkipsSpoonacular(t *testing.T) {
+	adapter := &ContextRecordingAdapter{}
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("GET", "/dinner/recipe/local-abc/export", nil)
+
+	ExportRecipe(c, "local-abc", cache.NewCache[models.RecipeInfo](10), adapter)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Nil(t, adapter.Ctx)
+
+	// An unsupported format is rejected before Spoonacular is called
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("GET", "/dinner/recipe/716429/export?format=pdf", nil)
+	ExportRecipe(c, "716429", cache.NewCache[models.RecipeInfo](10), adapter)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Nil(t, adapter.Ctx)
+}
+
+func TestRecipeNotification_LinksSpoonacularSource(t *testing.T) {
+	data, err := os.ReadFile("testdata/recipe.json")
+	require.NoError(t, err)
+	adapter := &MockSpoonacularAdapter{RecipeJSON: string(data)}
+	result, err := adapter.GetRecipeInformation(context.Background(), 716429)
+	require.NoError(t, err)
+	recipe := recipeInfoFromApi(result)
+
+	var payload struct {
+		Click   string        `json:"click"`
+		Actions []ntfy.Action `json:"actions"`
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&payload)
+	}))
+	defer server.Close()
+	require.NoError(t, ntfy.Configure(ntfy.Config{Backends: []string{"ntfy"}, NtfyServer: server.URL, PublicURL: "https://firelink.example.com"}))
+	t.Cleanup(func() { ntfy.Configure(ntfy.Config{Backends: []string{"ntfy"}, NtfyServer: ntfy.DefaultServer}) })
+
+	ntfy.NtfyRecipe(context.Background(), &recipe, &ntfy.NtfyNotifier{Topic: "dinner", Server: server.URL, Client: server.Client()})
+
+	source := "http://fullbellysisters.blogspot.com/2012/06/pasta-with-garlic-scallions-cauliflower.html"
+	assert.Equal(t, source, payload.Click)
+	require.Len(t, payload.Actions, 2)
+	assert.Equal(t, source, payload.Actions[0].URL)
+
+	// The "Save" body is accepted by POST /dinner/recipes
+	var save models.DinnerRequest
+	require.NoError(t, json.Unmarshal([]byte(payload.Actions[1].Body), &save))
+	assert.NoError(t, binding.Validator.ValidateStruct(save))
+	assert.Equal(t, source, save.Url)
+}
+
+func TestGetRecipesBulk_LocalIdsSkipSpoonacular(t *testing.T) {
+	adapter := &spoonacularapi.SpoonacularAdapter{RealClient: spoonacularapi.NewClient("fake-api-key", spoonacularapi.WithBaseURL("http://127.0.0.1:0"))}
+	testCache := cache.NewCache[models.RecipeInfo](10)
+	testCache.Set("1", models.RecipeInfo{Id: 1, Title: "Cached Recipe"}, 5*time.Minute)
+
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("GET", "/dinner/recipes?ids=local-4,1", nil)
+
+	GetRecipesBulk(c, testCache, adapter)
+
+	// Without a database the custom recipe cannot be found, but it is never sent upstream
+	require.Equal(t, http.StatusOK, w.Code)
+	var response struct {
+		Recipes []models.RecipeInfo `json:"recipes"`
+		Missing []string            `json:"missing"`
+		Error   string              `json:"error"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Len(t, response.Recipes, 1)
+	assert.Equal(t, []string{"local-4"}, response.Missing)
+	assert.Empty(t, response.Error)
+}
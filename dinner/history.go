@@ -0,0 +1,100 @@
+package dinner
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rjhoppe/firelink/cache"
+	"github.com/rjhoppe/firelink/database"
+	"github.com/rjhoppe/firelink/models"
+	"github.com/rjhoppe/firelink/utils"
+)
+
+// HistoryStore persists which recipes were suggested or cooked
+type HistoryStore interface {
+	Record(entries ...models.DinnerHistory) error
+	Since(since time.Time) ([]models.DinnerHistory, error)
+}
+
+// DBHistory is a HistoryStore backed by the database
+type DBHistory struct{}
+
+func (h *DBHistory) Record(entries ...models.DinnerHistory) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	return database.GetDB().Create(&entries).Error
+}
+
+func (h *DBHistory) Since(since time.Time) ([]models.DinnerHistory, error) {
+	var entries []models.DinnerHistory
+	err := database.GetDB().Where("at >= ?", since).Order("at DESC").Find(&entries).Error
+	return entries, err
+}
+
+// repeatWindow is how long a suggested or cooked recipe is kept out of /dinner/random
+func repeatWindow() time.Duration {
+	return time.Duration(utils.GetEnvInt("DINNER_REPEAT_WINDOW_DAYS", 14)) * 24 * time.Hour
+}
+
+// recentRecipeIds returns the keys of recipes suggested or cooked within the repeat window
+func recentRecipeIds(history HistoryStore, now time.Time) (map[string]bool, error) {
+	seen := map[string]bool{}
+	if history == nil {
+		return seen, nil
+	}
+	entries, err := history.Since(now.Add(-repeatWindow()))
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		seen[recipeKey(entry.RecipeId, entry.Source)] = true
+	}
+	return seen, nil
+}
+
+// RecordCooked marks a recipe, or a "local-" recipe, as cooked so it is not suggested again for a while
+func RecordCooked(c *gin.Context, recipeId string, cache *cache.Cache[models.RecipeInfo], history HistoryStore) {
+	entry := models.DinnerHistory{Event: models.HistoryCooked, At: time.Now()}
+	if _, local := localRecipeId(recipeId); local {
+		recipe, ok := findLocalRecipe(c, recipeId)
+		if !ok {
+			return
+		}
+		entry.RecipeId, entry.Source, entry.Title = int32(recipe.ID), models.SourceLocal, recipe.Title
+	} else {
+		id, err := strconv.ParseInt(recipeId, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid recipe ID"})
+			return
+		}
+		entry.RecipeId, entry.Source = int32(id), models.SourceApi
+		if recipe, found := cache.Get(recipeId); found {
+			entry.Title = recipe.Title
+		}
+	}
+	if err := history.Record(entry); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Error recording history: %v", err)})
+		return
+	}
+	c.JSON(http.StatusCreated, entry)
+}
+
+// GetHistory returns the suggestions and cooked recipes of the last ?days= days (default 30)
+func GetHistory(c *gin.Context, history HistoryStore) {
+	days, err := strconv.Atoi(c.DefaultQuery("days", "30"))
+	if err != nil || days <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid number of days"})
+		return
+	}
+
+	entries, err := history.Since(time.Now().AddDate(0, 0, -days))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Error fetching history: %v", err)})
+		return
+	}
+	c.JSON(http.StatusOK, entries)
+}
@@ -0,0 +1,175 @@
+package dinner
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rjhoppe/firelink/database"
+	"github.com/rjhoppe/firelink/models"
+	"gorm.io/gorm"
+)
+
+// localRecipeInfo converts a locally authored Dinner into the shape returned by the API
+func localRecipeInfo(recipe models.Dinner) models.RecipeInfo {
+	return models.RecipeInfo{
+		Title:        recipe.Title,
+		Id:           int32(recipe.ID),
+		Url:          recipe.Url,
+		Instructions: recipe.Instructions,
+		Ingredients:  recipe.Ingredients,
+		Source:       models.SourceLocal,
+	}
+}
+
+// localRecipeId returns the database id of a "local-" recipe id, and false for upstream ids
+func localRecipeId(recipeId string) (string, bool) {
+	return strings.CutPrefix(recipeId, models.LocalIdPrefix)
+}
+
+// recipeKey identifies a recipe in responses and the history, prefixing local ids so they
+// cannot be mistaken for Spoonacular ones
+func recipeKey(id int32, source string) string {
+	if source == models.SourceLocal {
+		return fmt.Sprintf("%s%d", models.LocalIdPrefix, id)
+	}
+	return strconv.Itoa(int(id))
+}
+
+// findLocalRecipe looks up a locally authored recipe by its database id, with or without
+// the "local-" prefix
+func findLocalRecipe(c *gin.Context, recipeId string) (*models.Dinner, bool) {
+	recipeId, _ = localRecipeId(recipeId)
+	id, err := strconv.ParseUint(recipeId, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid recipe ID"})
+		return nil, false
+	}
+
+	var recipe models.Dinner
+	err = database.GetDB().Where("id = ? AND source = ?", id, models.SourceLocal).First(&recipe).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Local recipe not found"})
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Error fetching recipe: %v", err)})
+		return nil, false
+	}
+	return &recipe, true
+}
+
+// CreateRecipe stores a custom recipe that has no upstream source
+func CreateRecipe(c *gin.Context) {
+	var req models.DinnerRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	recipe := models.Dinner{
+		Title:        req.Title,
+		Url:          req.Url,
+		Instructions: req.Instructions,
+		Ingredients:  req.Ingredients,
+		Source:       models.SourceLocal,
+	}
+	if err := database.SaveToDB(database.GetDB(), &recipe); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Error saving recipe: %v", err)})
+		return
+	}
+	c.JSON(http.StatusCreated, localRecipeInfo(recipe))
+}
+
+// UpdateRecipe replaces the contents of a locally authored recipe
+func UpdateRecipe(c *gin.Context, recipeId string) {
+	var req models.DinnerRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	recipe, ok := findLocalRecipe(c, recipeId)
+	if !ok {
+		return
+	}
+
+	recipe.Title = req.Title
+	recipe.Url = req.Url
+	recipe.Instructions = req.Instructions
+	recipe.Ingredients = req.Ingredients
+	if err := database.GetDB().Save(recipe).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Error updating recipe: %v", err)})
+		return
+	}
+	c.JSON(http.StatusOK, localRecipeInfo(*recipe))
+}
+
+// DeleteRecipe removes a locally authored recipe
+func DeleteRecipe(c *gin.Context, recipeId string) {
+	recipe, ok := findLocalRecipe(c, recipeId)
+	if !ok {
+		return
+	}
+
+	if err := database.GetDB().Delete(recipe).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Error deleting recipe: %v", err)})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": fmt.Sprintf("Recipe deleted: %s", recipe.Title)})
+}
+
+// GetLocalRecipe returns a locally authored recipe by its database id
+func GetLocalRecipe(c *gin.Context, recipeId string) {
+	recipe, ok := findLocalRecipe(c, recipeId)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, localRecipeInfo(*recipe))
+}
+
+// maxLocalCandidates bounds how many local recipes /dinner/random considers at once
+const maxLocalCandidates = 10
+
+// randomLocalRecipes returns up to count locally authored recipes in random order, leaving
+// out those suggested or cooked within the repeat window
+func randomLocalRecipes(count int, seen map[string]bool) []models.Dinner {
+	db := database.GetDB()
+	if db == nil {
+		return nil
+	}
+	var candidates []models.Dinner
+	err := db.Where("source = ?", models.SourceLocal).Order("RANDOM()").Limit(maxLocalCandidates).Find(&candidates).Error
+	if err != nil {
+		log.Printf("Failed to load local recipes: %v", err)
+		return nil
+	}
+
+	var recipes []models.Dinner
+	for _, recipe := range candidates {
+		if len(recipes) < count && !seen[recipeKey(int32(recipe.ID), models.SourceLocal)] {
+			recipes = append(recipes, recipe)
+		}
+	}
+	return recipes
+}
+
+// GetRandomLocalRecipes returns up to three random locally authored recipes
+func GetRandomLocalRecipes(c *gin.Context) {
+	var recipes []models.Dinner
+	err := database.GetDB().Where("source = ?", models.SourceLocal).Order("RANDOM()").Limit(3).Find(&recipes).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Error fetching local recipes: %v", err)})
+		return
+	}
+
+	results := []models.RecipeInfo{}
+	for _, recipe := range recipes {
+		results = append(results, localRecipeInfo(recipe))
+	}
+	c.JSON(http.StatusOK, results)
+}
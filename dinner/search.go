@@ -0,0 +1,152 @@
+package dinner
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rjhoppe/firelink/database"
+	"github.com/rjhoppe/firelink/models"
+	"github.com/rjhoppe/firelink/spoonacularapi"
+	"github.com/rjhoppe/firelink/utils"
+)
+
+// queryInt reads a positive integer query parameter, falling back to def
+func queryInt(c *gin.Context, key string, def int) (int, error) {
+	value := c.Query(key)
+	if value == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("Invalid %s", key)
+	}
+	return n, nil
+}
+
+// respondUpstreamError reports a failed Spoonacular call
+func respondUpstreamError(c *gin.Context, action string, err error) {
+	if errors.Is(err, spoonacularapi.ErrQuotaExhausted) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Error %s: %v", action, err)})
+}
+
+// searchLocalRecipes returns locally authored recipes whose title matches the query
+func searchLocalRecipes(query string) ([]models.RecipeInfo, error) {
+	results := []models.RecipeInfo{}
+	db := database.GetDB()
+	if db == nil || query == "" {
+		return results, nil
+	}
+
+	var recipes []models.Dinner
+	if err := db.Where("source = ? AND title ILIKE ?", models.SourceLocal, "%"+query+"%").Limit(10).Find(&recipes).Error; err != nil {
+		return nil, err
+	}
+	for _, recipe := range recipes {
+		results = append(results, localRecipeInfo(recipe))
+	}
+	return results, nil
+}
+
+// SearchRecipes searches Spoonacular and the local recipes with
+// ?q=&cuisine=&diet=&intolerances=&type=&maxReadyTime=&number=&offset=
+func SearchRecipes(c *gin.Context, apiClient SpoonacularClient) {
+	params := spoonacularapi.SearchParams{
+		Query:        c.Query("q"),
+		Cuisine:      c.Query("cuisine"),
+		Diet:         c.Query("diet"),
+		Intolerances: c.Query("intolerances"),
+		Type:         c.Query("type"),
+	}
+	var err error
+	for key, target := range map[string]*int{"maxReadyTime": &params.MaxReadyTime, "number": &params.Number, "offset": &params.Offset} {
+		if *target, err = queryInt(c, key, 0); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if params.Number == 0 {
+		params.Number = 10
+	}
+
+	local, err := searchLocalRecipes(params.Query)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Error searching local recipes: %v", err)})
+		return
+	}
+	result, err := apiClient.SearchRecipes(utils.RequestContext(c), params)
+	respondSearch(c, params, local, result, err)
+}
+
+// respondSearch answers a recipe search. While the quota is protected the local matches are
+// still returned, flagged with "spoonacular_skipped", as long as there are any.
+func respondSearch(c *gin.Context, params spoonacularapi.SearchParams, local []models.RecipeInfo, result *spoonacularapi.SearchRecipesResponse, err error) {
+	if errors.Is(err, spoonacularapi.ErrQuotaExhausted) && len(local) > 0 {
+		c.JSON(http.StatusOK, gin.H{
+			"results":             []spoonacularapi.SearchResult{},
+			"total":               0,
+			"offset":              params.Offset,
+			"local":               local,
+			"spoonacular_skipped": true,
+		})
+		return
+	}
+	if err != nil {
+		respondUpstreamError(c, "searching recipes", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"results": result.Results,
+		"total":   result.TotalResults,
+		"offset":  result.Offset,
+		"local":   local,
+	})
+}
+
+// GetSimilarRecipes returns recipes similar to a Spoonacular recipe (?number=, default 5)
+func GetSimilarRecipes(c *gin.Context, recipeId string, apiClient SpoonacularClient) {
+	id, err := strconv.ParseInt(recipeId, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid recipe ID"})
+		return
+	}
+	number, err := queryInt(c, "number", 5)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	similar, err := apiClient.GetSimilarRecipes(utils.RequestContext(c), int32(id), number)
+	if err != nil {
+		respondUpstreamError(c, "fetching similar recipes", err)
+		return
+	}
+	c.JSON(http.StatusOK, similar)
+}
+
+// AutocompleteRecipes suggests recipe titles for a partial ?q= (?number=, default 10)
+func AutocompleteRecipes(c *gin.Context, apiClient SpoonacularClient) {
+	query := c.Query("q")
+	if query == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing query parameter q"})
+		return
+	}
+	number, err := queryInt(c, "number", 10)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	suggestions, err := apiClient.AutocompleteRecipeSearch(utils.RequestContext(c), query, number)
+	if err != nil {
+		respondUpstreamError(c, "autocompleting recipes", err)
+		return
+	}
+	c.JSON(http.StatusOK, suggestions)
+}
@@ -0,0 +1,193 @@
+package epub
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+// This package reads the package metadata (OPF) of EPUB 2 and 3 files
+
+// ErrNoCover is returned when an EPUB does not declare a cover image
+var ErrNoCover = errors.New("epub has no cover image")
+
+// maxCoverSize bounds how much of a cover image is read from an archive
+const maxCoverSize = 10 << 20
+
+// Identifier is a dc:identifier such as an ISBN, UUID or Gutenberg URL
+type Identifier struct {
+	Scheme string `json:"scheme,omitempty"`
+	Value  string `json:"value"`
+}
+
+// Metadata is the book information found in an EPUB's OPF file
+type Metadata struct {
+	Title       string       `json:"title"`
+	Authors     []string     `json:"authors"`
+	Description string       `json:"description"`
+	Language    string       `json:"language"`
+	Publisher   string       `json:"publisher"`
+	Date        string       `json:"date"`
+	Subjects    []string     `json:"subjects"`
+	Identifiers []Identifier `json:"identifiers"`
+
+	// CoverPath is the cover image's path inside the archive, if any
+	CoverPath string `json:"-"`
+	// CoverType is the cover image's media type
+	CoverType string `json:"-"`
+}
+
+type container struct {
+	Rootfiles []struct {
+		FullPath  string `xml:"full-path,attr"`
+		MediaType string `xml:"media-type,attr"`
+	} `xml:"rootfiles>rootfile"`
+}
+
+type opfPackage struct {
+	Metadata struct {
+		Titles      []string `xml:"title"`
+		Creators    []string `xml:"creator"`
+		Description string   `xml:"description"`
+		Languages   []string `xml:"language"`
+		Publisher   string   `xml:"publisher"`
+		Dates       []string `xml:"date"`
+		Subjects    []string `xml:"subject"`
+		Identifiers []struct {
+			Scheme string `xml:"scheme,attr"`
+			Value  string `xml:",chardata"`
+		} `xml:"identifier"`
+		Metas []struct {
+			Name    string `xml:"name,attr"`
+			Content string `xml:"content,attr"`
+		} `xml:"meta"`
+	} `xml:"metadata"`
+	Manifest []struct {
+		Id         string `xml:"id,attr"`
+		Href       string `xml:"href,attr"`
+		MediaType  string `xml:"media-type,attr"`
+		Properties string `xml:"properties,attr"`
+	} `xml:"manifest>item"`
+}
+
+func readXML(archive *zip.Reader, name string, v any) error {
+	file, err := archive.Open(name)
+	if err != nil {
+		return fmt.Errorf("could not open %s: %w", name, err)
+	}
+	defer file.Close()
+	if err := xml.NewDecoder(file).Decode(v); err != nil {
+		return fmt.Errorf("could not parse %s: %w", name, err)
+	}
+	return nil
+}
+
+// Read parses the metadata of an EPUB archive
+func Read(archive *zip.Reader) (*Metadata, error) {
+	var c container
+	if err := readXML(archive, "META-INF/container.xml", &c); err != nil {
+		return nil, err
+	}
+	opfPath := ""
+	for _, rootfile := range c.Rootfiles {
+		if rootfile.MediaType == "" || rootfile.MediaType == "application/oebps-package+xml" {
+			opfPath = rootfile.FullPath
+			break
+		}
+	}
+	if opfPath == "" {
+		return nil, errors.New("container.xml has no package rootfile")
+	}
+
+	var pkg opfPackage
+	if err := readXML(archive, opfPath, &pkg); err != nil {
+		return nil, err
+	}
+
+	source := pkg.Metadata
+	metadata := &Metadata{
+		Description: strings.TrimSpace(source.Description),
+		Publisher:   strings.TrimSpace(source.Publisher),
+	}
+	if len(source.Titles) > 0 {
+		metadata.Title = strings.TrimSpace(source.Titles[0])
+	}
+	if len(source.Languages) > 0 {
+		metadata.Language = strings.TrimSpace(source.Languages[0])
+	}
+	if len(source.Dates) > 0 {
+		metadata.Date = strings.TrimSpace(source.Dates[0])
+	}
+	for _, creator := range source.Creators {
+		if creator = strings.TrimSpace(creator); creator != "" {
+			metadata.Authors = append(metadata.Authors, creator)
+		}
+	}
+	for _, subject := range source.Subjects {
+		if subject = strings.TrimSpace(subject); subject != "" {
+			metadata.Subjects = append(metadata.Subjects, subject)
+		}
+	}
+	for _, identifier := range source.Identifiers {
+		if value := strings.TrimSpace(identifier.Value); value != "" {
+			metadata.Identifiers = append(metadata.Identifiers, Identifier{Scheme: identifier.Scheme, Value: value})
+		}
+	}
+
+	// EPUB 3 marks the cover with a manifest property, EPUB 2 with <meta name="cover">
+	coverId := ""
+	for _, meta := range source.Metas {
+		if meta.Name == "cover" {
+			coverId = meta.Content
+		}
+	}
+	for _, item := range pkg.Manifest {
+		if strings.Contains(" "+item.Properties+" ", " cover-image ") || (coverId != "" && item.Id == coverId) {
+			metadata.CoverPath = path.Join(path.Dir(opfPath), item.Href)
+			metadata.CoverType = item.MediaType
+			break
+		}
+	}
+	return metadata, nil
+}
+
+// ReadFile parses the metadata of the EPUB at filename
+func ReadFile(filename string) (*Metadata, error) {
+	archive, err := zip.OpenReader(filename)
+	if err != nil {
+		return nil, fmt.Errorf("could not open epub: %w", err)
+	}
+	defer archive.Close()
+	return Read(&archive.Reader)
+}
+
+// Cover returns the cover image of an EPUB and its media type
+func Cover(filename string) ([]byte, string, error) {
+	archive, err := zip.OpenReader(filename)
+	if err != nil {
+		return nil, "", fmt.Errorf("could not open epub: %w", err)
+	}
+	defer archive.Close()
+
+	metadata, err := Read(&archive.Reader)
+	if err != nil {
+		return nil, "", err
+	}
+	if metadata.CoverPath == "" {
+		return nil, "", ErrNoCover
+	}
+	file, err := archive.Open(metadata.CoverPath)
+	if err != nil {
+		return nil, "", fmt.Errorf("could not open cover: %w", err)
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, maxCoverSize))
+	if err != nil {
+		return nil, "", fmt.Errorf("could not read cover: %w", err)
+	}
+	return data, metadata.CoverType, nil
+}
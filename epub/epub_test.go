@@ -0,0 +1,123 @@
+package epub
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const containerXML = `<?xml version="1.0"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles>
+    <rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/>
+  </rootfiles>
+</container>`
+
+const epub2OPF = `<?xml version="1.0" encoding="utf-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="2.0" unique-identifier="id">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:opf="http://www.idpf.org/2007/opf">
+    <dc:title>Moby Dick; Or, The Whale</dc:title>
+    <dc:creator opf:role="aut">Herman Melville</dc:creator>
+    <dc:description> The voyage of the Pequod. </dc:description>
+    <dc:language>en</dc:language>
+    <dc:publisher>Project Gutenberg</dc:publisher>
+    <dc:subject>Whaling -- Fiction</dc:subject>
+    <dc:subject>Sea stories</dc:subject>
+    <dc:identifier id="id" opf:scheme="URI">http://www.gutenberg.org/2701</dc:identifier>
+    <meta name="cover" content="cover-img"/>
+  </metadata>
+  <manifest>
+    <item id="cover-img" href="images/cover.jpg" media-type="image/jpeg"/>
+  </manifest>
+</package>`
+
+const epub3OPF = `<?xml version="1.0" encoding="utf-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+    <dc:title>Family Recipes</dc:title>
+    <dc:creator>Grandma</dc:creator>
+    <dc:identifier>urn:uuid:1234</dc:identifier>
+  </metadata>
+  <manifest>
+    <item id="c" href="cover.png" media-type="image/png" properties="cover-image"/>
+  </manifest>
+</package>`
+
+func writeEpub(t *testing.T, files map[string]string) string {
+	path := filepath.Join(t.TempDir(), "book.epub")
+	file, err := os.Create(path)
+	require.NoError(t, err)
+	w := zip.NewWriter(file)
+	for name, content := range files {
+		f, err := w.Create(name)
+		require.NoError(t, err)
+		f.Write([]byte(content))
+	}
+	require.NoError(t, w.Close())
+	require.NoError(t, file.Close())
+	return path
+}
+
+func TestReadFile_EPUB2(t *testing.T) {
+	path := writeEpub(t, map[string]string{
+		"META-INF/container.xml": containerXML,
+		"OEBPS/content.opf":      epub2OPF,
+		"OEBPS/images/cover.jpg": "jpeg bytes",
+	})
+
+	metadata, err := ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "Moby Dick; Or, The Whale", metadata.Title)
+	assert.Equal(t, []string{"Herman Melville"}, metadata.Authors)
+	assert.Equal(t, "The voyage of the Pequod.", metadata.Description)
+	assert.Equal(t, "en", metadata.Language)
+	assert.Equal(t, "Project Gutenberg", metadata.Publisher)
+	assert.Equal(t, []string{"Whaling -- Fiction", "Sea stories"}, metadata.Subjects)
+	assert.Equal(t, []Identifier{{Scheme: "URI", Value: "http://www.gutenberg.org/2701"}}, metadata.Identifiers)
+	assert.Equal(t, "OEBPS/images/cover.jpg", metadata.CoverPath)
+
+	data, contentType, err := Cover(path)
+	require.NoError(t, err)
+	assert.Equal(t, "jpeg bytes", string(data))
+	assert.Equal(t, "image/jpeg", contentType)
+}
+
+func TestReadFile_EPUB3Cover(t *testing.T) {
+	path := writeEpub(t, map[string]string{
+		"META-INF/container.xml": containerXML,
+		"OEBPS/content.opf":      epub3OPF,
+		"OEBPS/cover.png":        "png bytes",
+	})
+
+	metadata, err := ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "Family Recipes", metadata.Title)
+	assert.Equal(t, []Identifier{{Value: "urn:uuid:1234"}}, metadata.Identifiers)
+
+	data, contentType, err := Cover(path)
+	require.NoError(t, err)
+	assert.Equal(t, "png bytes", string(data))
+	assert.Equal(t, "image/png", contentType)
+}
+
+func TestCover_Missing(t *testing.T) {
+	path := writeEpub(t, map[string]string{
+		"META-INF/container.xml": containerXML,
+		"OEBPS/content.opf":      `<package><metadata><title>No Cover</title></metadata></package>`,
+	})
+
+	_, _, err := Cover(path)
+	assert.ErrorIs(t, err, ErrNoCover)
+}
+
+func TestReadFile_NotAnEpub(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "book.epub")
+	require.NoError(t, os.WriteFile(path, []byte("not a zip"), 0644))
+
+	_, err := ReadFile(path)
+	assert.Error(t, err)
+}
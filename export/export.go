@@ -0,0 +1,131 @@
+package export
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"net/http"
+	"strings"
+	texttemplate "text/template"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Supported export formats
+const (
+	FormatMarkdown = "md"
+	FormatHTML     = "html"
+	FormatJSON     = "json"
+)
+
+//go:embed templates
+var templateFS embed.FS
+
+var funcs = map[string]any{
+	"items": splitItems,
+	"steps": splitSteps,
+	"card":  newCard,
+}
+
+// card is the common shape rendered by the printable HTML layout
+type card struct {
+	Title       string
+	Meta        string
+	Ingredients []string
+	Steps       []string
+	Source      string
+}
+
+func newCard(title, meta, ingredients, instructions, source string) card {
+	return card{
+		Title:       title,
+		Meta:        strings.Trim(meta, " ·"),
+		Ingredients: splitItems(ingredients),
+		Steps:       splitSteps(instructions),
+		Source:      source,
+	}
+}
+
+var (
+	markdownTemplates = texttemplate.Must(texttemplate.New("").Funcs(funcs).ParseFS(templateFS, "templates/*.md.tmpl"))
+	htmlTemplates     = htmltemplate.Must(htmltemplate.New("").Funcs(funcs).ParseFS(templateFS, "templates/*.html.tmpl"))
+)
+
+// splitItems turns a comma-separated ingredient string into a list
+func splitItems(content string) []string {
+	var items []string
+	for _, item := range strings.Split(content, ",") {
+		if trimmed := strings.TrimSpace(item); trimmed != "" {
+			items = append(items, trimmed)
+		}
+	}
+	return items
+}
+
+// splitSteps turns multi-line instructions into a list of non-empty lines
+func splitSteps(content string) []string {
+	var steps []string
+	for _, line := range strings.Split(content, "\n") {
+		if trimmed := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), "•")); trimmed != "" {
+			steps = append(steps, trimmed)
+		}
+	}
+	return steps
+}
+
+// ContentType returns the HTTP content type for an export format
+func ContentType(format string) string {
+	switch format {
+	case FormatHTML:
+		return "text/html; charset=utf-8"
+	case FormatJSON:
+		return "application/json; charset=utf-8"
+	default:
+		return "text/markdown; charset=utf-8"
+	}
+}
+
+// Render writes data of the given kind ("recipe" or "drink") in the requested format
+func Render(w io.Writer, format, kind string, data any) error {
+	switch format {
+	case FormatMarkdown:
+		return markdownTemplates.ExecuteTemplate(w, kind+".md.tmpl", data)
+	case FormatHTML:
+		return htmlTemplates.ExecuteTemplate(w, kind+".html.tmpl", data)
+	case FormatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "    ")
+		return encoder.Encode(data)
+	default:
+		return fmt.Errorf("unsupported export format: %q", format)
+	}
+}
+
+// ValidateFormat checks the ?format= query parameter, answering 400 when it is not a
+// supported format, so handlers can reject it before looking anything up
+func ValidateFormat(c *gin.Context) bool {
+	switch format := c.DefaultQuery("format", FormatMarkdown); format {
+	case FormatMarkdown, FormatHTML, FormatJSON:
+		return true
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unsupported export format: %q", format)})
+		return false
+	}
+}
+
+// Respond renders data in the format requested by the ?format= query parameter
+func Respond(c *gin.Context, kind, filename string, data any) {
+	format := c.DefaultQuery("format", FormatMarkdown)
+
+	var buf bytes.Buffer
+	if err := Render(&buf, format, kind, data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("inline; filename=%q", filename+"."+format))
+	c.Data(http.StatusOK, ContentType(format), buf.Bytes())
+}
@@ -0,0 +1,68 @@
+package export
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/rjhoppe/firelink/models"
+	"github.com/stretchr/testify/assert"
+)
+
+var testRecipe = models.RecipeInfo{
+	Title:        "Brownies",
+	Id:           123,
+	Url:          "https://www.test.com",
+	Ingredients:  "1 cup of sugar, 1 cup of flour, 1 cup of chocolate chips",
+	Instructions: "Mix everything\nBake in oven at 350 degrees for 20 minutes",
+}
+
+func TestRender_Markdown(t *testing.T) {
+	var buf bytes.Buffer
+	err := Render(&buf, FormatMarkdown, "recipe", testRecipe)
+	assert.NoError(t, err)
+
+	out := buf.String()
+	assert.Contains(t, out, "# Brownies")
+	assert.Contains(t, out, "Recipe ID: 123")
+	assert.Contains(t, out, "- 1 cup of flour")
+	assert.Contains(t, out, "Bake in oven at 350 degrees for 20 minutes")
+	assert.Contains(t, out, "Source: https://www.test.com")
+}
+
+func TestRender_HTML(t *testing.T) {
+	drink := models.DrinkResponse{
+		Name:         "Mojito <Classic>",
+		Category:     "Cocktail",
+		Glass:        "Highball glass",
+		Ingredients:  "2 oz Rum, 1 Lime",
+		Instructions: "Muddle and stir",
+	}
+
+	var buf bytes.Buffer
+	err := Render(&buf, FormatHTML, "drink", drink)
+	assert.NoError(t, err)
+
+	out := buf.String()
+	assert.Contains(t, out, "@page { size: 6in 4in;")
+	assert.Contains(t, out, "Mojito &lt;Classic&gt;")
+	assert.Contains(t, out, "Cocktail · Highball glass")
+	assert.Contains(t, out, "<li>2 oz Rum</li>")
+	assert.Contains(t, out, "<li>Muddle and stir</li>")
+}
+
+func TestRender_JSON(t *testing.T) {
+	var buf bytes.Buffer
+	err := Render(&buf, FormatJSON, "recipe", testRecipe)
+	assert.NoError(t, err)
+
+	var decoded models.RecipeInfo
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &decoded))
+	assert.Equal(t, testRecipe, decoded)
+}
+
+func TestRender_UnknownFormat(t *testing.T) {
+	var buf bytes.Buffer
+	err := Render(&buf, "pdf", "recipe", testRecipe)
+	assert.Error(t, err)
+}
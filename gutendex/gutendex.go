@@ -0,0 +1,214 @@
+package gutendex
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// This package is a small client for the Gutendex API (https://gutendex.com),
+// a JSON front end to the Project Gutenberg catalog
+
+// Person is an author or translator of a book
+type Person struct {
+	Name      string `json:"name"`
+	BirthYear *int   `json:"birth_year"`
+	DeathYear *int   `json:"death_year"`
+}
+
+// Book is a single Project Gutenberg record
+type Book struct {
+	ID            int               `json:"id"`
+	Title         string            `json:"title"`
+	Authors       []Person          `json:"authors"`
+	Translators   []Person          `json:"translators"`
+	Subjects      []string          `json:"subjects"`
+	Bookshelves   []string          `json:"bookshelves"`
+	Languages     []string          `json:"languages"`
+	Copyright     *bool             `json:"copyright"`
+	MediaType     string            `json:"media_type"`
+	Formats       map[string]string `json:"formats"`
+	DownloadCount int               `json:"download_count"`
+}
+
+// Page is one page of search results
+type Page struct {
+	Count    int     `json:"count"`
+	Next     *string `json:"next"`
+	Previous *string `json:"previous"`
+	Results  []Book  `json:"results"`
+}
+
+// Query are the filters accepted by the books endpoint
+type Query struct {
+	Search    string
+	Languages []string
+	Topic     string
+	Ids       []int
+	Page      int
+}
+
+// Client fetches books from Gutendex
+type Client struct {
+	httpClient *http.Client
+	baseURL    string
+}
+
+// ClientOption is a function that configures a Client
+type ClientOption func(*Client)
+
+// WithBaseURL sets a custom base URL for API requests
+func WithBaseURL(url string) ClientOption {
+	return func(c *Client) {
+		c.baseURL = strings.TrimSuffix(url, "/")
+	}
+}
+
+// WithHTTPClient sets a custom HTTP client
+func WithHTTPClient(client *http.Client) ClientOption {
+	return func(c *Client) {
+		c.httpClient = client
+	}
+}
+
+// NewClient creates a new Gutendex client
+func NewClient(options ...ClientOption) *Client {
+	c := &Client{
+		httpClient: http.DefaultClient,
+		baseURL:    "https://gutendex.com",
+	}
+	for _, option := range options {
+		option(c)
+	}
+	return c
+}
+
+// get performs a GET request and decodes the JSON response into out
+func (c *Client) get(ctx context.Context, endpoint string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error executing request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("API returned status code %d: %s", resp.StatusCode, string(bodyBytes))
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("error parsing JSON: %w", err)
+	}
+	return nil
+}
+
+// Search returns a page of books matching the query
+func (c *Client) Search(ctx context.Context, query Query) (*Page, error) {
+	params := url.Values{}
+	if query.Search != "" {
+		params.Set("search", query.Search)
+	}
+	if len(query.Languages) > 0 {
+		params.Set("languages", strings.Join(query.Languages, ","))
+	}
+	if query.Topic != "" {
+		params.Set("topic", query.Topic)
+	}
+	if len(query.Ids) > 0 {
+		ids := make([]string, len(query.Ids))
+		for i, id := range query.Ids {
+			ids[i] = strconv.Itoa(id)
+		}
+		params.Set("ids", strings.Join(ids, ","))
+	}
+	if query.Page > 1 {
+		params.Set("page", strconv.Itoa(query.Page))
+	}
+
+	var page Page
+	if err := c.get(ctx, c.baseURL+"/books/?"+params.Encode(), &page); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+// NextPage follows the Next link of a page, returning nil when there are no more pages
+func (c *Client) NextPage(ctx context.Context, page *Page) (*Page, error) {
+	if page == nil || page.Next == nil || *page.Next == "" {
+		return nil, nil
+	}
+
+	// Keep following links against the configured host (useful for testing and replay)
+	next, err := url.Parse(*page.Next)
+	if err != nil {
+		return nil, fmt.Errorf("invalid next link: %w", err)
+	}
+	base, _ := url.Parse(c.baseURL)
+	next.Scheme, next.Host = base.Scheme, base.Host
+
+	var nextPage Page
+	if err := c.get(ctx, next.String(), &nextPage); err != nil {
+		return nil, err
+	}
+	return &nextPage, nil
+}
+
+// Book returns a single book by its Gutenberg id
+func (c *Client) Book(ctx context.Context, id int) (*Book, error) {
+	var book Book
+	if err := c.get(ctx, fmt.Sprintf("%s/books/%d", c.baseURL, id), &book); err != nil {
+		return nil, err
+	}
+	return &book, nil
+}
+
+// Format returns the download URL for a format such as "epub", "mobi", "txt" or "html",
+// matching Gutendex's MIME type keys (which may carry charset suffixes)
+func (b *Book) Format(format string) (string, bool) {
+	mimeType, ok := FormatMimeTypes[format]
+	if !ok {
+		mimeType = format
+	}
+	if link, ok := b.Formats[mimeType]; ok {
+		return link, true
+	}
+
+	keys := make([]string, 0, len(b.Formats))
+	for key := range b.Formats {
+		if strings.HasPrefix(key, mimeType+";") {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		return "", false
+	}
+	// Prefer UTF-8 over other charsets, otherwise pick deterministically
+	sort.Slice(keys, func(i, j int) bool {
+		iUTF8, jUTF8 := strings.Contains(keys[i], "utf-8"), strings.Contains(keys[j], "utf-8")
+		if iUTF8 != jUTF8 {
+			return iUTF8
+		}
+		return keys[i] < keys[j]
+	})
+	return b.Formats[keys[0]], true
+}
+
+// FormatMimeTypes maps short format names to the MIME types Gutendex uses
+var FormatMimeTypes = map[string]string{
+	"epub":  "application/epub+zip",
+	"mobi":  "application/x-mobipocket-ebook",
+	"txt":   "text/plain",
+	"html":  "text/html",
+	"cover": "image/jpeg",
+}
@@ -0,0 +1,80 @@
+package gutendex
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSearchAndNextPage(t *testing.T) {
+	var queries []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.URL.RawQuery)
+		page := Page{Count: 2}
+		if r.URL.Query().Get("page") == "" {
+			// Next links point at the real host; the client must follow them against its base URL
+			next := "https://gutendex.com/books/?page=2&search=moby"
+			page.Next = &next
+			page.Results = []Book{{ID: 1, Title: "Moby Dick"}}
+		} else {
+			page.Results = []Book{{ID: 2, Title: "Moby Dick, Part Two"}}
+		}
+		json.NewEncoder(w).Encode(page)
+	}))
+	defer server.Close()
+
+	client := NewClient(WithBaseURL(server.URL + "/"))
+	first, err := client.Search(context.Background(), Query{Search: "moby", Languages: []string{"en", "fr"}})
+	require.NoError(t, err)
+	assert.Equal(t, "languages=en%2Cfr&search=moby", queries[0])
+	assert.Equal(t, 2, first.Count)
+	assert.Equal(t, "Moby Dick", first.Results[0].Title)
+
+	second, err := client.NextPage(context.Background(), first)
+	require.NoError(t, err)
+	assert.Equal(t, 2, second.Results[0].ID)
+
+	last, err := client.NextPage(context.Background(), second)
+	assert.NoError(t, err)
+	assert.Nil(t, last)
+}
+
+func TestSearch_ErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "boom", http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	_, err := NewClient(WithBaseURL(server.URL)).Search(context.Background(), Query{})
+	assert.ErrorContains(t, err, "502")
+}
+
+func TestBookFormat(t *testing.T) {
+	book := Book{Formats: map[string]string{
+		"application/epub+zip":           "https://example.com/1.epub",
+		"text/plain; charset=us-ascii":   "https://example.com/1.ascii.txt",
+		"text/plain; charset=utf-8":      "https://example.com/1.utf8.txt",
+		"text/html; charset=iso-8859-1":  "https://example.com/1.html",
+		"application/x-mobipocket-ebook": "https://example.com/1.mobi",
+	}}
+
+	link, ok := book.Format("epub")
+	assert.True(t, ok)
+	assert.Equal(t, "https://example.com/1.epub", link)
+
+	link, ok = book.Format("txt")
+	assert.True(t, ok)
+	assert.Equal(t, "https://example.com/1.utf8.txt", link)
+
+	link, ok = book.Format("html")
+	assert.True(t, ok)
+	assert.Equal(t, "https://example.com/1.html", link)
+
+	_, ok = book.Format("cover")
+	assert.False(t, ok)
+}
@@ -4,9 +4,24 @@ import (
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/rjhoppe/firelink/resilient"
 )
 
-// Healthcheck returns a JSON response with the status of the application
+// Healthcheck returns a JSON response with the status of the application.
+// Once upstream APIs have been called, their circuit breaker states are included
+// and the status is "degraded" while any breaker is open.
 func Healthcheck(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{"status": "ok", "message": "Firelink is running"})
+	body := gin.H{"status": "ok", "message": "Firelink is running"}
+
+	breakers := resilient.States()
+	if len(breakers) > 0 {
+		body["breakers"] = breakers
+		for _, breaker := range breakers {
+			if breaker.State != resilient.StateClosed {
+				body["status"] = "degraded"
+			}
+		}
+	}
+
+	c.JSON(http.StatusOK, body)
 }
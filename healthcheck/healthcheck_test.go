@@ -5,9 +5,12 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/rjhoppe/firelink/resilient"
 )
 
 func TestHealthcheck(t *testing.T) {
@@ -33,3 +36,37 @@ func TestHealthcheck(t *testing.T) {
 		t.Errorf("handler returned unexpected body: got %v want %v", actual, expected)
 	}
 }
+
+func TestHealthcheck_ReportsOpenBreakers(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer upstream.Close()
+
+	client := resilient.NewClient(nil, resilient.Options{MaxRetries: 1, BaseDelay: time.Millisecond, FailureThreshold: 1, Cooldown: time.Hour})
+	resp, err := client.Get(upstream.URL)
+	if err != nil {
+		t.Fatalf("unexpected error calling upstream: %v", err)
+	}
+	resp.Body.Close()
+
+	router := gin.Default()
+	router.GET("/healthcheck", Healthcheck)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/healthcheck", nil))
+
+	var actual struct {
+		Status   string                            `json:"status"`
+		Breakers map[string]resilient.BreakerState `json:"breakers"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &actual); err != nil {
+		t.Fatalf("could not unmarshal response: %v", err)
+	}
+	if actual.Status != "degraded" {
+		t.Errorf("expected degraded status, got %q", actual.Status)
+	}
+	host := strings.TrimPrefix(upstream.URL, "http://")
+	if actual.Breakers[host].State != resilient.StateOpen {
+		t.Errorf("expected open breaker for %s, got %+v", host, actual.Breakers)
+	}
+}
@@ -9,18 +9,39 @@ import (
 // Help returns a list of endpoints
 func Help(c *gin.Context) {
 	endpoints := map[string]string{
-		"GET /help":              "List of endpoints...",
-		"GET /healthcheck":       "Healthcheck endpoint for monitoring tools",
-		"GET /ebook/find/:title": "Check if a book exists in the Gutenberg project",
-		// "/ebook/dl/:title": "Download a book from the Gutenberg project",
-		"GET /dinner/random":           "Get three random dinner recipes",
-		"GET /dinner/recipe/:id":       "Get a specific recipe based on id",
-		"POST /dinner/cache/backup":    "Backup the dinner cache to a file",
-		"GET /bartender/random":        "Get a random cocktail recipe",
-		"POST /bartender/save":         "Save a cocktail recipe to the database",
-		"GET /bartender/history":       "Get the history of cocktails received",
-		"POST /bartender/cache/backup": "Backup the cocktail cache to a file",
-		"POST /database/backup":        "Backup the database to a file",
+		"GET /help":                       "List of endpoints...",
+		"GET /healthcheck":                "Healthcheck endpoint for monitoring tools",
+		"GET /metrics":                    "Prometheus metrics",
+		"GET /ebook/find/:title":          "Check if a book exists in the Gutenberg project (?lang=en,fr&format=epub,mobi)",
+		"GET /ebook/search":               "Search the Gutenberg project (?q=&author=&lang=&topic=&page=&pages=)",
+		"POST /ebook/download/:id":        "Download a Gutenberg book into the library (?format=epub|mobi|txt)",
+		"GET /ebook/library":              "List the books in the library",
+		"GET /ebook/library/:id/file":     "Download the file of a library book",
+		"GET /dinner/random":              "Get three random dinner recipes, including a custom one when available (?source=local for only custom recipes)",
+		"POST /dinner/recipe/:id/cooked":  "Mark a recipe as cooked so it is not suggested again soon",
+		"GET /dinner/search":              "Search recipes (?q=&cuisine=&diet=&intolerances=&type=&maxReadyTime=&number=&offset=)",
+		"GET /dinner/autocomplete":        "Suggest recipe titles (?q=&number=)",
+		"GET /dinner/recipe/:id/similar":  "Get recipes similar to a specific recipe (?number=)",
+		"GET /dinner/quota":               "Get the Spoonacular daily quota usage",
+		"GET /dinner/history":             "Get recently suggested and cooked recipes (?days=30)",
+		"GET /dinner/recipe/:id/export":   "Export a recipe, or a custom one by its local-<id> (?format=md|html|json)",
+		"GET /dinner/recipes":             "Get several recipes at once (?ids=1,2,local-3)",
+		"POST /dinner/recipes":            "Create a custom dinner recipe",
+		"GET /dinner/recipes/:id":         "Get a custom dinner recipe",
+		"PUT /dinner/recipes/:id":         "Update a custom dinner recipe",
+		"DELETE /dinner/recipes/:id":      "Delete a custom dinner recipe",
+		"GET /dinner/recipe/:id":          "Get a specific recipe based on id (local-<id> for custom recipes)",
+		"POST /dinner/cache/backup":       "Backup the dinner cache to a file",
+		"GET /bartender/random":           "Get a random cocktail recipe, sometimes a custom one (?source=local for only custom drinks)",
+		"GET /bartender/drink/:id/export": "Export a cocktail recipe by id or local- id (?format=md|html|json)",
+		"POST /bartender/drinks":          "Create a custom cocktail recipe",
+		"GET /bartender/drinks/:id":       "Get a custom cocktail recipe",
+		"PUT /bartender/drinks/:id":       "Update a custom cocktail recipe",
+		"DELETE /bartender/drinks/:id":    "Delete a custom cocktail recipe",
+		"POST /bartender/save":            "Save a cocktail recipe to the database",
+		"GET /bartender/history":          "Get the history of cocktails received",
+		"POST /bartender/cache/backup":    "Backup the cocktail cache to a file",
+		"POST /database/backup":           "Backup the database to a file",
 	}
 
 	c.JSON(http.StatusOK, gin.H{"body": endpoints})
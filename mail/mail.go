@@ -0,0 +1,207 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrNotConfigured is returned when SMTP_HOST is not set
+var ErrNotConfigured = errors.New("SMTP is not configured")
+
+// Attachment is a file sent along with a Message
+type Attachment struct {
+	Name        string
+	ContentType string
+	Data        []byte
+}
+
+// Message is a plain text email with optional attachments
+type Message struct {
+	To          []string
+	Subject     string
+	Body        string
+	Attachments []Attachment
+}
+
+// Sender delivers email messages
+type Sender interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// Config holds the SMTP server settings
+type Config struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+}
+
+// ConfigFromEnv reads SMTP_HOST, SMTP_PORT (default 587), SMTP_USERNAME, SMTP_PASSWORD
+// and SMTP_FROM (default SMTP_USERNAME)
+func ConfigFromEnv() Config {
+	config := Config{
+		Host:     os.Getenv("SMTP_HOST"),
+		Port:     587,
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+		From:     os.Getenv("SMTP_FROM"),
+	}
+	if port, err := strconv.Atoi(os.Getenv("SMTP_PORT")); err == nil {
+		config.Port = port
+	}
+	if config.From == "" {
+		config.From = config.Username
+	}
+	return config
+}
+
+// SMTPSender sends messages through an SMTP server, upgrading to TLS when the server offers STARTTLS
+type SMTPSender struct {
+	Config Config
+}
+
+// NewSMTPSender creates a Sender for the given configuration
+func NewSMTPSender(config Config) *SMTPSender {
+	return &SMTPSender{Config: config}
+}
+
+// Send implements Sender
+func (s *SMTPSender) Send(ctx context.Context, msg Message) error {
+	if s.Config.Host == "" {
+		return ErrNotConfigured
+	}
+	if len(msg.To) == 0 {
+		return errors.New("message has no recipients")
+	}
+	data, err := Build(s.Config.From, msg)
+	if err != nil {
+		return err
+	}
+
+	addr := net.JoinHostPort(s.Config.Host, strconv.Itoa(s.Config.Port))
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return fmt.Errorf("error connecting to SMTP server: %w", err)
+	}
+	// net/smtp is not context aware, so bound the whole exchange by the context deadline
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	} else {
+		conn.SetDeadline(time.Now().Add(2 * time.Minute))
+	}
+
+	client, err := smtp.NewClient(conn, s.Config.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("error starting SMTP session: %w", err)
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: s.Config.Host}); err != nil {
+			return fmt.Errorf("error starting TLS: %w", err)
+		}
+	}
+	if s.Config.Username != "" {
+		auth := smtp.PlainAuth("", s.Config.Username, s.Config.Password, s.Config.Host)
+		if err := client.Auth(auth); err != nil {
+			return fmt.Errorf("error authenticating: %w", err)
+		}
+	}
+
+	if err := client.Mail(s.Config.From); err != nil {
+		return fmt.Errorf("error setting sender: %w", err)
+	}
+	for _, to := range msg.To {
+		if err := client.Rcpt(to); err != nil {
+			return fmt.Errorf("error adding recipient %s: %w", to, err)
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("error starting message: %w", err)
+	}
+	if _, err := w.Write(data); err != nil {
+		return fmt.Errorf("error writing message: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("error sending message: %w", err)
+	}
+	return client.Quit()
+}
+
+// Build renders msg as a MIME message, base64 encoding any attachments
+func Build(from string, msg Message) ([]byte, error) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(msg.To, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+
+	if len(msg.Attachments) == 0 {
+		buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+		buf.WriteString(msg.Body)
+		return buf.Bytes(), nil
+	}
+
+	w := multipart.NewWriter(&buf)
+	fmt.Fprintf(&buf, "Content-Type: multipart/mixed; boundary=%s\r\n\r\n", w.Boundary())
+
+	part, err := w.CreatePart(textproto.MIMEHeader{"Content-Type": {"text/plain; charset=utf-8"}})
+	if err != nil {
+		return nil, err
+	}
+	part.Write([]byte(msg.Body))
+
+	for _, attachment := range msg.Attachments {
+		contentType := attachment.ContentType
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		part, err := w.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {contentType},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Name})},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := writeBase64(part, attachment.Data); err != nil {
+			return nil, err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeBase64 writes data base64 encoded in 76 character lines as required by RFC 2045
+func writeBase64(w io.Writer, data []byte) error {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for len(encoded) > 76 {
+		if _, err := fmt.Fprintf(w, "%s\r\n", encoded[:76]); err != nil {
+			return err
+		}
+		encoded = encoded[76:]
+	}
+	_, err := fmt.Fprintf(w, "%s\r\n", encoded)
+	return err
+}
@@ -0,0 +1,128 @@
+package mail
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSMTP is a minimal SMTP server that records the envelope and data of one message
+type fakeSMTP struct {
+	listener net.Listener
+	from     string
+	to       []string
+	data     string
+	done     chan struct{}
+}
+
+func newFakeSMTP(t *testing.T) *fakeSMTP {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	server := &fakeSMTP{listener: listener, done: make(chan struct{})}
+	t.Cleanup(func() { listener.Close() })
+	go server.serve()
+	return server
+}
+
+func (s *fakeSMTP) port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (s *fakeSMTP) serve() {
+	defer close(s.done)
+	conn, err := s.listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+	reply("220 localhost ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		command := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch command {
+		case "EHLO", "HELO":
+			reply("250 localhost")
+		case "MAIL":
+			s.from = strings.Trim(strings.TrimPrefix(line, "MAIL FROM:"), "<>")
+			reply("250 OK")
+		case "RCPT":
+			s.to = append(s.to, strings.Trim(strings.TrimPrefix(line, "RCPT TO:"), "<>"))
+			reply("250 OK")
+		case "DATA":
+			reply("354 Go ahead")
+			var data strings.Builder
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				data.WriteString(line)
+			}
+			s.data = data.String()
+			reply("250 OK")
+		case "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("502 Not implemented")
+		}
+	}
+}
+
+func TestSMTPSender_Send(t *testing.T) {
+	server := newFakeSMTP(t)
+	sender := NewSMTPSender(Config{Host: "127.0.0.1", Port: server.port(), From: "firelink@example.com"})
+
+	book := []byte(strings.Repeat("epub bytes ", 20))
+	err := sender.Send(context.Background(), Message{
+		To:          []string{"reader@kindle.com"},
+		Subject:     "Moby Dick",
+		Body:        "Enjoy!",
+		Attachments: []Attachment{{Name: "moby-dick.epub", ContentType: "application/epub+zip", Data: book}},
+	})
+	require.NoError(t, err)
+	<-server.done
+
+	assert.Equal(t, "firelink@example.com", server.from)
+	assert.Equal(t, []string{"reader@kindle.com"}, server.to)
+	assert.Contains(t, server.data, "Subject: Moby Dick")
+	assert.Contains(t, server.data, `Content-Disposition: attachment; filename=moby-dick.epub`)
+	assert.Contains(t, server.data, "Enjoy!")
+
+	// The attachment is base64 encoded in lines of at most 76 characters
+	encoded := base64.StdEncoding.EncodeToString(book)
+	assert.Contains(t, server.data, encoded[:76]+"\r\n"+encoded[76:152])
+}
+
+func TestSMTPSender_NotConfigured(t *testing.T) {
+	err := NewSMTPSender(Config{}).Send(context.Background(), Message{To: []string{"a@example.com"}})
+	assert.ErrorIs(t, err, ErrNotConfigured)
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	t.Setenv("SMTP_HOST", "smtp.example.com")
+	t.Setenv("SMTP_PORT", strconv.Itoa(2525))
+	t.Setenv("SMTP_USERNAME", "me@example.com")
+	t.Setenv("SMTP_FROM", "")
+
+	config := ConfigFromEnv()
+	assert.Equal(t, 2525, config.Port)
+	assert.Equal(t, "me@example.com", config.From)
+}
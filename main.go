@@ -1,23 +1,36 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
+	"github.com/rjhoppe/firelink/admin"
 	"github.com/rjhoppe/firelink/bartender"
 	"github.com/rjhoppe/firelink/books"
 	"github.com/rjhoppe/firelink/cache"
 	"github.com/rjhoppe/firelink/database"
+	"github.com/rjhoppe/firelink/gutendex"
 	"github.com/rjhoppe/firelink/healthcheck"
 	"github.com/rjhoppe/firelink/help"
+	"github.com/rjhoppe/firelink/mail"
+	"github.com/rjhoppe/firelink/metrics"
 	"github.com/rjhoppe/firelink/models"
 	"github.com/rjhoppe/firelink/ntfy"
+	"github.com/rjhoppe/firelink/outbox"
+	"github.com/rjhoppe/firelink/replay"
+	"github.com/rjhoppe/firelink/resilient"
 	"github.com/rjhoppe/firelink/spoonacularapi"
+	"github.com/rjhoppe/firelink/textindex"
+	"github.com/rjhoppe/firelink/utils"
 
 	"github.com/rjhoppe/firelink/dinner"
 )
@@ -29,6 +42,9 @@ func main() {
 		log.Println("No .env file found, using environment variables")
 	}
 
+	// Connect to the database and migrate the schema, exiting when it is unreachable
+	database.InitDB()
+
 	r := gin.Default()
 
 	// Initialize dinner client
@@ -37,17 +53,97 @@ func main() {
 		log.Println("WARNING - SPOONACULAR_API_KEY is empty!")
 	}
 
-	apiClient := spoonacularapi.NewClient(apiKey)
+	// FIRELINK_UPSTREAM=record|replay captures or replays all upstream traffic as fixtures
+	upstream := replay.FromEnv()
+
+	// Upstream APIs retry transient failures and share per-host circuit breakers.
+	// Each upstream has an overall deadline covering all retries of a call.
+	upstreamOptions := resilient.Options{}
+	spoonacularHTTP := resilient.NewClient(upstream, upstreamOptions)
+	spoonacularHTTP.Timeout = utils.GetEnvDuration("SPOONACULAR_TIMEOUT", 30*time.Second)
+	cocktailHTTP := resilient.NewClient(upstream, upstreamOptions)
+	cocktailHTTP.Timeout = utils.GetEnvDuration("COCKTAILDB_TIMEOUT", 15*time.Second)
+	gutendexHTTP := resilient.NewClient(upstream, upstreamOptions)
+	gutendexHTTP.Timeout = utils.GetEnvDuration("GUTENDEX_TIMEOUT", 30*time.Second)
+	gutendexClient := gutendex.NewClient(gutendex.WithHTTPClient(gutendexHTTP))
+	// Book files can be large, so downloads are bounded by size and idle time rather than
+	// a deadline, and are not retried mid-stream
+	downloadHTTP := &http.Client{Transport: upstream}
+	ntfy.SetHTTPClient(&http.Client{Transport: upstream, Timeout: utils.GetEnvDuration("NTFY_TIMEOUT", 10*time.Second)})
+	// NOTIFY_BACKENDS fans notifications out to ntfy, webhooks, Gotify, Discord, Slack, email or Matrix
+	if err := ntfy.Configure(ntfy.ConfigFromEnv()); err != nil {
+		log.Printf("WARNING - some notification backends are disabled: %v", err)
+	}
+	// Notifications are queued in the database and delivered in the background with retries
+	notificationPrefs, err := outbox.PreferencesFromEnv()
+	if err != nil {
+		log.Printf("WARNING - ignoring invalid notification preferences: %v", err)
+	}
+	notifications := outbox.New(&outbox.DBStore{}, notificationPrefs)
+	ntfy.SetQueue(notifications)
+	textIndex, err := textindex.Open(filepath.Join(books.LibraryDir(), "index"))
+	if err != nil {
+		log.Printf("WARNING - full-text search disabled: %v", err)
+	}
+	library := &books.Library{
+		Dir:        books.LibraryDir(),
+		Store:      &books.DBBooks{},
+		Gutendex:   gutendexClient,
+		HTTPClient: gutendexHTTP,
+
+		DownloadClient:      downloadHTTP,
+		MaxDownloadSize:     books.MaxDownloadSize(),
+		DownloadIdleTimeout: books.DownloadIdleTimeout(),
+
+		MaxUploadSize: books.MaxUploadSize(),
+		Index:         textIndex,
+
+		Devices:           &books.DBDevices{},
+		Mailer:            mail.NewSMTPSender(mail.ConfigFromEnv()),
+		Notifier:          ntfy.NewNotifier("books"),
+		MaxAttachmentSize: books.MaxAttachmentSize(),
+	}
+	bookPreferences := books.PreferencesFromEnv()
+	readingList := &books.ReadingList{Store: &books.DBReading{}, Gutendex: gutendexClient}
+	passages := &books.Passages{
+		Library:  library,
+		Reading:  readingList.Store,
+		State:    &books.DBPassages{},
+		Notifier: ntfy.NewNotifier("books"),
+		Words:    books.PassageWords(),
+		At:       books.PassageTime(),
+	}
+
+	quotaThreshold := float64(utils.GetEnvInt("SPOONACULAR_MIN_QUOTA_LEFT", 10))
+	apiClient := spoonacularapi.NewClient(apiKey,
+		spoonacularapi.WithHTTPClient(spoonacularHTTP),
+		spoonacularapi.WithQuotaThreshold(quotaThreshold),
+		spoonacularapi.WithLowQuotaHandler(func(q spoonacularapi.Quota) {
+			ntfy.NtfyQuotaLow(context.Background(), q.Used, q.Left, quotaThreshold, ntfy.NewNotifier("system"))
+		}),
+	)
+
+	metrics.RegisterGauge("firelink_spoonacular_quota_used", "Spoonacular quota points used today", func() float64 {
+		return apiClient.Quota().Used
+	})
+	metrics.RegisterGauge("firelink_spoonacular_quota_left", "Spoonacular quota points left today", func() float64 {
+		return apiClient.Quota().Left
+	})
 
 	adapter := &spoonacularapi.SpoonacularAdapter{
 		RealClient: apiClient,
 	}
 
+	dinnerHistory := &dinner.DBHistory{}
+
 	// Initialize drink service
 	drinkService := &bartender.DrinkService{}
 	drinkService.GetDrinkFunc = drinkService.GetDrink
 	drinkService.GatherIngredientsFunc = drinkService.GatherIngredients
 	drinkService.Notifier = ntfy.NewNotifier("drink")
+	drinkService.HTTPClient = cocktailHTTP
+	// Custom drinks are mixed into /bartender/random this often
+	drinkService.LocalShare = float64(utils.GetEnvInt("BARTENDER_LOCAL_PERCENT", 25)) / 100
 
 	var DrinkCache *cache.Cache[models.DrinkResponse]
 	var DinnerCache *cache.Cache[models.RecipeInfo]
@@ -83,23 +179,226 @@ func main() {
 		healthcheck.Healthcheck(c)
 	})
 
-	// Checks if a book exists in the Gutenberg project
+	// Prometheus metrics
+	r.GET("/metrics", func(c *gin.Context) {
+		metrics.Metrics(c)
+	})
+
+	// Checks if a book exists in the Gutenberg project in the preferred languages and formats
 	r.GET("/ebook/find/:title", func(c *gin.Context) {
 		title := c.Param("title")
-		books.CheckForBook(c, title)
+		books.CheckForBook(c, title, gutendexClient, bookPreferences)
 	})
 
-	// r.POST("/ebook/dl/:title", func(c *gin.Context) {
-	// 	title := c.Param("title")
-	// 	books.GetBook(c, title)
-	// })
+	// Searches Project Gutenberg and returns structured book records
+	r.GET("/ebook/search", func(c *gin.Context) {
+		books.SearchBooks(c, gutendexClient)
+	})
+
+	// Downloads a Gutenberg book into the local library
+	r.POST("/ebook/download/:id", func(c *gin.Context) {
+		library.DownloadBook(c, c.Param("id"))
+	})
+
+	// Uploads a personal epub, pdf or mobi into the local library
+	r.POST("/ebook/upload", func(c *gin.Context) {
+		library.UploadBook(c)
+	})
+
+	// Searches inside the plain-text books of the library
+	r.GET("/ebook/library/search", func(c *gin.Context) {
+		library.SearchText(c)
+	})
+
+	// Rebuilds the full-text index of the library
+	r.POST("/ebook/library/reindex", func(c *gin.Context) {
+		library.Reindex(c)
+	})
+
+	// Lists the books in the local library
+	r.GET("/ebook/library", func(c *gin.Context) {
+		library.GetLibrary(c)
+	})
+
+	// Serves the file of a library book
+	r.GET("/ebook/library/:id/file", func(c *gin.Context) {
+		library.GetLibraryFile(c, c.Param("id"))
+	})
+
+	// Serves the cached cover of a library book
+	r.GET("/ebook/library/:id/cover", func(c *gin.Context) {
+		library.GetCover(c, c.Param("id"))
+	})
+
+	// Re-reads the EPUB metadata and cover of a library book
+	r.POST("/ebook/library/:id/metadata", func(c *gin.Context) {
+		library.RefreshMetadata(c, c.Param("id"))
+	})
+
+	// Emails a library book to a registered e-reader
+	r.POST("/ebook/library/:id/send", func(c *gin.Context) {
+		library.SendToDevice(c, c.Param("id"))
+	})
+
+	// Registers, lists and removes e-reader email addresses
+	r.POST("/ebook/devices", func(c *gin.Context) {
+		library.CreateDevice(c)
+	})
+
+	r.GET("/ebook/devices", func(c *gin.Context) {
+		library.GetDevices(c)
+	})
+
+	r.DELETE("/ebook/devices/:id", func(c *gin.Context) {
+		library.DeleteDevice(c, c.Param("id"))
+	})
+
+	// OPDS catalog of the library for e-reader apps
+	r.GET("/opds", func(c *gin.Context) {
+		library.OPDSRoot(c)
+	})
+
+	r.GET("/opds/recent", func(c *gin.Context) {
+		library.OPDSRecent(c)
+	})
+
+	r.GET("/opds/all", func(c *gin.Context) {
+		library.OPDSAll(c)
+	})
+
+	r.GET("/opds/authors", func(c *gin.Context) {
+		library.OPDSAuthors(c)
+	})
+
+	r.GET("/opds/subjects", func(c *gin.Context) {
+		library.OPDSSubjects(c)
+	})
+
+	r.GET("/opds/search", func(c *gin.Context) {
+		library.OPDSSearch(c)
+	})
+
+	r.GET("/opds/opensearch.xml", func(c *gin.Context) {
+		library.OPDSOpenSearch(c)
+	})
+
+	// Reading list and progress tracking
+	r.POST("/ebook/reading", func(c *gin.Context) {
+		readingList.AddEntry(c)
+	})
+
+	r.GET("/ebook/reading", func(c *gin.Context) {
+		readingList.GetEntries(c)
+	})
+
+	r.PATCH("/ebook/reading/:id", func(c *gin.Context) {
+		readingList.UpdateProgress(c, c.Param("id"))
+	})
+
+	r.DELETE("/ebook/reading/:id", func(c *gin.Context) {
+		readingList.DeleteEntry(c, c.Param("id"))
+	})
+
+	// Yearly reading summary
+	r.GET("/ebook/reading/stats", func(c *gin.Context) {
+		readingList.GetStats(c)
+	})
+
+	// Daily reading passages from a reading list book
+	r.GET("/ebook/passage", func(c *gin.Context) {
+		passages.GetPassageState(c)
+	})
 
-	// Returns a random recipe
+	r.POST("/ebook/passage/pause", func(c *gin.Context) {
+		passages.PausePassages(c)
+	})
+
+	r.POST("/ebook/passage/resume", func(c *gin.Context) {
+		passages.ResumePassages(c)
+	})
+
+	r.POST("/ebook/passage/skip", func(c *gin.Context) {
+		passages.SkipPassage(c)
+	})
+
+	r.POST("/ebook/passage/send", func(c *gin.Context) {
+		passages.SendPassage(c)
+	})
+
+	r.PUT("/ebook/passage/book", func(c *gin.Context) {
+		passages.SetPassageBook(c)
+	})
+
+	// Returns three random recipes with a custom one mixed in, or only custom ones with ?source=local
 	r.GET("/dinner/random", func(c *gin.Context) {
-		dinner.GetRandomRecipes(c, adapter)
+		if c.Query("source") == models.SourceLocal {
+			dinner.GetRandomLocalRecipes(c)
+			return
+		}
+		dinner.GetRandomRecipes(c, adapter, dinnerHistory)
+	})
+
+	// Marks a recipe as cooked so it is not suggested again for a while
+	r.POST("/dinner/recipe/:id/cooked", func(c *gin.Context) {
+		dinner.RecordCooked(c, c.Param("id"), DinnerCache, dinnerHistory)
+	})
+
+	// Returns recently suggested and cooked recipes
+	r.GET("/dinner/history", func(c *gin.Context) {
+		dinner.GetHistory(c, dinnerHistory)
+	})
+
+	// Exports a specific recipe as md, html or json
+	r.GET("/dinner/recipe/:id/export", func(c *gin.Context) {
+		dinner.ExportRecipe(c, c.Param("id"), DinnerCache, adapter)
+	})
+
+	// Returns several recipes at once, fetching cache misses in one upstream call
+	r.GET("/dinner/recipes", func(c *gin.Context) {
+		dinner.GetRecipesBulk(c, DinnerCache, adapter)
+	})
+
+	// Creates a custom recipe with no upstream source
+	r.POST("/dinner/recipes", func(c *gin.Context) {
+		dinner.CreateRecipe(c)
+	})
+
+	// Returns a custom recipe
+	r.GET("/dinner/recipes/:id", func(c *gin.Context) {
+		dinner.GetLocalRecipe(c, c.Param("id"))
+	})
+
+	// Updates a custom recipe
+	r.PUT("/dinner/recipes/:id", func(c *gin.Context) {
+		dinner.UpdateRecipe(c, c.Param("id"))
+	})
+
+	// Deletes a custom recipe
+	r.DELETE("/dinner/recipes/:id", func(c *gin.Context) {
+		dinner.DeleteRecipe(c, c.Param("id"))
 	})
 
-	// Returns a specific recipe based on id
+	// Searches Spoonacular and custom recipes
+	r.GET("/dinner/search", func(c *gin.Context) {
+		dinner.SearchRecipes(c, adapter)
+	})
+
+	// Suggests recipe titles for a partial query
+	r.GET("/dinner/autocomplete", func(c *gin.Context) {
+		dinner.AutocompleteRecipes(c, adapter)
+	})
+
+	// Returns recipes similar to a specific recipe
+	r.GET("/dinner/recipe/:id/similar", func(c *gin.Context) {
+		dinner.GetSimilarRecipes(c, c.Param("id"), adapter)
+	})
+
+	// Returns the Spoonacular daily quota usage
+	r.GET("/dinner/quota", func(c *gin.Context) {
+		dinner.GetQuota(c, adapter)
+	})
+
+	// Returns a specific recipe based on id, or a custom recipe by its local- id
 	r.GET("/dinner/recipe/:id", func(c *gin.Context) {
 		id := c.Param("id")
 		dinner.GetRecipeFromApi(c, id, DinnerCache, adapter)
@@ -115,11 +414,40 @@ func main() {
 		}
 	})
 
-	// Returns a random drink
+	// Returns a random drink, sometimes a custom one, or always a custom one with ?source=local
 	r.GET("/bartender/random", func(c *gin.Context) {
+		if c.Query("source") == models.SourceLocal {
+			drinkService.GetRandomLocalDrink(c, DrinkCache)
+			return
+		}
 		drinkService.GetRandomDrinkFromApi("", c, DrinkCache)
 	})
 
+	// Exports a drink by CocktailDB or local- id as md, html or json
+	r.GET("/bartender/drink/:id/export", func(c *gin.Context) {
+		drinkService.ExportDrink(c.Param("id"), c, DrinkCache)
+	})
+
+	// Creates a custom drink with no upstream source
+	r.POST("/bartender/drinks", func(c *gin.Context) {
+		drinkService.CreateDrink(c)
+	})
+
+	// Returns a custom drink
+	r.GET("/bartender/drinks/:id", func(c *gin.Context) {
+		drinkService.GetLocalDrink(c, c.Param("id"))
+	})
+
+	// Updates a custom drink
+	r.PUT("/bartender/drinks/:id", func(c *gin.Context) {
+		drinkService.UpdateDrink(c, c.Param("id"))
+	})
+
+	// Deletes a custom drink
+	r.DELETE("/bartender/drinks/:id", func(c *gin.Context) {
+		drinkService.DeleteDrink(c, c.Param("id"))
+	})
+
 	// Saves last drink recipe to DB
 	r.POST("/bartender/save", func(c *gin.Context) {
 		drinkService.SaveDrinkToDB(c, DrinkCache)
@@ -147,10 +475,58 @@ func main() {
 		}
 	})
 
+	// Exports drinks, dinners and cache snapshots as versioned JSON
+	r.GET("/admin/export", func(c *gin.Context) {
+		admin.Export(c, DrinkCache, DinnerCache)
+	})
+
+	// Imports an exported dataset, ?dry_run=true reports changes without writing
+	r.POST("/admin/import", func(c *gin.Context) {
+		admin.Import(c, DrinkCache, DinnerCache)
+	})
+
+	// Lists queued, sent and dead-lettered notifications (?status=&limit=)
+	r.GET("/admin/notifications", func(c *gin.Context) {
+		notifications.ListNotifications(c)
+	})
+
+	// Replays every dead-lettered notification
+	r.POST("/admin/notifications/replay", func(c *gin.Context) {
+		notifications.ReplayDead(c)
+	})
+
+	// Shows the quiet hours, rate limit, de-duplication and digest settings of each topic
+	r.GET("/admin/notifications/preferences", func(c *gin.Context) {
+		notifications.GetPreferences(c)
+	})
+
+	// Lists the notification message templates and whether they are overridden
+	r.GET("/admin/notifications/templates", func(c *gin.Context) {
+		ntfy.ListTemplates(c)
+	})
+
+	// Renders a template against sample data, or a POSTed template body in its place
+	r.GET("/admin/notifications/templates/:name/preview", func(c *gin.Context) {
+		ntfy.PreviewTemplate(c, c.Param("name"))
+	})
+	r.POST("/admin/notifications/templates/:name/preview", func(c *gin.Context) {
+		ntfy.PreviewTemplate(c, c.Param("name"))
+	})
+
+	// Returns a notification with its attempts and last error
+	r.GET("/admin/notifications/:id", func(c *gin.Context) {
+		notifications.GetNotification(c, c.Param("id"))
+	})
+
+	// Queues a notification for delivery again
+	r.POST("/admin/notifications/:id/replay", func(c *gin.Context) {
+		notifications.ReplayNotification(c, c.Param("id"))
+	})
+
 	// backup database
 	r.POST("/database/backup", func(c *gin.Context) {
 		timestamp := time.Now().Format("2006-01-02_15-04-05")
-		err := database.BackupDB("db_backup_" + timestamp + ".sql")
+		err := database.BackupDB(c.Request.Context(), "db_backup_"+timestamp+".sql")
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		} else {
@@ -158,5 +534,28 @@ func main() {
 		}
 	})
 
-	r.Run(":8080")
+	// ctx stops the background jobs; in-flight requests are drained by Shutdown below
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go passages.Run(ctx)
+	go notifications.Run(ctx)
+
+	srv := &http.Server{
+		Addr:    ":8080",
+		Handler: r,
+	}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("server error: %v", err)
+		}
+	}()
+
+	<-ctx.Done()
+	log.Println("Shutting down...")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Error during shutdown: %v", err)
+	}
 }
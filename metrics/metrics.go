@@ -0,0 +1,55 @@
+package metrics
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// gauge is a metric whose value is read when the metrics endpoint is scraped
+type gauge struct {
+	help  string
+	value func() float64
+}
+
+var (
+	mu     sync.Mutex
+	gauges = map[string]gauge{}
+)
+
+// RegisterGauge adds (or replaces) a gauge reported by the metrics endpoint
+func RegisterGauge(name, help string, value func() float64) {
+	mu.Lock()
+	defer mu.Unlock()
+	gauges[name] = gauge{help: help, value: value}
+}
+
+// Render writes all registered gauges in the Prometheus text exposition format
+func Render() string {
+	mu.Lock()
+	defer mu.Unlock()
+
+	names := make([]string, 0, len(gauges))
+	for name := range gauges {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		g := gauges[name]
+		fmt.Fprintf(&b, "# HELP %s %s\n", name, g.help)
+		fmt.Fprintf(&b, "# TYPE %s gauge\n", name)
+		fmt.Fprintf(&b, "%s %v\n", name, g.value())
+	}
+	return b.String()
+}
+
+// Metrics serves the registered gauges for Prometheus to scrape
+func Metrics(c *gin.Context) {
+	c.Data(http.StatusOK, "text/plain; version=0.0.4; charset=utf-8", []byte(Render()))
+}
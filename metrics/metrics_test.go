@@ -0,0 +1,21 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRender(t *testing.T) {
+	RegisterGauge("firelink_test_b", "Second gauge", func() float64 { return 2.5 })
+	RegisterGauge("firelink_test_a", "First gauge", func() float64 { return 1 })
+
+	expected := `# HELP firelink_test_a First gauge
+# TYPE firelink_test_a gauge
+firelink_test_a 1
+# HELP firelink_test_b Second gauge
+# TYPE firelink_test_b gauge
+firelink_test_b 2.5
+`
+	assert.Equal(t, expected, Render())
+}
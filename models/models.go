@@ -1,9 +1,21 @@
 package models
 
 import (
+	"time"
+
 	"gorm.io/gorm"
 )
 
+// Sources a Dinner or Drink record can come from
+const (
+	SourceApi   = "api"
+	SourceLocal = "local"
+)
+
+// LocalIdPrefix marks the ids of locally authored recipes and drinks, such as "local-7",
+// keeping them apart from the ids of the upstream APIs
+const LocalIdPrefix = "local-"
+
 type Dinner struct {
 	gorm.Model
 	Title        string
@@ -11,6 +23,8 @@ type Dinner struct {
 	Url          string
 	Instructions string
 	Ingredients  string
+	Source       string `gorm:"default:api"`
+	OriginKey    string `gorm:"index"` // key of a local recipe imported from another instance
 }
 
 type Drink struct {
@@ -21,6 +35,141 @@ type Drink struct {
 	Glass        string
 	Ingredients  string
 	Instructions string
+	Source       string `gorm:"default:api"`
+	OriginKey    string `gorm:"index"` // key of a local drink imported from another instance
+}
+
+// Events recorded in the dinner history
+const (
+	HistorySuggested = "suggested"
+	HistoryCooked    = "cooked"
+)
+
+// DinnerHistory records when a recipe was suggested or cooked
+type DinnerHistory struct {
+	gorm.Model
+	RecipeId int32  `gorm:"index"`
+	Source   string `gorm:"default:api"` // SourceLocal when RecipeId is a local recipe
+	Title    string
+	Event    string
+	At       time.Time `gorm:"index"`
+}
+
+// ListSeparator joins the subjects and identifiers stored on a Book
+const ListSeparator = "; "
+
+// Book is an ebook stored in the local library
+type Book struct {
+	gorm.Model
+	GutenbergId int    `gorm:"index" json:"gutenberg_id"`
+	Title       string `json:"title"`
+	Author      string `json:"author"`
+	Language    string `json:"language"`
+	Subjects    string `json:"subjects"` // separated by ListSeparator
+	Description string `json:"description,omitempty"`
+	Publisher   string `json:"publisher,omitempty"`
+	Identifiers string `json:"identifiers,omitempty"` // separated by ListSeparator
+	CoverFile   string `json:"cover_file,omitempty"`
+	Format      string `json:"format"`
+	FileName    string `json:"file_name"`
+	Size        int64  `json:"size"`
+	Sha256      string `gorm:"index" json:"sha256"`
+}
+
+// Device is an e-reader that accepts books by email
+type Device struct {
+	gorm.Model
+	User  string `gorm:"index" json:"user"`
+	Name  string `json:"name"`
+	Email string `json:"email"`
+	Kind  string `json:"kind"`
+}
+
+// DeviceRequest is the body accepted when registering a device
+type DeviceRequest struct {
+	User  string `json:"user" binding:"required"`
+	Name  string `json:"name" binding:"required"`
+	Email string `json:"email" binding:"required,email"`
+	Kind  string `json:"kind" binding:"omitempty,oneof=kindle kobo other"`
+}
+
+// SendBookRequest is the body accepted when sending a book to a device
+type SendBookRequest struct {
+	DeviceId uint `json:"device_id" binding:"required"`
+}
+
+// States of a reading list entry
+const (
+	ReadingWantToRead = "want-to-read"
+	ReadingReading    = "reading"
+	ReadingFinished   = "finished"
+)
+
+// ReadingEntry tracks a book on the reading list, either from Gutenberg or added manually
+type ReadingEntry struct {
+	gorm.Model
+	GutenbergId *int       `gorm:"index" json:"gutenberg_id,omitempty"`
+	Title       string     `json:"title"`
+	Author      string     `json:"author"`
+	Status      string     `gorm:"index" json:"status"`
+	Progress    int        `json:"progress"`
+	Rating      *int       `json:"rating,omitempty"`
+	Pages       int        `json:"pages"`
+	Words       int        `json:"words"`
+	StartedAt   *time.Time `json:"started_at,omitempty"`
+	FinishedAt  *time.Time `gorm:"index" json:"finished_at,omitempty"`
+	// PassageOffset is how far into the book's text daily passages have reached
+	PassageOffset int `json:"passage_offset"`
+}
+
+// PassageState is the single row tracking which book daily passages are sent from
+type PassageState struct {
+	gorm.Model
+	EntryId    uint       `json:"entry_id"`
+	Paused     bool       `json:"paused"`
+	LastSentAt *time.Time `json:"last_sent_at,omitempty"`
+}
+
+// PassageBookRequest is the body accepted when changing the book passages come from
+type PassageBookRequest struct {
+	EntryId uint `json:"entry_id" binding:"required"`
+}
+
+// ReadingEntryRequest is the body accepted when adding a book to the reading list.
+// Title is looked up from Gutenberg when only gutenberg_id is given.
+type ReadingEntryRequest struct {
+	GutenbergId *int   `json:"gutenberg_id" binding:"required_without=Title"`
+	Title       string `json:"title"`
+	Author      string `json:"author"`
+	Status      string `json:"status" binding:"omitempty,oneof=want-to-read reading finished"`
+	Pages       int    `json:"pages" binding:"min=0"`
+	Words       int    `json:"words" binding:"min=0"`
+}
+
+// ReadingProgressRequest is the body accepted when updating a reading list entry
+type ReadingProgressRequest struct {
+	Status   *string `json:"status" binding:"omitempty,oneof=want-to-read reading finished"`
+	Progress *int    `json:"progress" binding:"omitempty,min=0,max=100"`
+	Rating   *int    `json:"rating" binding:"omitempty,min=1,max=5"`
+	Pages    *int    `json:"pages" binding:"omitempty,min=0"`
+	Words    *int    `json:"words" binding:"omitempty,min=0"`
+}
+
+// DinnerRequest is the body accepted when authoring a local recipe
+type DinnerRequest struct {
+	Title        string `json:"title" binding:"required"`
+	Url          string `json:"url" binding:"omitempty,url"`
+	Instructions string `json:"instructions" binding:"required"`
+	Ingredients  string `json:"ingredients" binding:"required"`
+}
+
+// DrinkRequest is the body accepted when authoring a local drink
+type DrinkRequest struct {
+	Name         string `json:"name" binding:"required"`
+	Category     string `json:"category"`
+	Glass        string `json:"glass"`
+	Ingredients  string `json:"ingredients" binding:"required"`
+	Instructions string `json:"instructions" binding:"required"`
 }
 
 type DrinkResponse struct {
@@ -31,6 +180,7 @@ type DrinkResponse struct {
 	Glass        string `json:"glass"`
 	Ingredients  string `json:"ingredients"`
 	Instructions string `json:"instructions"`
+	Source       string `json:"source,omitempty"`
 }
 
 type GetRandomDrinkAPI struct {
@@ -86,4 +236,34 @@ type RecipeInfo struct {
 	Url          string `json:"url"`
 	Instructions string `json:"instructions"`
 	Ingredients  string `json:"ingredients"`
+	Source       string `json:"source,omitempty"`
+}
+
+// Notification outbox statuses
+const (
+	NotificationPending = "pending"
+	NotificationSending = "sending"
+	NotificationSent    = "sent"
+	NotificationDead    = "dead"
+	// NotificationHeld notifications wait for their topic's digest, and are
+	// NotificationDigested once it has been queued
+	NotificationHeld     = "held"
+	NotificationDigested = "digested"
+)
+
+// Notification is a notification waiting in, or delivered from, the outbox
+type Notification struct {
+	gorm.Model
+	Topic         string     `gorm:"index" json:"topic"`
+	Title         string     `json:"title"`
+	Body          string     `json:"body"`
+	Options       string     `json:"options,omitempty"` // JSON encoded publish options such as priority and actions
+	File          string     `json:"file,omitempty"`
+	Key           string     `gorm:"index" json:"key"` // checksum of the content, used to drop duplicates
+	Status        string     `gorm:"index" json:"status"`
+	Attempts      int        `json:"attempts"`
+	NextAttemptAt time.Time  `gorm:"index" json:"next_attempt_at"`
+	LastError     string     `json:"last_error,omitempty"`
+	Delivered     string     `json:"delivered,omitempty"` // comma separated backends that received it, skipped by retries
+	SentAt        *time.Time `json:"sent_at,omitempty"`
 }
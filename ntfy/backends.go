@@ -0,0 +1,260 @@
+package ntfy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/rjhoppe/firelink/mail"
+	"github.com/rjhoppe/firelink/utils"
+)
+
+// Backend is a named Notifier that notifications fan out to
+type Backend struct {
+	Name     string
+	Notifier Notifier
+}
+
+// MultiNotifier sends every notification to all of its backends. A failing backend
+// does not stop the others; their errors are joined.
+type MultiNotifier struct {
+	Backends []Backend
+}
+
+func (m *MultiNotifier) SendMessage(ctx context.Context, title, message string) error {
+	return m.Publish(ctx, Message{Title: title, Body: message})
+}
+
+// fanOut calls send for every backend and returns the names of those it succeeded for.
+// Backends unable to deliver files are skipped rather than counted as failed.
+func fanOut(backends []Backend, send func(Notifier) error) ([]string, error) {
+	var delivered []string
+	var errs []error
+	for _, backend := range backends {
+		err := send(backend.Notifier)
+		switch {
+		case err == nil:
+			delivered = append(delivered, backend.Name)
+		case !errors.Is(err, ErrFileNotSupported):
+			errs = append(errs, fmt.Errorf("%s: %w", backend.Name, err))
+		}
+	}
+	return delivered, errors.Join(errs...)
+}
+
+// Publish sends msg to every backend, with its options to those that support them
+func (m *MultiNotifier) Publish(ctx context.Context, msg Message) error {
+	_, err := fanOut(m.Backends, func(n Notifier) error { return publish(ctx, n, msg) })
+	return err
+}
+
+// SendFile sends the file to every backend able to deliver files, and fails when none can
+// so the file is not silently dropped
+func (m *MultiNotifier) SendFile(ctx context.Context, fileLoc string) error {
+	delivered, err := fanOut(m.Backends, func(n Notifier) error { return n.SendFile(ctx, fileLoc) })
+	if err == nil && len(delivered) == 0 {
+		return ErrFileNotSupported
+	}
+	return err
+}
+
+// Config selects the backends notifications are sent to and holds their settings
+type Config struct {
+	Backends []string
+
+	NtfyServer   string
+	NtfyToken    string
+	NtfyUsername string
+	NtfyPassword string
+	NtfyDefaults TopicOptions            // publish options of every topic
+	NtfyTopics   map[string]TopicOptions // per topic overrides of NtfyDefaults
+
+	// TemplateDir holds message template overrides
+	TemplateDir string
+
+	// PublicURL is where firelink is reachable from the phone, used by action buttons
+	PublicURL string
+
+	WebhookURL string
+
+	GotifyURL      string
+	GotifyToken    string
+	GotifyPriority int
+
+	DiscordWebhookURL string
+	SlackWebhookURL   string
+
+	EmailTo []string
+	Mailer  mail.Sender
+
+	MatrixHomeserver string
+	MatrixToken      string
+	MatrixRoomID     string
+}
+
+// config is used by NewNotifier; only ntfy is enabled until Configure is called
+var config = Config{Backends: []string{"ntfy"}, NtfyServer: DefaultServer}
+
+// Topics are the ntfy topics firelink publishes to
+var Topics = []string{"dinner", "drink", "books", "system"}
+
+// priorities maps ntfy's priority names to their numbers
+var priorities = map[string]int{"min": 1, "low": 2, "default": 3, "high": 4, "max": 5, "urgent": 5}
+
+// parsePriority reads a priority given as a number from 1 to 5 or by name
+func parsePriority(value string) int {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if priority, ok := priorities[value]; ok {
+		return priority
+	}
+	if priority, err := strconv.Atoi(value); err == nil && priority >= 1 && priority <= 5 {
+		return priority
+	}
+	return 0
+}
+
+// topicOptionsFromEnv reads the publish options under prefix, such as NTFY_PRIORITY or NTFY_DINNER_PRIORITY
+func topicOptionsFromEnv(prefix string) TopicOptions {
+	return TopicOptions{
+		Priority: parsePriority(os.Getenv(prefix + "_PRIORITY")),
+		Tags:     splitList(os.Getenv(prefix + "_TAGS")),
+		Click:    os.Getenv(prefix + "_CLICK"),
+		Icon:     os.Getenv(prefix + "_ICON"),
+		Actions:  parseActions(os.Getenv(prefix + "_ACTIONS")),
+	}
+}
+
+// splitList splits a comma separated list, dropping empty items
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// ConfigFromEnv reads NOTIFY_BACKENDS (comma separated, default "ntfy") and the settings
+// of each backend. The email backend sends through the SMTP_* server and needs SMTP_HOST. ntfy publish options
+// are read from NTFY_PRIORITY, NTFY_TAGS, NTFY_CLICK, NTFY_ICON and NTFY_ACTIONS, and per topic from
+// variables such as NTFY_DINNER_PRIORITY.
+func ConfigFromEnv() Config {
+	config := Config{
+		Backends:          splitList(strings.ToLower(os.Getenv("NOTIFY_BACKENDS"))),
+		NtfyServer:        os.Getenv("NTFY_SERVER"),
+		NtfyToken:         os.Getenv("NTFY_TOKEN"),
+		NtfyUsername:      os.Getenv("NTFY_USERNAME"),
+		NtfyPassword:      os.Getenv("NTFY_PASSWORD"),
+		NtfyDefaults:      topicOptionsFromEnv("NTFY"),
+		NtfyTopics:        map[string]TopicOptions{},
+		TemplateDir:       os.Getenv("NTFY_TEMPLATE_DIR"),
+		PublicURL:         strings.TrimSuffix(os.Getenv("FIRELINK_PUBLIC_URL"), "/"),
+		WebhookURL:        os.Getenv("NOTIFY_WEBHOOK_URL"),
+		GotifyURL:         os.Getenv("GOTIFY_URL"),
+		GotifyToken:       os.Getenv("GOTIFY_TOKEN"),
+		GotifyPriority:    utils.GetEnvInt("GOTIFY_PRIORITY", 5),
+		DiscordWebhookURL: os.Getenv("DISCORD_WEBHOOK_URL"),
+		SlackWebhookURL:   os.Getenv("SLACK_WEBHOOK_URL"),
+		EmailTo:           splitList(os.Getenv("NOTIFY_EMAIL_TO")),
+		MatrixHomeserver:  os.Getenv("MATRIX_HOMESERVER"),
+		MatrixToken:       os.Getenv("MATRIX_TOKEN"),
+		MatrixRoomID:      os.Getenv("MATRIX_ROOM_ID"),
+	}
+	if smtp := mail.ConfigFromEnv(); smtp.Host != "" {
+		config.Mailer = mail.NewSMTPSender(smtp)
+	}
+	if len(config.Backends) == 0 {
+		config.Backends = []string{"ntfy"}
+	}
+	if config.NtfyServer == "" {
+		config.NtfyServer = DefaultServer
+	}
+	for _, topic := range Topics {
+		config.NtfyTopics[topic] = topicOptionsFromEnv("NTFY_" + strings.ToUpper(topic))
+	}
+	return config
+}
+
+// validate checks that a backend is known and has the settings it needs
+func (c Config) validate(backend string) error {
+	missing := func(settings ...string) error {
+		for i := 0; i < len(settings); i += 2 {
+			if settings[i+1] == "" {
+				return fmt.Errorf("%s backend needs %s", backend, settings[i])
+			}
+		}
+		return nil
+	}
+	switch backend {
+	case "ntfy":
+		return nil
+	case "webhook":
+		return missing("NOTIFY_WEBHOOK_URL", c.WebhookURL)
+	case "gotify":
+		return missing("GOTIFY_URL", c.GotifyURL, "GOTIFY_TOKEN", c.GotifyToken)
+	case "discord":
+		return missing("DISCORD_WEBHOOK_URL", c.DiscordWebhookURL)
+	case "slack":
+		return missing("SLACK_WEBHOOK_URL", c.SlackWebhookURL)
+	case "email":
+		if c.Mailer == nil {
+			return errors.New("email backend needs SMTP_HOST")
+		}
+		return missing("NOTIFY_EMAIL_TO", strings.Join(c.EmailTo, ","))
+	case "matrix":
+		return missing("MATRIX_HOMESERVER", c.MatrixHomeserver, "MATRIX_TOKEN", c.MatrixToken, "MATRIX_ROOM_ID", c.MatrixRoomID)
+	}
+	return fmt.Errorf("unknown notification backend %q", backend)
+}
+
+// Configure selects the backends used by notifiers created with NewNotifier. Backends
+// that are unknown or missing settings are left out and reported in the error; if none
+// are left, notifications keep going to ntfy.
+func Configure(c Config) error {
+	var errs []error
+	var backends []string
+	for _, backend := range c.Backends {
+		if err := c.validate(backend); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		backends = append(backends, backend)
+	}
+	if len(backends) == 0 {
+		backends = []string{"ntfy"}
+	}
+	c.Backends = backends
+	config = c
+	return errors.Join(errs...)
+}
+
+// newBackend creates the notifier for one configured backend
+func (c Config) newBackend(backend, topic string) Notifier {
+	switch backend {
+	case "webhook":
+		return &WebhookNotifier{URL: c.WebhookURL, Topic: topic, Client: httpClient}
+	case "gotify":
+		return &GotifyNotifier{URL: c.GotifyURL, Token: c.GotifyToken, Priority: c.GotifyPriority, Client: httpClient}
+	case "discord":
+		return &DiscordNotifier{URL: c.DiscordWebhookURL, Client: httpClient}
+	case "slack":
+		return &SlackNotifier{URL: c.SlackWebhookURL, Client: httpClient}
+	case "email":
+		return &EmailNotifier{Sender: c.Mailer, To: c.EmailTo, Topic: topic}
+	case "matrix":
+		return &MatrixNotifier{Homeserver: c.MatrixHomeserver, Token: c.MatrixToken, RoomID: c.MatrixRoomID, Client: httpClient}
+	}
+	return &NtfyNotifier{
+		Topic:    topic,
+		Client:   httpClient,
+		Server:   c.NtfyServer,
+		Token:    c.NtfyToken,
+		Username: c.NtfyUsername,
+		Password: c.NtfyPassword,
+		Options:  c.NtfyDefaults.merge(c.NtfyTopics[topic]),
+	}
+}
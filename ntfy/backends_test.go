@@ -0,0 +1,285 @@
+package ntfy
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rjhoppe/firelink/mail"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordedRequest is one request received by a stand-in server
+type recordedRequest struct {
+	Method string
+	Path   string
+	Header http.Header
+	Body   string
+}
+
+// newStandIn starts an HTTP server that records requests and answers with response
+func newStandIn(t *testing.T, response string) (*httptest.Server, *[]recordedRequest) {
+	var requests []recordedRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests = append(requests, recordedRequest{Method: r.Method, Path: r.URL.RequestURI(), Header: r.Header, Body: string(body)})
+		w.Write([]byte(response))
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func decodeBody(t *testing.T, request recordedRequest) map[string]any {
+	var body map[string]any
+	require.NoError(t, json.Unmarshal([]byte(request.Body), &body))
+	return body
+}
+
+func writeBackup(t *testing.T) string {
+	path := filepath.Join(t.TempDir(), "backup.sql")
+	require.NoError(t, os.WriteFile(path, []byte("-- dump"), 0644))
+	return path
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	server, requests := newStandIn(t, "")
+	notifier := &WebhookNotifier{URL: server.URL + "/hook", Topic: "dinner", Client: server.Client()}
+
+	require.NoError(t, notifier.SendMessage(context.Background(), "Recipe", "Pasta"))
+	require.NoError(t, notifier.SendFile(context.Background(), writeBackup(t)))
+
+	require.Len(t, *requests, 2)
+	assert.Equal(t, map[string]any{"topic": "dinner", "title": "Recipe", "message": "Pasta"}, decodeBody(t, (*requests)[0]))
+	assert.Contains(t, (*requests)[1].Header.Get("Content-Type"), "multipart/form-data")
+	assert.Contains(t, (*requests)[1].Body, "-- dump")
+}
+
+func TestGotifyNotifier(t *testing.T) {
+	server, requests := newStandIn(t, "{}")
+	notifier := &GotifyNotifier{URL: server.URL + "/", Token: "app-token", Priority: 5, Client: server.Client()}
+
+	require.NoError(t, notifier.SendMessage(context.Background(), "Recipe", "Pasta"))
+	assert.ErrorIs(t, notifier.SendFile(context.Background(), writeBackup(t)), ErrFileNotSupported)
+
+	require.Len(t, *requests, 1)
+	assert.Equal(t, "/message", (*requests)[0].Path)
+	assert.Equal(t, "app-token", (*requests)[0].Header.Get("X-Gotify-Key"))
+	assert.Equal(t, map[string]any{"title": "Recipe", "message": "Pasta", "priority": float64(5)}, decodeBody(t, (*requests)[0]))
+}
+
+func TestChatWebhookNotifiers(t *testing.T) {
+	server, requests := newStandIn(t, "")
+	discord := &DiscordNotifier{URL: server.URL + "/discord", Client: server.Client()}
+	slack := &SlackNotifier{URL: server.URL + "/slack", Client: server.Client()}
+
+	require.NoError(t, discord.SendMessage(context.Background(), "Recipe", "Pasta"))
+	require.NoError(t, discord.SendFile(context.Background(), writeBackup(t)))
+	require.NoError(t, slack.SendMessage(context.Background(), "Recipe", "Pasta"))
+	assert.ErrorIs(t, slack.SendFile(context.Background(), writeBackup(t)), ErrFileNotSupported)
+
+	require.Len(t, *requests, 3)
+	assert.Equal(t, map[string]any{"content": "**Recipe**\nPasta"}, decodeBody(t, (*requests)[0]))
+	assert.Contains(t, (*requests)[1].Body, `name="files[0]"; filename="backup.sql"`)
+	assert.Equal(t, map[string]any{"text": "*Recipe*\nPasta"}, decodeBody(t, (*requests)[2]))
+}
+
+func TestMatrixNotifier(t *testing.T) {
+	server, requests := newStandIn(t, `{"content_uri": "mxc://example.org/abc"}`)
+	notifier := &MatrixNotifier{Homeserver: server.URL, Token: "secret", RoomID: "!room:example.org", Client: server.Client()}
+
+	require.NoError(t, notifier.SendMessage(context.Background(), "Recipe", "Pasta & <salad>"))
+	require.NoError(t, notifier.SendFile(context.Background(), writeBackup(t)))
+
+	require.Len(t, *requests, 3)
+	message := (*requests)[0]
+	assert.Equal(t, "PUT", message.Method)
+	assert.True(t, strings.HasPrefix(message.Path, "/_matrix/client/v3/rooms/%21room:example.org/send/m.room.message/"))
+	assert.Equal(t, "Bearer secret", message.Header.Get("Authorization"))
+	body := decodeBody(t, message)
+	assert.Equal(t, "Recipe\n\nPasta & <salad>", body["body"])
+	assert.Equal(t, "<strong>Recipe</strong><br>Pasta &amp; &lt;salad&gt;", body["formatted_body"])
+
+	assert.Equal(t, "/_matrix/media/v3/upload?filename=backup.sql", (*requests)[1].Path)
+	file := decodeBody(t, (*requests)[2])
+	assert.Equal(t, "m.file", file["msgtype"])
+	assert.Equal(t, "mxc://example.org/abc", file["url"])
+}
+
+// newSMTPStandIn accepts SMTP sessions and records the message data
+func newSMTPStandIn(t *testing.T) (int, *[]string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	var messages []string
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			r := bufio.NewReader(conn)
+			conn.Write([]byte("220 localhost\r\n"))
+			var data strings.Builder
+			inData := false
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					break
+				}
+				if inData {
+					if line == ".\r\n" {
+						inData = false
+						messages = append(messages, data.String())
+						conn.Write([]byte("250 OK\r\n"))
+					} else {
+						data.WriteString(line)
+					}
+					continue
+				}
+				switch strings.ToUpper(strings.Fields(line + " x")[0]) {
+				case "DATA":
+					inData = true
+					conn.Write([]byte("354 go ahead\r\n"))
+				case "QUIT":
+					conn.Write([]byte("221 bye\r\n"))
+				default:
+					conn.Write([]byte("250 OK\r\n"))
+				}
+			}
+			conn.Close()
+		}
+	}()
+	return listener.Addr().(*net.TCPAddr).Port, &messages
+}
+
+func TestEmailNotifier(t *testing.T) {
+	port, messages := newSMTPStandIn(t)
+	sender := mail.NewSMTPSender(mail.Config{Host: "127.0.0.1", Port: port, From: "firelink@example.com"})
+	notifier := &EmailNotifier{Sender: sender, To: []string{"me@example.com"}, Topic: "system"}
+
+	require.NoError(t, notifier.SendMessage(context.Background(), "DB Backup", "DB Backup sent"))
+	require.NoError(t, notifier.SendFile(context.Background(), writeBackup(t)))
+
+	require.Len(t, *messages, 2)
+	assert.Contains(t, (*messages)[0], "Subject: [system] DB Backup")
+	assert.Contains(t, (*messages)[0], "DB Backup sent")
+	assert.Contains(t, (*messages)[1], `filename=backup.sql`)
+}
+
+// failingNotifier always fails with err
+type failingNotifier struct {
+	err error
+}
+
+func (f *failingNotifier) SendMessage(ctx context.Context, title, message string) error {
+	return f.err
+}
+
+func (f *failingNotifier) SendFile(ctx context.Context, fileLoc string) error {
+	return f.err
+}
+
+func TestMultiNotifier(t *testing.T) {
+	first, second := &MockNotifier{}, &MockNotifier{}
+	multi := &MultiNotifier{Backends: []Backend{
+		{Name: "first", Notifier: first},
+		{Name: "broken", Notifier: &failingNotifier{err: errors.New("connection refused")}},
+		{Name: "second", Notifier: second},
+		{Name: "slack", Notifier: &failingNotifier{err: ErrFileNotSupported}},
+	}}
+
+	err := multi.SendMessage(context.Background(), "Recipe", "Pasta")
+	assert.EqualError(t, err, "broken: connection refused")
+	assert.Equal(t, "Pasta", first.SentMessage)
+	assert.Equal(t, "Pasta", second.SentMessage)
+
+	// Backends that cannot deliver files are skipped
+	err = multi.SendFile(context.Background(), "backup.sql")
+	assert.EqualError(t, err, "broken: connection refused")
+	assert.Equal(t, "backup.sql", second.SentFile)
+
+	// A file no backend can deliver is reported rather than dropped
+	chatOnly := &MultiNotifier{Backends: []Backend{{Name: "slack", Notifier: &failingNotifier{err: ErrFileNotSupported}}}}
+	assert.ErrorIs(t, chatOnly.SendFile(context.Background(), "backup.sql"), ErrFileNotSupported)
+}
+
+func TestConfigFromEnv_EmailNeedsSMTPHost(t *testing.T) {
+	t.Setenv("NOTIFY_BACKENDS", "ntfy,email")
+	t.Setenv("NOTIFY_EMAIL_TO", "me@example.com")
+	t.Setenv("SMTP_HOST", "")
+	t.Cleanup(func() { config = Config{Backends: []string{"ntfy"}, NtfyServer: DefaultServer} })
+
+	assert.EqualError(t, Configure(ConfigFromEnv()), "email backend needs SMTP_HOST")
+	assert.Equal(t, []string{"ntfy"}, config.Backends)
+
+	t.Setenv("SMTP_HOST", "smtp.example.com")
+	assert.NoError(t, Configure(ConfigFromEnv()))
+	assert.Equal(t, []string{"ntfy", "email"}, config.Backends)
+}
+
+func TestConfigure(t *testing.T) {
+	t.Cleanup(func() { config = Config{Backends: []string{"ntfy"}, NtfyServer: DefaultServer} })
+
+	err := Configure(Config{Backends: []string{"ntfy", "gotify", "pager", "webhook"}, WebhookURL: "http://localhost/hook"})
+	assert.EqualError(t, err, "gotify backend needs GOTIFY_URL\nunknown notification backend \"pager\"")
+
+	multi, ok := NewNotifier("drink").(*MultiNotifier)
+	require.True(t, ok)
+	require.Len(t, multi.Backends, 2)
+	assert.Equal(t, "ntfy", multi.Backends[0].Name)
+	assert.Equal(t, &WebhookNotifier{URL: "http://localhost/hook", Topic: "drink", Client: httpClient}, multi.Backends[1].Notifier)
+
+	// Without any usable backend notifications keep going to ntfy
+	assert.Error(t, Configure(Config{Backends: []string{"matrix"}}))
+	assert.IsType(t, &NtfyNotifier{}, NewNotifier("drink"))
+}
+
+func TestDeliver_SkipsDeliveredBackends(t *testing.T) {
+	t.Cleanup(func() { config = Config{Backends: []string{"ntfy"}, NtfyServer: DefaultServer} })
+	server, requests := newStandIn(t, "{}")
+	broken := httptest.NewServer(http.NotFoundHandler())
+	broken.Close()
+	require.NoError(t, Configure(Config{
+		Backends:    []string{"webhook", "gotify"},
+		WebhookURL:  server.URL + "/hook",
+		GotifyURL:   broken.URL,
+		GotifyToken: "app-token",
+	}))
+
+	env := Envelope{Topic: "drink", Message: Message{Title: "Drink", Body: "Mojito"}}
+	delivered, err := Deliver(context.Background(), env)
+	assert.ErrorContains(t, err, "gotify: ")
+	assert.Equal(t, []string{"webhook"}, delivered)
+
+	env.Delivered = delivered
+	_, err = Deliver(context.Background(), env)
+	assert.Error(t, err)
+	assert.Len(t, *requests, 1)
+
+	// A file no backend can deliver is an error rather than silently dropped
+	config.Backends = []string{"gotify"}
+	_, err = Deliver(context.Background(), Envelope{Topic: "system", File: writeBackup(t)})
+	assert.EqualError(t, err, "no notification backend can send files")
+}
+
+func TestNotifiers_WithoutClient(t *testing.T) {
+	server, requests := newStandIn(t, "{}")
+	ntfy := &NtfyNotifier{Topic: "system", Server: server.URL}
+	webhook := &WebhookNotifier{URL: server.URL + "/hook", Topic: "system"}
+
+	require.NoError(t, ntfy.SendMessage(context.Background(), "DB Backup", "sent"))
+	require.NoError(t, ntfy.SendFile(context.Background(), writeBackup(t)))
+	require.NoError(t, webhook.SendMessage(context.Background(), "DB Backup", "sent"))
+	assert.Len(t, *requests, 3)
+}
@@ -0,0 +1,44 @@
+package ntfy
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/rjhoppe/firelink/mail"
+)
+
+// EmailNotifier emails notifications, with files as attachments
+type EmailNotifier struct {
+	Sender mail.Sender
+	To     []string
+	Topic  string
+}
+
+// subject prefixes the title with the topic, such as "[dinner] Recipe"
+func (n *EmailNotifier) subject(title string) string {
+	if n.Topic == "" {
+		return title
+	}
+	return fmt.Sprintf("[%s] %s", n.Topic, title)
+}
+
+func (n *EmailNotifier) SendMessage(ctx context.Context, title, message string) error {
+	return n.Sender.Send(ctx, mail.Message{To: n.To, Subject: n.subject(title), Body: message})
+}
+
+func (n *EmailNotifier) SendFile(ctx context.Context, fileLoc string) error {
+	data, err := os.ReadFile(fileLoc)
+	if err != nil {
+		return err
+	}
+	name := filepath.Base(fileLoc)
+	return n.Sender.Send(ctx, mail.Message{
+		To:          n.To,
+		Subject:     n.subject(name),
+		Body:        fmt.Sprintf("%s is attached.", name),
+		Attachments: []mail.Attachment{{Name: name, ContentType: http.DetectContentType(data), Data: data}},
+	})
+}
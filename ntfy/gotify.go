@@ -0,0 +1,26 @@
+package ntfy
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// GotifyNotifier sends notifications to a Gotify server using an application token.
+// Gotify has no attachments, so files are not supported.
+type GotifyNotifier struct {
+	URL      string
+	Token    string
+	Priority int
+	Client   *http.Client
+}
+
+func (n *GotifyNotifier) SendMessage(ctx context.Context, title, message string) error {
+	payload := map[string]any{"title": title, "message": message, "priority": n.Priority}
+	headers := map[string]string{"X-Gotify-Key": n.Token}
+	return postJSON(ctx, n.Client, "POST", strings.TrimSuffix(n.URL, "/")+"/message", headers, payload)
+}
+
+func (n *GotifyNotifier) SendFile(ctx context.Context, fileLoc string) error {
+	return ErrFileNotSupported
+}
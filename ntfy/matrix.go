@@ -0,0 +1,92 @@
+package ntfy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// matrixTxn makes Matrix transaction ids unique within this process
+var matrixTxn atomic.Int64
+
+// MatrixNotifier posts notifications to a Matrix room as the user owning the access token
+type MatrixNotifier struct {
+	Homeserver string
+	Token      string
+	RoomID     string
+	Client     *http.Client
+}
+
+func (n *MatrixNotifier) baseURL() string {
+	return strings.TrimSuffix(n.Homeserver, "/")
+}
+
+// send posts an m.room.message event to the room
+func (n *MatrixNotifier) send(ctx context.Context, content map[string]any) error {
+	txn := fmt.Sprintf("firelink-%d-%d", time.Now().UnixNano(), matrixTxn.Add(1))
+	endpoint := fmt.Sprintf("%s/_matrix/client/v3/rooms/%s/send/m.room.message/%s", n.baseURL(), url.PathEscape(n.RoomID), txn)
+	return postJSON(ctx, n.Client, "PUT", endpoint, map[string]string{"Authorization": "Bearer " + n.Token}, content)
+}
+
+func (n *MatrixNotifier) SendMessage(ctx context.Context, title, message string) error {
+	formatted := fmt.Sprintf("<strong>%s</strong><br>%s", html.EscapeString(title), strings.ReplaceAll(html.EscapeString(message), "\n", "<br>"))
+	return n.send(ctx, map[string]any{
+		"msgtype":        "m.text",
+		"body":           title + "\n\n" + message,
+		"format":         "org.matrix.custom.html",
+		"formatted_body": formatted,
+	})
+}
+
+// SendFile uploads the file to the homeserver's media repository and posts it to the room
+func (n *MatrixNotifier) SendFile(ctx context.Context, fileLoc string) error {
+	file, err := os.Open(fileLoc)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	name := filepath.Base(fileLoc)
+	endpoint := fmt.Sprintf("%s/_matrix/media/v3/upload?filename=%s", n.baseURL(), url.QueryEscape(name))
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, file)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = info.Size()
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Authorization", "Bearer "+n.Token)
+
+	resp, err := orDefault(n.Client).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("matrix upload returned status %s", resp.Status)
+	}
+	var uploaded struct {
+		ContentURI string `json:"content_uri"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&uploaded); err != nil {
+		return fmt.Errorf("error parsing matrix upload response: %w", err)
+	}
+
+	return n.send(ctx, map[string]any{
+		"msgtype": "m.file",
+		"body":    name,
+		"url":     uploaded.ContentURI,
+		"info":    map[string]any{"size": info.Size(), "mimetype": "application/octet-stream"},
+	})
+}
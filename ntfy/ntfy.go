@@ -2,6 +2,8 @@ package ntfy
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"log"
@@ -10,52 +12,75 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/rjhoppe/firelink/models"
 )
 
 // Notifier interface for sending notifications
 type Notifier interface {
-	SendMessage(title, message string) error
-	SendFile(fileLoc string) error
+	SendMessage(ctx context.Context, title, message string) error
+	SendFile(ctx context.Context, fileLoc string) error
 }
 
-// NtfyNotifier implements Notifier for ntfy.sh
+// NtfyNotifier implements Notifier for ntfy.sh or a self-hosted ntfy server
 type NtfyNotifier struct {
-	Topic string
+	Topic    string
+	Client   *http.Client
+	Server   string // defaults to DefaultServer
+	Token    string // access token, used instead of Username and Password when set
+	Username string
+	Password string
+	Options  TopicOptions
 }
 
-// Send sends a notification to the configured ntfy.sh topic
-func (n *NtfyNotifier) SendMessage(title, message string) error {
-	requestUrl := fmt.Sprintf("https://ntfy.rjhoppe.dev/%s", n.Topic)
+// httpClient is shared by notifiers created with NewNotifier
+var httpClient = &http.Client{Timeout: 10 * time.Second}
 
-	request, err := http.NewRequest("POST", requestUrl, strings.NewReader(message))
-	if err != nil {
-		log.Printf("Error creating request: %v", err)
-		return err
+// orDefault returns client, or the shared client for notifiers built without one
+func orDefault(client *http.Client) *http.Client {
+	if client == nil {
+		return httpClient
 	}
+	return client
+}
 
-	request.Header.Set("Content-Type", "text/plain")
-	request.Header.Set("Title", title)
+// SetHTTPClient replaces the HTTP client used by notifiers created with NewNotifier
+func SetHTTPClient(client *http.Client) {
+	httpClient = client
+}
 
-	client := &http.Client{}
-	response, err := client.Do(request)
+// SendMessage sends a notification to the configured topic
+func (n *NtfyNotifier) SendMessage(ctx context.Context, title, message string) error {
+	err := n.Publish(ctx, Message{Title: title, Body: message})
 	if err != nil {
 		log.Printf("Error sending request: %v", err)
-		return err
 	}
-	defer response.Body.Close()
-
-	log.Printf("Response status: %v", response.Status)
-	return nil
+	return err
 }
 
-// NewNotifier is a factory function for Notifier
+// NewNotifier is a factory function for Notifier. Notifications go to the queue when one
+// is set, and straight to the configured backends otherwise.
 func NewNotifier(topic string) Notifier {
-	return &NtfyNotifier{Topic: topic}
+	if queue != nil {
+		return &QueuedNotifier{Topic: topic, Queue: queue}
+	}
+	return newDirectNotifier(topic)
+}
+
+// newDirectNotifier creates a notifier sending to the configured backends
+func newDirectNotifier(topic string) Notifier {
+	if len(config.Backends) == 1 {
+		return config.newBackend(config.Backends[0], topic)
+	}
+	multi := &MultiNotifier{}
+	for _, backend := range config.Backends {
+		multi.Backends = append(multi.Backends, Backend{Name: backend, Notifier: config.newBackend(backend, topic)})
+	}
+	return multi
 }
 
-func (n *NtfyNotifier) SendFile(fileLoc string) error {
+func (n *NtfyNotifier) SendFile(ctx context.Context, fileLoc string) error {
 	file, err := os.Open(fileLoc)
 	if err != nil {
 		return err
@@ -73,13 +98,16 @@ func (n *NtfyNotifier) SendFile(fileLoc string) error {
 	}
 	w.Close()
 
-	req, err := http.NewRequest("POST", "https://ntfy.rjhoppe.dev/"+n.Topic, &b)
+	req, err := http.NewRequestWithContext(ctx, "POST", n.server()+"/"+n.Topic, &b)
 	if err != nil {
 		return err
 	}
 	req.Header.Set("Content-Type", w.FormDataContentType())
+	for key, value := range n.authHeaders() {
+		req.Header.Set(key, value)
+	}
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := orDefault(n.Client).Do(req)
 	if err != nil {
 		return err
 	}
@@ -107,90 +135,99 @@ func formatDrinkContent(content string) string {
 }
 
 // NtfyDrinkOfTheDay sends a drink notification using the Notifier interface
-func NtfyDrinkOfTheDay(drink models.DrinkResponse, notifier Notifier) {
-	// Format ingredients as bullet points
-	formattedIngredients := formatDrinkContent(drink.Ingredients)
-
-	msg := fmt.Sprintf(`%s
-
-👀 Category: %v
-
-🍸 Glass: %v
-
-🛒 Ingredients:
-%s
-
-📝 Instructions:
-%v`,
-		drink.Name,
-		drink.Category,
-		drink.Glass,
-		formattedIngredients,
-		drink.Instructions)
-
-	err := notifier.SendMessage("🍹 Drink of the Day", msg)
+func NtfyDrinkOfTheDay(ctx context.Context, drink models.DrinkResponse, notifier Notifier) {
+	err := publish(ctx, notifier, renderMessage("drink_of_the_day", drink))
 	if err != nil {
 		log.Printf("Failed to send drink notification: %v", err)
 	}
 }
 
 // NtfyRandomRecipes sends a random dinner notification using the Notifier interface
-func NtfyRandomRecipes(recipeId int32, recipeName string, notifier Notifier) {
-	msg := fmt.Sprintf(`
-🍽️ Dinner %v: %v`, recipeId, recipeName)
-	err := notifier.SendMessage("Recipe", msg)
+func NtfyRandomRecipes(ctx context.Context, recipeId string, recipeName string, notifier Notifier) {
+	err := publish(ctx, notifier, renderMessage("random_recipe", RecipeSummary{Id: recipeId, Title: recipeName}))
 	if err != nil {
 		log.Printf("Failed to send dinner notification: %v", err)
 	}
 }
 
 // NtfyRecipe sends a dinner recipe notification using the Notifier interface
-func NtfyRecipe(recipe *models.RecipeInfo, notifier Notifier) {
-	// Create a nicely formatted message with all information
-	msg := fmt.Sprintf(`%s
-
-📋 Recipe ID: %d
-
-🛒 Ingredients:
-%s
-
-📝 Instructions:
-%s
-
-🌐 Source: %s`,
-		recipe.Title,
-		recipe.Id,
-		recipe.Ingredients,
-		recipe.Instructions,
-		recipe.Url)
-
-	err := notifier.SendMessage("Recipe Info! 🍽️", msg)
+func NtfyRecipe(ctx context.Context, recipe *models.RecipeInfo, notifier Notifier) {
+	msg := renderMessage("recipe", recipe)
+	msg.Click = recipe.Url
+	msg.Actions = recipeActions(recipe)
+	err := publish(ctx, notifier, msg)
 	if err != nil {
 		log.Printf("Failed to send dinner notification: %v", err)
 	}
 }
 
-func NtfyAllCacheDrinks(drinks []models.DrinkResponse, notifier Notifier) {
-	var msg strings.Builder
-
-	for i, drink := range drinks {
-		msg.WriteString(fmt.Sprintf(
-			"Drink %d: %v\nCategory: %v\nIngredients: %v\nInstructions: %v\n\n",
-			i+1, drink.Name, drink.Category, drink.Ingredients, drink.Instructions,
-		))
+// recipeActions links a recipe notification to its source and, when FIRELINK_PUBLIC_URL
+// is set, adds a "Save" button storing it as a local recipe
+func recipeActions(recipe *models.RecipeInfo) []Action {
+	var actions []Action
+	if recipe.Url != "" {
+		actions = append(actions, Action{Action: "view", Label: "Source", URL: recipe.Url})
 	}
+	if config.PublicURL != "" {
+		body, err := json.Marshal(models.DinnerRequest{
+			Title:        recipe.Title,
+			Url:          recipe.Url,
+			Instructions: recipe.Instructions,
+			Ingredients:  recipe.Ingredients,
+		})
+		if err == nil {
+			actions = append(actions, Action{
+				Action:  "http",
+				Label:   "Save",
+				URL:     config.PublicURL + "/dinner/recipes",
+				Method:  "POST",
+				Headers: map[string]string{"Content-Type": "application/json"},
+				Body:    string(body),
+				Clear:   true,
+			})
+		}
+	}
+	return actions
+}
 
-	err := notifier.SendMessage("All Cached Drinks", msg.String())
+func NtfyAllCacheDrinks(ctx context.Context, drinks []models.DrinkResponse, notifier Notifier) {
+	err := publish(ctx, notifier, renderMessage("cached_drinks", drinks))
 	if err != nil {
 		log.Printf("Failed to send drinks notification: %v", err)
 	}
 }
 
-func NtfyDBBackup(fileLoc string, notifier Notifier) {
-	err := notifier.SendFile(fileLoc)
+// NtfyBookSent confirms that a book was emailed to an e-reader
+func NtfyBookSent(ctx context.Context, title, device string, notifier Notifier) {
+	err := publish(ctx, notifier, renderMessage("book_sent", BookSent{Title: title, Device: device}))
+	if err != nil {
+		log.Printf("Failed to send book notification: %v", err)
+	}
+}
+
+// NtfyPassage sends the daily reading passage of a book. The error is returned so
+// the passage can be sent again rather than skipped.
+func NtfyPassage(ctx context.Context, title string, percent int, passage string, notifier Notifier) error {
+	err := publish(ctx, notifier, renderMessage("passage", Passage{Title: title, Percent: percent, Passage: passage}))
+	if err != nil {
+		log.Printf("Failed to send passage notification: %v", err)
+	}
+	return err
+}
+
+func NtfyDBBackup(ctx context.Context, fileLoc string, notifier Notifier) {
+	err := notifier.SendFile(ctx, fileLoc)
 	if err != nil {
 		log.Printf("Failed to send db backup notification: %v", err)
 	}
 
-	_ = notifier.SendMessage("DB Backup", "DB Backup sent")
+	_ = publish(ctx, notifier, renderMessage("db_backup", nil))
+}
+
+// NtfyQuotaLow warns that the Spoonacular daily quota is running out
+func NtfyQuotaLow(ctx context.Context, used, left, threshold float64, notifier Notifier) {
+	err := publish(ctx, notifier, renderMessage("quota_low", QuotaLow{Used: used, Left: left, Threshold: threshold}))
+	if err != nil {
+		log.Printf("Failed to send quota notification: %v", err)
+	}
 }
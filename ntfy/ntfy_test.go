@@ -1,6 +1,7 @@
 package ntfy
 
 import (
+	"context"
 	"testing"
 	"time"
 
@@ -14,13 +15,13 @@ type MockNotifier struct {
 	SentFile    string
 }
 
-func (m *MockNotifier) SendMessage(title, message string) error {
+func (m *MockNotifier) SendMessage(ctx context.Context, title, message string) error {
 	m.SentTitle = title
 	m.SentMessage = message
 	return nil
 }
 
-func (m *MockNotifier) SendFile(fileLoc string) error {
+func (m *MockNotifier) SendFile(ctx context.Context, fileLoc string) error {
 	m.SentFile = fileLoc
 	return nil
 }
@@ -35,7 +36,7 @@ func TestNtfyDrinkOfTheDay(t *testing.T) {
 	}
 
 	mockNotifier := &MockNotifier{}
-	NtfyDrinkOfTheDay(drink, mockNotifier)
+	NtfyDrinkOfTheDay(context.Background(), drink, mockNotifier)
 
 	time.Sleep(1 * time.Second)
 
@@ -66,7 +67,7 @@ func TestNtfyDinner(t *testing.T) {
 	}
 
 	mockNotifier := &MockNotifier{}
-	NtfyRecipe(&recipe, mockNotifier)
+	NtfyRecipe(context.Background(), &recipe, mockNotifier)
 
 	time.Sleep(1 * time.Second)
 
@@ -88,7 +89,7 @@ Test Instructions
 
 func TestNtfyRandomRecipes(t *testing.T) {
 	mockNotifier := &MockNotifier{}
-	NtfyRandomRecipes(123, "Recipe Title", mockNotifier)
+	NtfyRandomRecipes(context.Background(), "123", "Recipe Title", mockNotifier)
 
 	time.Sleep(1 * time.Second)
 
@@ -98,7 +99,7 @@ func TestNtfyRandomRecipes(t *testing.T) {
 
 func TestNtfyDBBackup(t *testing.T) {
 	mockNotifier := &MockNotifier{}
-	NtfyDBBackup("test.txt", mockNotifier)
+	NtfyDBBackup(context.Background(), "test.txt", mockNotifier)
 
 	time.Sleep(1 * time.Second)
 
@@ -0,0 +1,176 @@
+package ntfy
+
+import (
+	"context"
+	"encoding/base64"
+	"slices"
+	"strings"
+)
+
+// DefaultServer is the ntfy server used when NTFY_SERVER is not set
+const DefaultServer = "https://ntfy.rjhoppe.dev"
+
+// Action is an ntfy action button. Action is "view" (open URL), "http" (send a request
+// from the ntfy server) or "broadcast".
+type Action struct {
+	Action  string            `json:"action"`
+	Label   string            `json:"label"`
+	URL     string            `json:"url,omitempty"`
+	Method  string            `json:"method,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    string            `json:"body,omitempty"`
+	Clear   bool              `json:"clear,omitempty"`
+}
+
+// Message is a notification with the optional ntfy publish options
+type Message struct {
+	Title    string   `json:"-"`
+	Body     string   `json:"-"`
+	Priority int      `json:"priority,omitempty"` // 1 (min) to 5 (max), 0 for the topic default
+	Tags     []string `json:"tags,omitempty"`
+	Click    string   `json:"click,omitempty"`
+	Icon     string   `json:"icon,omitempty"`
+	Actions  []Action `json:"actions,omitempty"`
+	Markdown bool     `json:"markdown,omitempty"`
+}
+
+// Publisher is implemented by notifiers that support the options of a Message.
+// Other notifiers receive only its title and body.
+type Publisher interface {
+	Publish(ctx context.Context, msg Message) error
+}
+
+// publish sends msg through notifier, with its options when notifier is a Publisher
+func publish(ctx context.Context, notifier Notifier, msg Message) error {
+	if publisher, ok := notifier.(Publisher); ok {
+		return publisher.Publish(ctx, msg)
+	}
+	return notifier.SendMessage(ctx, msg.Title, msg.Body)
+}
+
+// TopicOptions are the publish defaults of an ntfy topic
+type TopicOptions struct {
+	Priority int
+	Tags     []string
+	Click    string
+	Icon     string
+	Actions  []Action
+}
+
+// merge overlays topic options onto defaults, keeping defaults that the topic does not set
+func (o TopicOptions) merge(topic TopicOptions) TopicOptions {
+	if topic.Priority != 0 {
+		o.Priority = topic.Priority
+	}
+	if len(topic.Tags) > 0 {
+		o.Tags = topic.Tags
+	}
+	if topic.Click != "" {
+		o.Click = topic.Click
+	}
+	if topic.Icon != "" {
+		o.Icon = topic.Icon
+	}
+	if len(topic.Actions) > 0 {
+		o.Actions = topic.Actions
+	}
+	return o
+}
+
+// maxActions is the most action buttons ntfy accepts on a notification
+const maxActions = 3
+
+// parseActions reads action buttons in ntfy's short format, separated by semicolons,
+// such as "view, Open Firelink, https://firelink.example.com; http, Refresh, https://..., method=PUT".
+// Malformed actions are skipped.
+func parseActions(value string) []Action {
+	var actions []Action
+	for _, definition := range strings.Split(value, ";") {
+		fields := strings.Split(definition, ",")
+		if len(fields) < 3 {
+			continue
+		}
+		action := Action{
+			Action: strings.TrimSpace(fields[0]),
+			Label:  strings.TrimSpace(fields[1]),
+			URL:    strings.TrimSpace(fields[2]),
+		}
+		if action.Action != "view" && action.Action != "http" || action.Label == "" || action.URL == "" {
+			continue
+		}
+		for _, field := range fields[3:] {
+			key, value, _ := strings.Cut(strings.TrimSpace(field), "=")
+			switch key {
+			case "method":
+				action.Method = value
+			case "body":
+				action.Body = value
+			case "clear":
+				action.Clear = value == "true"
+			}
+		}
+		actions = append(actions, action)
+	}
+	return actions
+}
+
+// ntfyPayload is the body of ntfy's JSON publish API
+type ntfyPayload struct {
+	Topic    string   `json:"topic"`
+	Title    string   `json:"title,omitempty"`
+	Message  string   `json:"message"`
+	Priority int      `json:"priority,omitempty"`
+	Tags     []string `json:"tags,omitempty"`
+	Click    string   `json:"click,omitempty"`
+	Icon     string   `json:"icon,omitempty"`
+	Actions  []Action `json:"actions,omitempty"`
+	Markdown bool     `json:"markdown,omitempty"`
+}
+
+// server returns the ntfy server URL without a trailing slash
+func (n *NtfyNotifier) server() string {
+	if n.Server == "" {
+		return DefaultServer
+	}
+	return strings.TrimSuffix(n.Server, "/")
+}
+
+// authHeaders returns the access token, or else the basic auth credentials, as headers
+func (n *NtfyNotifier) authHeaders() map[string]string {
+	headers := map[string]string{}
+	if n.Token != "" {
+		headers["Authorization"] = "Bearer " + n.Token
+	} else if n.Username != "" {
+		credentials := base64.StdEncoding.EncodeToString([]byte(n.Username + ":" + n.Password))
+		headers["Authorization"] = "Basic " + credentials
+	}
+	return headers
+}
+
+// Publish sends msg with ntfy's JSON publish API, filling unset options from the topic defaults
+func (n *NtfyNotifier) Publish(ctx context.Context, msg Message) error {
+	payload := ntfyPayload{
+		Topic:    n.Topic,
+		Title:    msg.Title,
+		Message:  msg.Body,
+		Priority: n.Options.Priority,
+		Tags:     slices.Concat(n.Options.Tags, msg.Tags),
+		Click:    n.Options.Click,
+		Icon:     n.Options.Icon,
+		Actions:  slices.Concat(msg.Actions, n.Options.Actions),
+		Markdown: msg.Markdown,
+	}
+	if len(payload.Actions) > maxActions {
+		payload.Actions = payload.Actions[:maxActions]
+	}
+	if msg.Priority != 0 {
+		payload.Priority = msg.Priority
+	}
+	if msg.Click != "" {
+		payload.Click = msg.Click
+	}
+	if msg.Icon != "" {
+		payload.Icon = msg.Icon
+	}
+	return postJSON(ctx, n.Client, "POST", n.server(), n.authHeaders(), payload)
+}
@@ -0,0 +1,116 @@
+package ntfy
+
+import (
+	"context"
+	"testing"
+
+	"github.com/rjhoppe/firelink/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNtfyNotifier_Publish(t *testing.T) {
+	server, requests := newStandIn(t, "{}")
+	notifier := &NtfyNotifier{
+		Topic:   "dinner",
+		Client:  server.Client(),
+		Server:  server.URL + "/",
+		Token:   "tk_secret",
+		Options: TopicOptions{Priority: 2, Tags: []string{"fork_and_knife"}, Icon: "https://example.com/icon.png"},
+	}
+
+	require.NoError(t, notifier.SendMessage(context.Background(), "Recipe", "Pasta"))
+	require.NoError(t, notifier.Publish(context.Background(), Message{Title: "Quota", Body: "Low", Priority: 5, Tags: []string{"warning"}}))
+
+	require.Len(t, *requests, 2)
+	assert.Equal(t, "/", (*requests)[0].Path)
+	assert.Equal(t, "Bearer tk_secret", (*requests)[0].Header.Get("Authorization"))
+	assert.Equal(t, map[string]any{
+		"topic":    "dinner",
+		"title":    "Recipe",
+		"message":  "Pasta",
+		"priority": float64(2),
+		"tags":     []any{"fork_and_knife"},
+		"icon":     "https://example.com/icon.png",
+	}, decodeBody(t, (*requests)[0]))
+
+	body := decodeBody(t, (*requests)[1])
+	assert.Equal(t, float64(5), body["priority"])
+	assert.Equal(t, []any{"fork_and_knife", "warning"}, body["tags"])
+}
+
+func TestNtfyNotifier_SendFileWithBasicAuth(t *testing.T) {
+	server, requests := newStandIn(t, "{}")
+	notifier := &NtfyNotifier{Topic: "system", Client: server.Client(), Server: server.URL, Username: "phil", Password: "pw"}
+
+	require.NoError(t, notifier.SendFile(context.Background(), writeBackup(t)))
+
+	require.Len(t, *requests, 1)
+	assert.Equal(t, "/system", (*requests)[0].Path)
+	assert.Equal(t, "Basic cGhpbDpwdw==", (*requests)[0].Header.Get("Authorization"))
+}
+
+func TestNtfyRecipe_Actions(t *testing.T) {
+	t.Cleanup(func() { config = Config{Backends: []string{"ntfy"}, NtfyServer: DefaultServer} })
+	config.PublicURL = "https://firelink.example.com"
+
+	server, requests := newStandIn(t, "{}")
+	notifier := &NtfyNotifier{Topic: "dinner", Client: server.Client(), Server: server.URL}
+	recipe := models.RecipeInfo{Title: "Pasta", Id: 7, Url: "https://spoonacular.com/pasta-7", Instructions: "Boil", Ingredients: "Pasta"}
+	NtfyRecipe(context.Background(), &recipe, notifier)
+
+	require.Len(t, *requests, 1)
+	body := decodeBody(t, (*requests)[0])
+	assert.Equal(t, "https://spoonacular.com/pasta-7", body["click"])
+	assert.Equal(t, []any{
+		map[string]any{"action": "view", "label": "Source", "url": "https://spoonacular.com/pasta-7"},
+		map[string]any{
+			"action":  "http",
+			"label":   "Save",
+			"url":     "https://firelink.example.com/dinner/recipes",
+			"method":  "POST",
+			"headers": map[string]any{"Content-Type": "application/json"},
+			"body":    `{"title":"Pasta","url":"https://spoonacular.com/pasta-7","instructions":"Boil","ingredients":"Pasta"}`,
+			"clear":   true,
+		},
+	}, body["actions"])
+}
+
+func TestConfigFromEnv_TopicOptions(t *testing.T) {
+	t.Setenv("NTFY_SERVER", "https://ntfy.example.com")
+	t.Setenv("NTFY_PRIORITY", "low")
+	t.Setenv("NTFY_TAGS", "house")
+	t.Setenv("NTFY_SYSTEM_PRIORITY", "urgent")
+	t.Setenv("NTFY_DINNER_TAGS", "fork_and_knife, spaghetti")
+	t.Setenv("NTFY_DINNER_ACTIONS", "view, More ideas, https://firelink.example.com/dinner/random; broadcast, Nope, x; http, Cooked, https://firelink.example.com/dinner/cooked, method=PUT, clear=true")
+
+	c := ConfigFromEnv()
+	system := c.newBackend("ntfy", "system").(*NtfyNotifier)
+	assert.Equal(t, "https://ntfy.example.com", system.Server)
+	assert.Equal(t, TopicOptions{Priority: 5, Tags: []string{"house"}}, system.Options)
+
+	dinner := c.newBackend("ntfy", "dinner").(*NtfyNotifier)
+	assert.Equal(t, TopicOptions{Priority: 2, Tags: []string{"fork_and_knife", "spaghetti"}, Actions: []Action{
+		{Action: "view", Label: "More ideas", URL: "https://firelink.example.com/dinner/random"},
+		{Action: "http", Label: "Cooked", URL: "https://firelink.example.com/dinner/cooked", Method: "PUT", Clear: true},
+	}}, dinner.Options)
+}
+
+func TestNtfyNotifier_TopicActions(t *testing.T) {
+	server, requests := newStandIn(t, "{}")
+	notifier := &NtfyNotifier{Topic: "dinner", Client: server.Client(), Server: server.URL, Options: TopicOptions{
+		Actions: []Action{{Action: "view", Label: "Plan", URL: "https://example.com/plan"}, {Action: "view", Label: "Extra", URL: "https://example.com/extra"}},
+	}}
+
+	msg := Message{Title: "Recipe", Body: "Pasta", Actions: []Action{
+		{Action: "view", Label: "Source", URL: "https://example.com/source"},
+		{Action: "view", Label: "Save", URL: "https://example.com/save"},
+	}}
+	require.NoError(t, notifier.Publish(context.Background(), msg))
+
+	// Message actions come first and ntfy takes at most three
+	actions := decodeBody(t, (*requests)[0])["actions"].([]any)
+	require.Len(t, actions, 3)
+	assert.Equal(t, "Source", actions[0].(map[string]any)["label"])
+	assert.Equal(t, "Plan", actions[2].(map[string]any)["label"])
+}
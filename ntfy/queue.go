@@ -0,0 +1,68 @@
+package ntfy
+
+import (
+	"context"
+	"errors"
+	"slices"
+)
+
+// Envelope is a notification for a topic, either a message or a file
+type Envelope struct {
+	Topic   string
+	Message Message
+	File    string
+	// Delivered lists the backends that already received the notification
+	Delivered []string
+}
+
+// Queue accepts notifications for asynchronous delivery with Deliver
+type Queue interface {
+	Enqueue(ctx context.Context, env Envelope) error
+}
+
+// queue is used by NewNotifier when set
+var queue Queue
+
+// SetQueue makes notifiers created with NewNotifier enqueue notifications instead of
+// sending them, so slow or failing backends do not hold up requests
+func SetQueue(q Queue) {
+	queue = q
+}
+
+// QueuedNotifier enqueues notifications for a topic
+type QueuedNotifier struct {
+	Topic string
+	Queue Queue
+}
+
+func (n *QueuedNotifier) SendMessage(ctx context.Context, title, message string) error {
+	return n.Publish(ctx, Message{Title: title, Body: message})
+}
+
+func (n *QueuedNotifier) Publish(ctx context.Context, msg Message) error {
+	return n.Queue.Enqueue(ctx, Envelope{Topic: n.Topic, Message: msg})
+}
+
+func (n *QueuedNotifier) SendFile(ctx context.Context, fileLoc string) error {
+	return n.Queue.Enqueue(ctx, Envelope{Topic: n.Topic, File: fileLoc})
+}
+
+// Deliver sends a queued notification to the configured backends it has not reached yet
+// and returns those it reached, so retrying a partly failed delivery does not repeat the
+// notification on the backends that already have it
+func Deliver(ctx context.Context, env Envelope) ([]string, error) {
+	var backends []Backend
+	for _, backend := range config.Backends {
+		if !slices.Contains(env.Delivered, backend) {
+			backends = append(backends, Backend{Name: backend, Notifier: config.newBackend(backend, env.Topic)})
+		}
+	}
+	if env.File != "" {
+		delivered, err := fanOut(backends, func(n Notifier) error { return n.SendFile(ctx, env.File) })
+		if err == nil && len(delivered) == 0 && len(env.Delivered) == 0 {
+			err = errors.New("no notification backend can send files")
+		}
+		return delivered, err
+	}
+	return fanOut(backends, func(n Notifier) error { return publish(ctx, n, env.Message) })
+}
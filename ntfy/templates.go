@@ -0,0 +1,265 @@
+package ntfy
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/template"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rjhoppe/firelink/models"
+)
+
+// Message bodies are text/template files. The embedded defaults can be overridden by
+// files of the same name in NTFY_TEMPLATE_DIR; naming an override "<name>.md.tmpl"
+// instead of "<name>.tmpl" sends it as Markdown. A template may define a "title"
+// template for the notification title.
+
+//go:embed templates/*.tmpl
+var embedded embed.FS
+
+// RecipeSummary is the data of the random_recipe template
+type RecipeSummary struct {
+	Id    string // Spoonacular id, or "local-" id of a custom recipe
+	Title string
+}
+
+// BookSent is the data of the book_sent template
+type BookSent struct {
+	Title  string
+	Device string
+}
+
+// Passage is the data of the passage template
+type Passage struct {
+	Title   string
+	Percent int
+	Passage string
+}
+
+// QuotaLow is the data of the quota_low template
+type QuotaLow struct {
+	Used      float64
+	Left      float64
+	Threshold float64
+}
+
+// Digest is the data of the digest template
+type Digest struct {
+	Topic    string
+	Messages []Message
+}
+
+// samples holds the data each template is previewed with, and so names every template
+var samples = map[string]any{
+	"drink_of_the_day": models.DrinkResponse{
+		Name:         "Mojito",
+		Category:     "Cocktail",
+		Glass:        "Highball glass",
+		Ingredients:  "White rum, Lime juice, Sugar, Mint, Soda water",
+		Instructions: "Muddle mint leaves with sugar and lime juice. Add a splash of soda water and fill the glass with cracked ice. Pour the rum and top with soda water.",
+	},
+	"random_recipe": RecipeSummary{Id: "716429", Title: "Pasta with Garlic, Scallions, Cauliflower & Breadcrumbs"},
+	"recipe": models.RecipeInfo{
+		Id:           716429,
+		Title:        "Pasta with Garlic, Scallions, Cauliflower & Breadcrumbs",
+		Url:          "https://spoonacular.com/recipes/pasta-with-garlic-scallions-cauliflower-breadcrumbs-716429",
+		Ingredients:  "butter, cauliflower florets, garlic, pasta, scallions",
+		Instructions: "Bring a pot of salted water to a boil. Roast the cauliflower, cook the pasta and toss everything with the garlic breadcrumbs.",
+	},
+	"cached_drinks": []models.DrinkResponse{
+		{Name: "Mojito", Category: "Cocktail", Ingredients: "White rum, Lime juice, Sugar, Mint", Instructions: "Muddle and top with soda."},
+		{Name: "Negroni", Category: "Ordinary Drink", Ingredients: "Gin, Campari, Sweet Vermouth", Instructions: "Stir with ice."},
+	},
+	"book_sent": BookSent{Title: "Moby Dick; Or, The Whale", Device: "Kindle Paperwhite"},
+	"passage":   Passage{Title: "Moby Dick; Or, The Whale", Percent: 12, Passage: "Call me Ishmael. Some years ago—never mind how long precisely—having little or no money in my purse, and nothing particular to interest me on shore, I thought I would sail about a little and see the watery part of the world."},
+	"db_backup": nil,
+	"digest": Digest{Topic: "dinner", Messages: []Message{
+		{Title: "Recipe", Body: "\n🍽️ Dinner 716429: Pasta with Garlic, Scallions, Cauliflower & Breadcrumbs", Click: "https://spoonacular.com/recipes/pasta-with-garlic-scallions-cauliflower-breadcrumbs-716429"},
+		{Title: "Recipe", Body: "\n🍽️ Dinner 715538: Bruschetta Style Pork & Pasta"},
+	}},
+	"quota_low": QuotaLow{Used: 141.5, Left: 8.5, Threshold: 10},
+}
+
+// templateFuncs are available to every template
+var templateFuncs = template.FuncMap{
+	"bullets": formatDrinkContent,
+	"inc":     func(i int) int { return i + 1 },
+	"split":   strings.Split,
+	"join":    strings.Join,
+	"trim":    strings.TrimSpace,
+	"upper":   strings.ToUpper,
+	"lower":   strings.ToLower,
+}
+
+// source is the text of a template and where it came from
+type source struct {
+	Text     string
+	Markdown bool
+	Override string // path of the override file, empty for the embedded default
+}
+
+// defaultSource returns the embedded template
+func defaultSource(name string) (source, error) {
+	text, err := embedded.ReadFile("templates/" + name + ".tmpl")
+	return source{Text: string(text)}, err
+}
+
+// loadSource returns the override of a template if there is one, and the embedded default otherwise
+func loadSource(name string) (source, error) {
+	if config.TemplateDir != "" {
+		for _, candidate := range []source{{Markdown: true, Override: name + ".md.tmpl"}, {Override: name + ".tmpl"}} {
+			path := filepath.Join(config.TemplateDir, candidate.Override)
+			text, err := os.ReadFile(path)
+			if err == nil {
+				candidate.Text, candidate.Override = string(text), path
+				return candidate, nil
+			}
+			if !errors.Is(err, fs.ErrNotExist) {
+				return source{}, err
+			}
+		}
+	}
+	return defaultSource(name)
+}
+
+// execute renders a template source into a message. A single trailing newline is dropped
+// so template files can end with one.
+func execute(name string, src source, data any) (Message, error) {
+	tmpl, err := template.New(name).Funcs(templateFuncs).Option("missingkey=error").Parse(src.Text)
+	if err != nil {
+		return Message{}, err
+	}
+	var body, title bytes.Buffer
+	if err := tmpl.Execute(&body, data); err != nil {
+		return Message{}, err
+	}
+	if tmpl.Lookup("title") != nil {
+		if err := tmpl.ExecuteTemplate(&title, "title", data); err != nil {
+			return Message{}, err
+		}
+	}
+	return Message{
+		Title:    strings.TrimSpace(title.String()),
+		Body:     strings.TrimSuffix(body.String(), "\n"),
+		Markdown: src.Markdown,
+	}, nil
+}
+
+// Render renders the named template, preferring its override
+func Render(name string, data any) (Message, error) {
+	if _, ok := samples[name]; !ok {
+		return Message{}, fmt.Errorf("unknown template %q", name)
+	}
+	src, err := loadSource(name)
+	if err != nil {
+		return Message{}, err
+	}
+	return execute(name, src, data)
+}
+
+// renderMessage renders the named template, falling back to the embedded default when
+// an override fails so a broken override does not silence notifications
+func renderMessage(name string, data any) Message {
+	msg, err := Render(name, data)
+	if err == nil {
+		return msg
+	}
+	log.Printf("Error rendering %s template, using the default: %v", name, err)
+	src, err := defaultSource(name)
+	if err == nil {
+		msg, err = execute(name, src, data)
+	}
+	if err != nil {
+		log.Printf("Error rendering default %s template: %v", name, err)
+		return Message{Title: name}
+	}
+	return msg
+}
+
+// DigestMessage summarizes the messages held for a topic into one message. The digest
+// opens the click URL of the latest message that has one, and keeps the action buttons
+// when only one message had any; the template lists every message's click URL.
+func DigestMessage(topic string, messages []Message) Message {
+	msg := renderMessage("digest", Digest{Topic: topic, Messages: messages})
+	withActions := 0
+	for _, held := range messages {
+		if held.Click != "" {
+			msg.Click = held.Click
+		}
+		if len(held.Actions) > 0 {
+			msg.Actions = held.Actions
+			withActions++
+		}
+	}
+	if withActions > 1 {
+		msg.Actions = nil
+	}
+	return msg
+}
+
+// ListTemplates lists the notification templates and whether they are overridden
+func ListTemplates(c *gin.Context) {
+	names := make([]string, 0, len(samples))
+	for name := range samples {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	templates := make([]gin.H, 0, len(names))
+	for _, name := range names {
+		entry := gin.H{"name": name, "overridden": false, "markdown": false}
+		if src, err := loadSource(name); err != nil {
+			entry["error"] = err.Error()
+		} else {
+			entry["overridden"] = src.Override != ""
+			entry["markdown"] = src.Markdown
+		}
+		templates = append(templates, entry)
+	}
+	c.JSON(http.StatusOK, gin.H{"template_dir": config.TemplateDir, "templates": templates})
+}
+
+// PreviewTemplate renders a template against its sample data. A POST body is rendered
+// in place of the current template (with ?markdown=true to preview it as Markdown),
+// so an override can be tried out before it is saved.
+func PreviewTemplate(c *gin.Context, name string) {
+	sample, ok := samples[name]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Unknown template %q", name)})
+		return
+	}
+
+	src, err := loadSource(name)
+	if c.Request.Method == http.MethodPost {
+		var text []byte
+		text, err = io.ReadAll(c.Request.Body)
+		src = source{Text: string(text), Markdown: c.Query("markdown") == "true"}
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Error loading template: %v", err)})
+		return
+	}
+
+	msg, err := execute(name, src, sample)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Error rendering template: %v", err)})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"name":     name,
+		"title":    msg.Title,
+		"body":     msg.Body,
+		"markdown": msg.Markdown,
+		"sample":   sample,
+	})
+}
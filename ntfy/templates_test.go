@@ -0,0 +1,122 @@
+package ntfy
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rjhoppe/firelink/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// withTemplateDir points the template overrides at a temporary directory holding files
+func withTemplateDir(t *testing.T, files map[string]string) {
+	dir := t.TempDir()
+	for name, text := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(text), 0644))
+	}
+	t.Cleanup(func() { config.TemplateDir = "" })
+	config.TemplateDir = dir
+}
+
+func TestDefaultTemplatesRenderSamples(t *testing.T) {
+	for name, sample := range samples {
+		msg, err := Render(name, sample)
+		require.NoError(t, err, name)
+		assert.NotEmpty(t, msg.Title, name)
+		assert.False(t, msg.Markdown, name)
+	}
+
+	_, err := Render("missing", nil)
+	assert.EqualError(t, err, `unknown template "missing"`)
+}
+
+func TestTemplateOverrides(t *testing.T) {
+	withTemplateDir(t, map[string]string{
+		"drink_of_the_day.md.tmpl": "{{define \"title\"}}Drink: {{.Name}}{{end -}}\n**{{.Name}}** in a {{lower .Glass}}\n",
+		"book_sent.tmpl":           "{{.Title}} -> {{.Device}}\n",
+		"recipe.tmpl":              "{{.Title} broken",
+	})
+
+	mock := &MockNotifier{}
+	NtfyDrinkOfTheDay(context.Background(), models.DrinkResponse{Name: "Negroni", Glass: "Old-Fashioned Glass"}, mock)
+	assert.Equal(t, "Drink: Negroni", mock.SentTitle)
+	assert.Equal(t, "**Negroni** in a old-fashioned glass", mock.SentMessage)
+
+	// Without a title template the title is empty
+	NtfyBookSent(context.Background(), "Emma", "Kobo", mock)
+	assert.Empty(t, mock.SentTitle)
+	assert.Equal(t, "Emma -> Kobo", mock.SentMessage)
+
+	// A broken override falls back to the default
+	NtfyRecipe(context.Background(), &models.RecipeInfo{Title: "Soup", Id: 5}, mock)
+	assert.Equal(t, "Recipe Info! 🍽️", mock.SentTitle)
+	assert.True(t, strings.HasPrefix(mock.SentMessage, "Soup\n\n📋 Recipe ID: 5"))
+}
+
+func TestMarkdownIsPublished(t *testing.T) {
+	withTemplateDir(t, map[string]string{"quota_low.md.tmpl": "_{{.Left}}_ left\n"})
+	server, requests := newStandIn(t, "{}")
+
+	NtfyQuotaLow(context.Background(), 140, 10, 10, &NtfyNotifier{Topic: "system", Client: server.Client(), Server: server.URL})
+
+	require.Len(t, *requests, 1)
+	body := decodeBody(t, (*requests)[0])
+	assert.Equal(t, "_10_ left", body["message"])
+	assert.Equal(t, true, body["markdown"])
+}
+
+func TestPreviewTemplate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	preview := func(method, name, text string) (int, map[string]any) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(method, "/admin/notifications/templates/"+name+"/preview?markdown=true", strings.NewReader(text))
+		PreviewTemplate(c, name)
+		var body map[string]any
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		return w.Code, body
+	}
+
+	code, body := preview("GET", "book_sent", "")
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "Book Sent", body["title"])
+	assert.Equal(t, "📚 Moby Dick; Or, The Whale was sent to Kindle Paperwhite", body["body"])
+
+	code, body = preview("POST", "passage", "# {{.Title}}\n\n> {{.Percent}}%")
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "# Moby Dick; Or, The Whale\n\n> 12%", body["body"])
+	assert.Equal(t, true, body["markdown"])
+
+	code, _ = preview("POST", "passage", "{{.Author}}")
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	code, _ = preview("GET", "missing", "")
+	assert.Equal(t, http.StatusNotFound, code)
+}
+
+func TestDigestMessage_KeepsLinks(t *testing.T) {
+	source := Action{Action: "view", Label: "Source", URL: "https://example.com/soup"}
+	msg := DigestMessage("dinner", []Message{
+		{Title: "Recipe", Body: "Soup", Click: "https://example.com/soup", Actions: []Action{source}},
+		{Title: "Recipe", Body: "Bread"},
+	})
+	assert.Equal(t, "https://example.com/soup", msg.Click)
+	assert.Equal(t, []Action{source}, msg.Actions)
+	assert.Contains(t, msg.Body, "Soup\nhttps://example.com/soup")
+
+	// Buttons of several messages would be ambiguous, so only the links in the body remain
+	msg = DigestMessage("dinner", []Message{
+		{Title: "Recipe", Body: "Soup", Click: "https://example.com/soup", Actions: []Action{source}},
+		{Title: "Recipe", Body: "Stew", Click: "https://example.com/stew", Actions: []Action{source}},
+	})
+	assert.Equal(t, "https://example.com/stew", msg.Click)
+	assert.Empty(t, msg.Actions)
+}
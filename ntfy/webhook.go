@@ -0,0 +1,126 @@
+package ntfy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// ErrFileNotSupported is returned by backends that cannot deliver files
+var ErrFileNotSupported = errors.New("backend does not support files")
+
+// postJSON posts payload as JSON to url and fails on non-2xx responses
+func postJSON(ctx context.Context, client *http.Client, method, url string, headers map[string]string, payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	return do(client, req)
+}
+
+// postFile posts a multipart form with the file under field and the extra form fields
+func postFile(ctx context.Context, client *http.Client, url, field, fileLoc string, fields map[string]string) error {
+	file, err := os.Open(fileLoc)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var b bytes.Buffer
+	w := multipart.NewWriter(&b)
+	for key, value := range fields {
+		if err := w.WriteField(key, value); err != nil {
+			return err
+		}
+	}
+	fw, err := w.CreateFormFile(field, filepath.Base(fileLoc))
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(fw, file); err != nil {
+		return err
+	}
+	w.Close()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, &b)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	return do(client, req)
+}
+
+// do sends req and turns non-2xx responses into errors
+func do(client *http.Client, req *http.Request) error {
+	resp, err := orDefault(client).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s returned status %s: %s", req.URL.Host, resp.Status, bytes.TrimSpace(body))
+	}
+	return nil
+}
+
+// WebhookNotifier posts notifications as JSON ({"topic","title","message"}) to any URL.
+// Files are posted as a multipart form with "topic" and "file" fields.
+type WebhookNotifier struct {
+	URL    string
+	Topic  string
+	Client *http.Client
+}
+
+func (n *WebhookNotifier) SendMessage(ctx context.Context, title, message string) error {
+	payload := map[string]string{"topic": n.Topic, "title": title, "message": message}
+	return postJSON(ctx, n.Client, "POST", n.URL, nil, payload)
+}
+
+func (n *WebhookNotifier) SendFile(ctx context.Context, fileLoc string) error {
+	return postFile(ctx, n.Client, n.URL, "file", fileLoc, map[string]string{"topic": n.Topic})
+}
+
+// DiscordNotifier posts notifications to a Discord webhook
+type DiscordNotifier struct {
+	URL    string
+	Client *http.Client
+}
+
+func (n *DiscordNotifier) SendMessage(ctx context.Context, title, message string) error {
+	return postJSON(ctx, n.Client, "POST", n.URL, nil, map[string]string{"content": fmt.Sprintf("**%s**\n%s", title, message)})
+}
+
+func (n *DiscordNotifier) SendFile(ctx context.Context, fileLoc string) error {
+	return postFile(ctx, n.Client, n.URL, "files[0]", fileLoc, nil)
+}
+
+// SlackNotifier posts notifications to a Slack (or Slack-compatible, such as Mattermost)
+// incoming webhook. Incoming webhooks cannot upload files.
+type SlackNotifier struct {
+	URL    string
+	Client *http.Client
+}
+
+func (n *SlackNotifier) SendMessage(ctx context.Context, title, message string) error {
+	return postJSON(ctx, n.Client, "POST", n.URL, nil, map[string]string{"text": fmt.Sprintf("*%s*\n%s", title, message)})
+}
+
+func (n *SlackNotifier) SendFile(ctx context.Context, fileLoc string) error {
+	return ErrFileNotSupported
+}
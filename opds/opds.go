@@ -0,0 +1,150 @@
+package opds
+
+import (
+	"encoding/xml"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Media types defined by OPDS 1.2 and OpenSearch
+const (
+	NavigationType  = "application/atom+xml;profile=opds-catalog;kind=navigation"
+	AcquisitionType = "application/atom+xml;profile=opds-catalog;kind=acquisition"
+	OpenSearchType  = "application/opensearchdescription+xml"
+)
+
+// Link relations used in catalog feeds
+const (
+	RelSelf        = "self"
+	RelStart       = "start"
+	RelUp          = "up"
+	RelSubsection  = "subsection"
+	RelSearch      = "search"
+	RelNew         = "http://opds-spec.org/sort/new"
+	RelAcquisition = "http://opds-spec.org/acquisition"
+	RelImage       = "http://opds-spec.org/image"
+	RelThumbnail   = "http://opds-spec.org/image/thumbnail"
+)
+
+// Link is an Atom link
+type Link struct {
+	Rel   string `xml:"rel,attr"`
+	Href  string `xml:"href,attr"`
+	Type  string `xml:"type,attr,omitempty"`
+	Title string `xml:"title,attr,omitempty"`
+}
+
+// Author is an Atom person construct
+type Author struct {
+	Name string `xml:"name"`
+}
+
+// Category is an Atom category, used for book subjects
+type Category struct {
+	Term  string `xml:"term,attr"`
+	Label string `xml:"label,attr,omitempty"`
+}
+
+// Content is Atom text content
+type Content struct {
+	Type string `xml:"type,attr"`
+	Text string `xml:",chardata"`
+}
+
+// Entry is a navigation entry or a publication in an acquisition feed
+type Entry struct {
+	Title      string     `xml:"title"`
+	ID         string     `xml:"id"`
+	Updated    string     `xml:"updated"`
+	Authors    []Author   `xml:"author,omitempty"`
+	Language   string     `xml:"http://purl.org/dc/terms/ language,omitempty"`
+	Issued     string     `xml:"http://purl.org/dc/terms/ issued,omitempty"`
+	Categories []Category `xml:"category,omitempty"`
+	Content    *Content   `xml:"content,omitempty"`
+	Links      []Link     `xml:"link"`
+}
+
+// Feed is an OPDS catalog feed
+type Feed struct {
+	XMLName xml.Name `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string   `xml:"id"`
+	Title   string   `xml:"title"`
+	Updated string   `xml:"updated"`
+	Author  Author   `xml:"author"`
+	Links   []Link   `xml:"link"`
+	Entries []Entry  `xml:"entry"`
+}
+
+// NewFeed creates a feed with self and start links plus a link to the search descriptor
+func NewFeed(id, title, self, kind, start, search string, updated time.Time) *Feed {
+	return &Feed{
+		ID:      id,
+		Title:   title,
+		Updated: Timestamp(updated),
+		Author:  Author{Name: "firelink"},
+		Links: []Link{
+			{Rel: RelSelf, Href: self, Type: kind},
+			{Rel: RelStart, Href: start, Type: NavigationType},
+			{Rel: RelSearch, Href: search, Type: OpenSearchType},
+		},
+	}
+}
+
+// Timestamp formats a time the way Atom expects
+func Timestamp(t time.Time) string {
+	if t.IsZero() {
+		t = time.Unix(0, 0)
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// NavigationEntry links to another catalog feed
+func NavigationEntry(id, title, href, kind, summary string, updated time.Time) Entry {
+	entry := Entry{
+		Title:   title,
+		ID:      id,
+		Updated: Timestamp(updated),
+		Links:   []Link{{Rel: RelSubsection, Href: href, Type: kind}},
+	}
+	if summary != "" {
+		entry.Content = &Content{Type: "text", Text: summary}
+	}
+	return entry
+}
+
+// OpenSearchDescription tells clients how to query the catalog
+type OpenSearchDescription struct {
+	XMLName     xml.Name      `xml:"http://a9.com/-/spec/opensearch/1.1/ OpenSearchDescription"`
+	ShortName   string        `xml:"ShortName"`
+	Description string        `xml:"Description"`
+	InputEncode string        `xml:"InputEncoding"`
+	Url         OpenSearchUrl `xml:"Url"`
+}
+
+// OpenSearchUrl is a search URL template, with {searchTerms} replaced by the query
+type OpenSearchUrl struct {
+	Type     string `xml:"type,attr"`
+	Template string `xml:"template,attr"`
+}
+
+// NewOpenSearch describes a search endpoint returning acquisition feeds
+func NewOpenSearch(name, description, template string) *OpenSearchDescription {
+	return &OpenSearchDescription{
+		ShortName:   name,
+		Description: description,
+		InputEncode: "UTF-8",
+		Url:         OpenSearchUrl{Type: AcquisitionType, Template: template},
+	}
+}
+
+// Respond writes v as an XML document with the given media type
+func Respond(c *gin.Context, contentType string, v any) {
+	data, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Data(http.StatusOK, contentType+";charset=utf-8", append([]byte(xml.Header), data...))
+}
@@ -0,0 +1,42 @@
+package opds
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFeedXML(t *testing.T) {
+	updated := time.Date(2026, 5, 1, 10, 0, 0, 0, time.FixedZone("EST", -5*3600))
+	feed := NewFeed("urn:test", "Test", "/opds", NavigationType, "/opds", "/opds/opensearch.xml", updated)
+	feed.Entries = []Entry{NavigationEntry("urn:test:a", "A", "/opds/a", AcquisitionType, "", updated)}
+
+	data, err := xml.Marshal(feed)
+	require.NoError(t, err)
+	body := string(data)
+	assert.True(t, strings.HasPrefix(body, `<feed xmlns="http://www.w3.org/2005/Atom">`))
+	assert.Contains(t, body, "<updated>2026-05-01T15:00:00Z</updated>")
+	assert.Contains(t, body, `<link rel="search" href="/opds/opensearch.xml" type="application/opensearchdescription+xml"></link>`)
+	assert.Contains(t, body, `<link rel="subsection" href="/opds/a" type="application/atom+xml;profile=opds-catalog;kind=acquisition"></link>`)
+	assert.NotContains(t, body, "<content")
+}
+
+func TestRespond(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+
+	Respond(c, OpenSearchType, NewOpenSearch("firelink", "Search", "/opds/search?q={searchTerms}"))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/opensearchdescription+xml;charset=utf-8", w.Header().Get("Content-Type"))
+	assert.True(t, strings.HasPrefix(w.Body.String(), xml.Header))
+	assert.Contains(t, w.Body.String(), `<Url type="application/atom+xml;profile=opds-catalog;kind=acquisition" template="/opds/search?q={searchTerms}"></Url>`)
+}
@@ -0,0 +1,589 @@
+package outbox
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rjhoppe/firelink/database"
+	"github.com/rjhoppe/firelink/models"
+	"github.com/rjhoppe/firelink/ntfy"
+	"github.com/rjhoppe/firelink/utils"
+	"gorm.io/gorm"
+)
+
+// ErrNotificationNotFound is returned by a Store when no notification matches
+var ErrNotificationNotFound = errors.New("notification not found")
+
+// Store persists the outbox
+type Store interface {
+	Save(n *models.Notification) error
+	Get(id uint) (*models.Notification, error)
+	// List returns the newest notifications first, optionally only those with status
+	List(status string, limit int) ([]models.Notification, error)
+	// Due returns pending notifications whose next attempt is at or before now, oldest first
+	Due(now time.Time, limit int) ([]models.Notification, error)
+	// Requeue moves notifications left sending by a previous run back to pending
+	Requeue() error
+	// HasDuplicate reports whether a notification with key was queued for topic since then,
+	// leaving out dead ones
+	HasDuplicate(topic, key string, since time.Time) (bool, error)
+	// SentSince returns when notifications for topic were sent after since, oldest first
+	SentSince(topic string, since time.Time) ([]time.Time, error)
+	// Held returns held notifications whose digest is due at or before now, oldest first
+	Held(now time.Time) ([]models.Notification, error)
+}
+
+// DBStore is a Store backed by the database
+type DBStore struct{}
+
+func (s *DBStore) Save(n *models.Notification) error {
+	return database.GetDB().Save(n).Error
+}
+
+func (s *DBStore) Get(id uint) (*models.Notification, error) {
+	var n models.Notification
+	err := database.GetDB().First(&n, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotificationNotFound
+	}
+	return &n, err
+}
+
+func (s *DBStore) List(status string, limit int) ([]models.Notification, error) {
+	var notifications []models.Notification
+	query := database.GetDB().Order("id DESC").Limit(limit)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	err := query.Find(&notifications).Error
+	return notifications, err
+}
+
+func (s *DBStore) Due(now time.Time, limit int) ([]models.Notification, error) {
+	var notifications []models.Notification
+	err := database.GetDB().
+		Where("status = ? AND next_attempt_at <= ?", models.NotificationPending, now).
+		Order("next_attempt_at, id").
+		Limit(limit).
+		Find(&notifications).Error
+	return notifications, err
+}
+
+func (s *DBStore) Requeue() error {
+	return database.GetDB().Model(&models.Notification{}).
+		Where("status = ?", models.NotificationSending).
+		Update("status", models.NotificationPending).Error
+}
+
+func (s *DBStore) HasDuplicate(topic, key string, since time.Time) (bool, error) {
+	var count int64
+	err := database.GetDB().Model(&models.Notification{}).
+		Where("topic = ? AND key = ? AND created_at >= ? AND status <> ?", topic, key, since, models.NotificationDead).
+		Count(&count).Error
+	return count > 0, err
+}
+
+func (s *DBStore) SentSince(topic string, since time.Time) ([]time.Time, error) {
+	var sent []time.Time
+	err := database.GetDB().Model(&models.Notification{}).
+		Where("topic = ? AND status = ? AND sent_at > ?", topic, models.NotificationSent, since).
+		Order("sent_at").
+		Pluck("sent_at", &sent).Error
+	return sent, err
+}
+
+func (s *DBStore) Held(now time.Time) ([]models.Notification, error) {
+	var notifications []models.Notification
+	err := database.GetDB().
+		Where("status = ? AND next_attempt_at <= ?", models.NotificationHeld, now).
+		Order("id").
+		Find(&notifications).Error
+	return notifications, err
+}
+
+// Outbox stores notifications and delivers them in the background with a pool of
+// workers, retrying failures with exponential backoff until MaxAttempts is reached,
+// after which they are dead-lettered for inspection and replay. Per-topic Preferences
+// add quiet hours, rate limits, de-duplication and daily digests.
+type Outbox struct {
+	Store        Store
+	Preferences  map[string]Preferences
+	Deliver      func(ctx context.Context, env ntfy.Envelope) ([]string, error)
+	Workers      int
+	MaxAttempts  int
+	BaseDelay    time.Duration // delay before the first retry, doubled for each further one
+	MaxDelay     time.Duration
+	PollInterval time.Duration
+	Timeout      time.Duration // deadline of a single delivery attempt
+
+	now      func() time.Time
+	wake     chan struct{}
+	once     sync.Once
+	mu       sync.Mutex
+	inflight map[string]int // notifications being delivered per topic, counted by rate limits
+}
+
+// New creates an outbox delivering with ntfy.Deliver, configured from OUTBOX_WORKERS (4),
+// OUTBOX_MAX_ATTEMPTS (8), OUTBOX_RETRY_BASE (30s), OUTBOX_RETRY_MAX (1h),
+// OUTBOX_POLL_INTERVAL (5s), NTFY_TIMEOUT (10s) and the given topic preferences
+func New(store Store, prefs map[string]Preferences) *Outbox {
+	return &Outbox{
+		Store:        store,
+		Preferences:  prefs,
+		Deliver:      ntfy.Deliver,
+		Workers:      utils.GetEnvInt("OUTBOX_WORKERS", 4),
+		MaxAttempts:  utils.GetEnvInt("OUTBOX_MAX_ATTEMPTS", 8),
+		BaseDelay:    utils.GetEnvDuration("OUTBOX_RETRY_BASE", 30*time.Second),
+		MaxDelay:     utils.GetEnvDuration("OUTBOX_RETRY_MAX", time.Hour),
+		PollInterval: utils.GetEnvDuration("OUTBOX_POLL_INTERVAL", 5*time.Second),
+		Timeout:      utils.GetEnvDuration("NTFY_TIMEOUT", 10*time.Second),
+	}
+}
+
+func (o *Outbox) init() {
+	o.once.Do(func() {
+		o.wake = make(chan struct{}, 1)
+		o.inflight = map[string]int{}
+		if o.now == nil {
+			o.now = time.Now
+		}
+		o.Workers = max(o.Workers, 1)
+		o.MaxAttempts = max(o.MaxAttempts, 1)
+	})
+}
+
+// signal wakes the dispatcher without waiting for the next poll
+func (o *Outbox) signal() {
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+}
+
+// contentKey is the checksum identifying identical notifications
+func contentKey(n *models.Notification) string {
+	hash := sha256.New()
+	for _, part := range []string{n.Topic, n.Title, n.Body, n.Options, n.File} {
+		hash.Write([]byte(part))
+		hash.Write([]byte{0})
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// messageOptions encodes the publish options of a message, empty when it has none
+func messageOptions(msg ntfy.Message) string {
+	if options, err := json.Marshal(msg); err == nil && string(options) != "{}" {
+		return string(options)
+	}
+	return ""
+}
+
+// Enqueue implements ntfy.Queue. Duplicates within the topic's de-duplication window are
+// dropped, and messages of topics with a digest are held until it is due.
+func (o *Outbox) Enqueue(ctx context.Context, env ntfy.Envelope) error {
+	o.init()
+	now := o.now()
+	n := models.Notification{
+		Topic:         env.Topic,
+		Title:         env.Message.Title,
+		Body:          env.Message.Body,
+		File:          env.File,
+		Status:        models.NotificationPending,
+		NextAttemptAt: now,
+	}
+	n.CreatedAt = now
+	n.Options = messageOptions(env.Message)
+	n.Key = contentKey(&n)
+
+	prefs := o.Preferences[n.Topic]
+	if prefs.DedupWindow > 0 {
+		duplicate, err := o.Store.HasDuplicate(n.Topic, n.Key, now.Add(-prefs.DedupWindow))
+		if err != nil {
+			return fmt.Errorf("could not check for duplicate notifications: %w", err)
+		}
+		if duplicate {
+			return nil
+		}
+	}
+	// Files such as database backups are sent on their own rather than summarized
+	if prefs.DigestAt != "" && n.File == "" {
+		next, err := nextClock(prefs.DigestAt, now)
+		if err == nil {
+			n.Status, n.NextAttemptAt = models.NotificationHeld, next
+		}
+	}
+
+	if err := o.Store.Save(&n); err != nil {
+		return fmt.Errorf("could not queue notification: %w", err)
+	}
+	if n.Status == models.NotificationPending {
+		o.signal()
+	}
+	return nil
+}
+
+// envelope rebuilds the envelope a notification was queued from
+func envelope(n *models.Notification) (ntfy.Envelope, error) {
+	env := ntfy.Envelope{Topic: n.Topic, File: n.File}
+	if n.Delivered != "" {
+		env.Delivered = strings.Split(n.Delivered, ",")
+	}
+	if n.Options != "" {
+		if err := json.Unmarshal([]byte(n.Options), &env.Message); err != nil {
+			return env, fmt.Errorf("invalid options: %w", err)
+		}
+	}
+	env.Message.Title, env.Message.Body = n.Title, n.Body
+	return env, nil
+}
+
+// backoff returns the delay before retrying after the given number of failed attempts
+func (o *Outbox) backoff(attempts int) time.Duration {
+	delay := o.BaseDelay
+	for i := 1; i < attempts && delay < o.MaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, o.MaxDelay)
+}
+
+// deliver makes one delivery attempt and records its outcome
+func (o *Outbox) deliver(ctx context.Context, n models.Notification) {
+	env, err := envelope(&n)
+	if err == nil {
+		// Let an attempt in flight finish when shutting down rather than count it as failed
+		attemptCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), o.Timeout)
+		var delivered []string
+		delivered, err = o.Deliver(attemptCtx, env)
+		cancel()
+		if len(delivered) > 0 {
+			n.Delivered = strings.Join(append(env.Delivered, delivered...), ",")
+		}
+	}
+
+	n.Attempts++
+	now := o.now()
+	switch {
+	case err == nil:
+		n.Status = models.NotificationSent
+		n.SentAt = &now
+		n.LastError = ""
+	case n.Attempts >= o.MaxAttempts:
+		n.Status = models.NotificationDead
+		n.LastError = err.Error()
+		log.Printf("Notification %d dead after %d attempts: %v", n.ID, n.Attempts, err)
+	default:
+		n.Status = models.NotificationPending
+		n.LastError = err.Error()
+		n.NextAttemptAt = now.Add(o.backoff(n.Attempts))
+	}
+	if err := o.Store.Save(&n); err != nil {
+		log.Printf("Could not record notification %d: %v", n.ID, err)
+	}
+	o.mu.Lock()
+	o.inflight[n.Topic]--
+	o.mu.Unlock()
+}
+
+// holdUntil returns when a due notification may be delivered given its topic's quiet
+// hours and rate limit, and false when it may be delivered now
+func (o *Outbox) holdUntil(n *models.Notification, now time.Time) (time.Time, bool, error) {
+	prefs := o.Preferences[n.Topic]
+	if until, quiet := prefs.quietUntil(now); quiet {
+		return until, true, nil
+	}
+	if prefs.RateLimit > 0 {
+		sent, err := o.Store.SentSince(n.Topic, now.Add(-prefs.RateWindow))
+		if err != nil {
+			return time.Time{}, false, err
+		}
+		o.mu.Lock()
+		inflight := o.inflight[n.Topic]
+		o.mu.Unlock()
+		if len(sent)+inflight >= prefs.RateLimit {
+			// Wait for the oldest delivery in the window to leave it, or a full
+			// window when the limit is taken up by deliveries still in flight
+			if over := len(sent) + inflight - prefs.RateLimit; over < len(sent) {
+				return sent[over].Add(prefs.RateWindow), true, nil
+			}
+			return now.Add(prefs.RateWindow), true, nil
+		}
+	}
+	return time.Time{}, false, nil
+}
+
+// digest queues one summary per topic of the held notifications that are due
+func (o *Outbox) digest(now time.Time) {
+	held, err := o.Store.Held(now)
+	if err != nil {
+		log.Printf("Could not load held notifications: %v", err)
+		return
+	}
+	byTopic := map[string][]models.Notification{}
+	var topics []string
+	for _, n := range held {
+		if _, ok := byTopic[n.Topic]; !ok {
+			topics = append(topics, n.Topic)
+		}
+		byTopic[n.Topic] = append(byTopic[n.Topic], n)
+	}
+
+	for _, topic := range topics {
+		// A notification that cannot be decoded is dead-lettered rather than dropped
+		var included []models.Notification
+		messages := make([]ntfy.Message, 0, len(byTopic[topic]))
+		for _, n := range byTopic[topic] {
+			env, err := envelope(&n)
+			if err != nil {
+				n.Status, n.LastError = models.NotificationDead, err.Error()
+				if err := o.Store.Save(&n); err != nil {
+					log.Printf("Could not record notification %d: %v", n.ID, err)
+				}
+				continue
+			}
+			included = append(included, n)
+			messages = append(messages, env.Message)
+		}
+		if len(included) == 0 {
+			continue
+		}
+		msg := ntfy.DigestMessage(topic, messages)
+		summary := models.Notification{
+			Topic:         topic,
+			Title:         msg.Title,
+			Body:          msg.Body,
+			Status:        models.NotificationPending,
+			NextAttemptAt: now,
+		}
+		summary.Options = messageOptions(msg)
+		summary.Key = contentKey(&summary)
+		if err := o.Store.Save(&summary); err != nil {
+			log.Printf("Could not queue %s digest: %v", topic, err)
+			continue
+		}
+		for _, n := range included {
+			n.Status = models.NotificationDigested
+			if err := o.Store.Save(&n); err != nil {
+				log.Printf("Could not record notification %d: %v", n.ID, err)
+			}
+		}
+	}
+}
+
+// dispatch queues due digests and hands the due notifications to the workers, marking
+// them sending so the next poll does not pick them up again. Notifications in quiet
+// hours or over their topic's rate limit are put back until they may be sent.
+func (o *Outbox) dispatch(ctx context.Context, jobs chan<- models.Notification) {
+	now := o.now()
+	o.digest(now)
+	due, err := o.Store.Due(now, o.Workers*4)
+	if err != nil {
+		log.Printf("Could not load due notifications: %v", err)
+		return
+	}
+	for _, n := range due {
+		until, hold, err := o.holdUntil(&n, now)
+		if err != nil {
+			log.Printf("Could not check notification %d against its preferences: %v", n.ID, err)
+			continue
+		}
+		if hold {
+			n.NextAttemptAt = until
+		} else {
+			n.Status = models.NotificationSending
+		}
+		if err := o.Store.Save(&n); err != nil {
+			log.Printf("Could not claim notification %d: %v", n.ID, err)
+			continue
+		}
+		if hold {
+			continue
+		}
+		select {
+		case jobs <- n:
+			// The worker may finish first, leaving the count briefly negative, but it
+			// balances out before the next notification is checked
+			o.mu.Lock()
+			o.inflight[n.Topic]++
+			o.mu.Unlock()
+		case <-ctx.Done():
+			o.release(n)
+			return
+		}
+	}
+}
+
+// release puts back a notification claimed for delivery but never handed to a worker
+func (o *Outbox) release(n models.Notification) {
+	n.Status = models.NotificationPending
+	if err := o.Store.Save(&n); err != nil {
+		log.Printf("Could not release notification %d: %v", n.ID, err)
+	}
+}
+
+// Run delivers queued notifications until ctx is done
+func (o *Outbox) Run(ctx context.Context) {
+	o.init()
+	if err := o.Store.Requeue(); err != nil {
+		log.Printf("Could not requeue notifications: %v", err)
+	}
+
+	jobs := make(chan models.Notification)
+	var wg sync.WaitGroup
+	for range o.Workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := range jobs {
+				o.deliver(ctx, n)
+			}
+		}()
+	}
+
+	ticker := time.NewTicker(o.PollInterval)
+	defer ticker.Stop()
+	for {
+		o.dispatch(ctx, jobs)
+		select {
+		case <-ctx.Done():
+			close(jobs)
+			wg.Wait()
+			return
+		case <-ticker.C:
+		case <-o.wake:
+		}
+	}
+}
+
+// replay makes a notification due again with a fresh set of attempts. A sent notification
+// goes to every backend again, a dead one only to the backends it did not reach.
+func (o *Outbox) replay(n *models.Notification) error {
+	if n.Status == models.NotificationSent {
+		n.Delivered = ""
+	}
+	n.Status = models.NotificationPending
+	n.Attempts = 0
+	n.NextAttemptAt = o.now()
+	return o.Store.Save(n)
+}
+
+// findNotification looks up the notification named by the :id parameter, responding on failure
+func (o *Outbox) findNotification(c *gin.Context, notificationId string) (*models.Notification, bool) {
+	id, err := strconv.ParseUint(notificationId, 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid notification id"})
+		return nil, false
+	}
+	n, err := o.Store.Get(uint(id))
+	if errors.Is(err, ErrNotificationNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Notification not found"})
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Error loading notification: %v", err)})
+		return nil, false
+	}
+	return n, true
+}
+
+// ListNotifications returns the newest notifications, filtered by ?status= and capped by ?limit= (default 50)
+func (o *Outbox) ListNotifications(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit < 1 || limit > 500 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 500"})
+		return
+	}
+	notifications, err := o.Store.List(c.Query("status"), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Error listing notifications: %v", err)})
+		return
+	}
+	if notifications == nil {
+		notifications = []models.Notification{}
+	}
+	c.JSON(http.StatusOK, gin.H{"notifications": notifications})
+}
+
+// GetNotification returns a single notification with its attempts and last error
+func (o *Outbox) GetNotification(c *gin.Context, notificationId string) {
+	n, ok := o.findNotification(c, notificationId)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, n)
+}
+
+// ReplayNotification queues a notification for delivery again. Notifications waiting for or
+// included in a digest are refused, since the digest already delivers them.
+func (o *Outbox) ReplayNotification(c *gin.Context, notificationId string) {
+	o.init()
+	n, ok := o.findNotification(c, notificationId)
+	if !ok {
+		return
+	}
+	switch n.Status {
+	case models.NotificationSending:
+		c.JSON(http.StatusConflict, gin.H{"error": "Notification is being delivered"})
+		return
+	case models.NotificationHeld, models.NotificationDigested:
+		c.JSON(http.StatusConflict, gin.H{"error": "Notification is delivered as part of a digest"})
+		return
+	}
+	if err := o.replay(n); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Error replaying notification: %v", err)})
+		return
+	}
+	o.signal()
+	c.JSON(http.StatusOK, n)
+}
+
+// ReplayDead queues every dead-lettered notification for delivery again
+func (o *Outbox) ReplayDead(c *gin.Context) {
+	o.init()
+	dead, err := o.Store.List(models.NotificationDead, 1000)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Error listing notifications: %v", err)})
+		return
+	}
+	for i := range dead {
+		if err := o.replay(&dead[i]); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Error replaying notification: %v", err)})
+			return
+		}
+	}
+	o.signal()
+	c.JSON(http.StatusOK, gin.H{"replayed": len(dead)})
+}
+
+// GetPreferences returns the quiet hours, rate limit, de-duplication window and digest time of each topic
+func (o *Outbox) GetPreferences(c *gin.Context) {
+	topics := gin.H{}
+	for _, topic := range ntfy.Topics {
+		prefs := o.Preferences[topic]
+		entry := gin.H{}
+		if prefs.QuietStart != "" {
+			entry["quiet_hours"] = prefs.QuietStart + "-" + prefs.QuietEnd
+		}
+		if prefs.RateLimit > 0 {
+			entry["rate_limit"] = fmt.Sprintf("%d/%s", prefs.RateLimit, prefs.RateWindow)
+		}
+		if prefs.DedupWindow > 0 {
+			entry["dedup_window"] = prefs.DedupWindow.String()
+		}
+		if prefs.DigestAt != "" {
+			entry["digest_at"] = prefs.DigestAt
+		}
+		topics[topic] = entry
+	}
+	c.JSON(http.StatusOK, gin.H{"topics": topics})
+}
@@ -0,0 +1,311 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rjhoppe/firelink/models"
+	"github.com/rjhoppe/firelink/ntfy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// MemoryStore is an in-memory Store
+type MemoryStore struct {
+	mu            sync.Mutex
+	notifications map[uint]models.Notification
+	nextId        uint
+}
+
+func (s *MemoryStore) Save(n *models.Notification) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.notifications == nil {
+		s.notifications = map[uint]models.Notification{}
+	}
+	if n.ID == 0 {
+		s.nextId++
+		n.ID = s.nextId
+	}
+	s.notifications[n.ID] = *n
+	return nil
+}
+
+func (s *MemoryStore) Get(id uint) (*models.Notification, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n, ok := s.notifications[id]
+	if !ok {
+		return nil, ErrNotificationNotFound
+	}
+	return &n, nil
+}
+
+func (s *MemoryStore) sorted(keep func(models.Notification) bool) []models.Notification {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var notifications []models.Notification
+	for _, n := range s.notifications {
+		if keep(n) {
+			notifications = append(notifications, n)
+		}
+	}
+	sort.Slice(notifications, func(i, j int) bool { return notifications[i].ID < notifications[j].ID })
+	return notifications
+}
+
+func (s *MemoryStore) List(status string, limit int) ([]models.Notification, error) {
+	notifications := s.sorted(func(n models.Notification) bool { return status == "" || n.Status == status })
+	sort.Slice(notifications, func(i, j int) bool { return notifications[i].ID > notifications[j].ID })
+	return notifications[:min(limit, len(notifications))], nil
+}
+
+func (s *MemoryStore) Due(now time.Time, limit int) ([]models.Notification, error) {
+	notifications := s.sorted(func(n models.Notification) bool {
+		return n.Status == models.NotificationPending && !n.NextAttemptAt.After(now)
+	})
+	return notifications[:min(limit, len(notifications))], nil
+}
+
+func (s *MemoryStore) Requeue() error {
+	for _, n := range s.sorted(func(n models.Notification) bool { return n.Status == models.NotificationSending }) {
+		n.Status = models.NotificationPending
+		s.Save(&n)
+	}
+	return nil
+}
+
+func (s *MemoryStore) HasDuplicate(topic, key string, since time.Time) (bool, error) {
+	duplicates := s.sorted(func(n models.Notification) bool {
+		return n.Topic == topic && n.Key == key && !n.CreatedAt.Before(since) && n.Status != models.NotificationDead
+	})
+	return len(duplicates) > 0, nil
+}
+
+func (s *MemoryStore) SentSince(topic string, since time.Time) ([]time.Time, error) {
+	var sent []time.Time
+	for _, n := range s.sorted(func(n models.Notification) bool {
+		return n.Topic == topic && n.Status == models.NotificationSent && n.SentAt.After(since)
+	}) {
+		sent = append(sent, *n.SentAt)
+	}
+	sort.Slice(sent, func(i, j int) bool { return sent[i].Before(sent[j]) })
+	return sent, nil
+}
+
+func (s *MemoryStore) Held(now time.Time) ([]models.Notification, error) {
+	return s.sorted(func(n models.Notification) bool {
+		return n.Status == models.NotificationHeld && !n.NextAttemptAt.After(now)
+	}), nil
+}
+
+// newTestOutbox creates an outbox whose deliveries fail while fail is set
+func newTestOutbox(fail *bool) (*Outbox, *MemoryStore, *[]ntfy.Envelope) {
+	store := &MemoryStore{}
+	var mu sync.Mutex
+	var delivered []ntfy.Envelope
+	clock := time.Date(2026, 10, 19, 7, 0, 0, 0, time.UTC)
+	o := &Outbox{
+		Store: store,
+		Deliver: func(ctx context.Context, env ntfy.Envelope) ([]string, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			if *fail {
+				return nil, errors.New("ntfy unreachable")
+			}
+			delivered = append(delivered, env)
+			return []string{"ntfy"}, nil
+		},
+		Workers:      2,
+		MaxAttempts:  3,
+		BaseDelay:    time.Minute,
+		MaxDelay:     90 * time.Second,
+		PollInterval: time.Hour,
+		Timeout:      time.Second,
+		now:          func() time.Time { return clock },
+	}
+	return o, store, &delivered
+}
+
+// pass dispatches the due notifications and waits for them to be delivered
+func pass(o *Outbox) {
+	jobs := make(chan models.Notification)
+	done := make(chan struct{})
+	go func() {
+		for n := range jobs {
+			o.deliver(context.Background(), n)
+		}
+		close(done)
+	}()
+	o.dispatch(context.Background(), jobs)
+	close(jobs)
+	<-done
+}
+
+func TestOutbox_DeliversWithOptions(t *testing.T) {
+	fail := false
+	o, store, delivered := newTestOutbox(&fail)
+	notifier := &ntfy.QueuedNotifier{Topic: "dinner", Queue: o}
+
+	require.NoError(t, notifier.Publish(context.Background(), ntfy.Message{Title: "Recipe", Body: "Pasta", Click: "https://example.com/pasta"}))
+	require.NoError(t, notifier.SendFile(context.Background(), "/app/database/backup.sql"))
+
+	n, _ := store.Get(1)
+	assert.Equal(t, models.NotificationPending, n.Status)
+	assert.JSONEq(t, `{"click": "https://example.com/pasta"}`, n.Options)
+
+	pass(o)
+	require.Len(t, *delivered, 2)
+	assert.Contains(t, *delivered, ntfy.Envelope{Topic: "dinner", Message: ntfy.Message{Title: "Recipe", Body: "Pasta", Click: "https://example.com/pasta"}})
+	assert.Contains(t, *delivered, ntfy.Envelope{Topic: "dinner", File: "/app/database/backup.sql"})
+
+	n, _ = store.Get(1)
+	assert.Equal(t, models.NotificationSent, n.Status)
+	assert.Equal(t, 1, n.Attempts)
+	assert.NotNil(t, n.SentAt)
+}
+
+func TestOutbox_RetriesThenDeadLetters(t *testing.T) {
+	fail := true
+	o, store, _ := newTestOutbox(&fail)
+	start := o.now()
+	require.NoError(t, o.Enqueue(context.Background(), ntfy.Envelope{Topic: "drink", Message: ntfy.Message{Title: "Drink", Body: "Mojito"}}))
+
+	pass(o)
+	n, _ := store.Get(1)
+	assert.Equal(t, models.NotificationPending, n.Status)
+	assert.Equal(t, "ntfy unreachable", n.LastError)
+	assert.Equal(t, start.Add(time.Minute), n.NextAttemptAt)
+
+	// Not due yet
+	pass(o)
+	n, _ = store.Get(1)
+	assert.Equal(t, 1, n.Attempts)
+
+	o.now = func() time.Time { return start.Add(time.Hour) }
+	pass(o)
+	n, _ = store.Get(1)
+	assert.Equal(t, 2, n.Attempts)
+	// Doubled backoff is capped at MaxDelay
+	assert.Equal(t, start.Add(time.Hour+90*time.Second), n.NextAttemptAt)
+
+	o.now = func() time.Time { return start.Add(2 * time.Hour) }
+	pass(o)
+	n, _ = store.Get(1)
+	assert.Equal(t, models.NotificationDead, n.Status)
+	assert.Equal(t, 3, n.Attempts)
+}
+
+func TestOutbox_RetriesOnlyFailedBackends(t *testing.T) {
+	fail := false
+	o, store, _ := newTestOutbox(&fail)
+	var attempts [][]string
+	o.Deliver = func(ctx context.Context, env ntfy.Envelope) ([]string, error) {
+		attempts = append(attempts, env.Delivered)
+		if len(attempts) == 1 {
+			return []string{"ntfy"}, errors.New("gotify: connection refused")
+		}
+		return []string{"gotify"}, nil
+	}
+	start := o.now()
+	require.NoError(t, o.Enqueue(context.Background(), ntfy.Envelope{Topic: "drink", Message: ntfy.Message{Title: "Drink", Body: "Mojito"}}))
+
+	pass(o)
+	n, _ := store.Get(1)
+	assert.Equal(t, models.NotificationPending, n.Status)
+	assert.Equal(t, "ntfy", n.Delivered)
+
+	o.now = func() time.Time { return start.Add(time.Hour) }
+	pass(o)
+	n, _ = store.Get(1)
+	assert.Equal(t, models.NotificationSent, n.Status)
+	assert.Equal(t, "ntfy,gotify", n.Delivered)
+	assert.Equal(t, [][]string{nil, {"ntfy"}}, attempts)
+}
+
+func TestOutbox_DispatchReleasesOnShutdown(t *testing.T) {
+	fail := false
+	o, store, _ := newTestOutbox(&fail)
+	require.NoError(t, o.Enqueue(context.Background(), ntfy.Envelope{Topic: "drink", Message: ntfy.Message{Title: "Drink"}}))
+
+	// Nobody takes the job, as when the workers have stopped
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	o.dispatch(ctx, make(chan models.Notification))
+
+	n, _ := store.Get(1)
+	assert.Equal(t, models.NotificationPending, n.Status)
+	assert.Zero(t, o.inflight["drink"])
+}
+
+func TestOutbox_ReplayEndpoints(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	fail := true
+	o, _, delivered := newTestOutbox(&fail)
+	o.MaxAttempts = 1
+	for _, title := range []string{"One", "Two"} {
+		require.NoError(t, o.Enqueue(context.Background(), ntfy.Envelope{Topic: "system", Message: ntfy.Message{Title: title}}))
+	}
+	pass(o)
+
+	call := func(method, path string, handle func(c *gin.Context)) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(method, path, nil)
+		handle(c)
+		return w
+	}
+
+	w := call("GET", "/admin/notifications?status=dead", o.ListNotifications)
+	require.Equal(t, http.StatusOK, w.Code)
+	var list struct {
+		Notifications []models.Notification `json:"notifications"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	require.Len(t, list.Notifications, 2)
+	assert.Equal(t, "Two", list.Notifications[0].Title)
+
+	fail = false
+	w = call("POST", "/admin/notifications/1/replay", func(c *gin.Context) { o.ReplayNotification(c, "1") })
+	require.Equal(t, http.StatusOK, w.Code)
+	pass(o)
+	require.Len(t, *delivered, 1)
+	assert.Equal(t, "One", (*delivered)[0].Message.Title)
+
+	w = call("POST", "/admin/notifications/replay", o.ReplayDead)
+	assert.JSONEq(t, `{"replayed": 1}`, w.Body.String())
+	pass(o)
+	assert.Len(t, *delivered, 2)
+
+	assert.Equal(t, http.StatusNotFound, call("GET", "/admin/notifications/9", func(c *gin.Context) { o.GetNotification(c, "9") }).Code)
+}
+
+func TestOutbox_RunRequeuesAndStops(t *testing.T) {
+	fail := false
+	o, store, delivered := newTestOutbox(&fail)
+	// Left sending by a run that crashed
+	require.NoError(t, store.Save(&models.Notification{Topic: "books", Title: "Stuck", Status: models.NotificationSending}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		o.Run(ctx)
+		close(done)
+	}()
+
+	require.Eventually(t, func() bool {
+		n, _ := store.Get(1)
+		return n.Status == models.NotificationSent
+	}, time.Second, 10*time.Millisecond)
+	cancel()
+	<-done
+	assert.Equal(t, "Stuck", (*delivered)[0].Message.Title)
+}
@@ -0,0 +1,177 @@
+package outbox
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rjhoppe/firelink/ntfy"
+)
+
+// Preferences control when and how often a topic's notifications are delivered
+type Preferences struct {
+	// QuietStart and QuietEnd ("HH:MM", local time) delay deliveries until the quiet
+	// hours end. The window may span midnight, as in 22:00-07:00.
+	QuietStart string
+	QuietEnd   string
+	// RateLimit is the most notifications delivered per RateWindow, later ones wait
+	RateLimit  int
+	RateWindow time.Duration
+	// DedupWindow drops notifications identical to one queued within the window
+	DedupWindow time.Duration
+	// DigestAt ("HH:MM") holds messages and sends them as one summary at that time each day
+	DigestAt string
+}
+
+// parseClock parses a local time of day such as "07:00"
+func parseClock(at string) (time.Time, error) {
+	clock, err := time.Parse("15:04", at)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q, use HH:MM", at)
+	}
+	return clock, nil
+}
+
+// at returns the time of day clock on the day of now
+func at(clock time.Time, now time.Time) time.Time {
+	return time.Date(now.Year(), now.Month(), now.Day(), clock.Hour(), clock.Minute(), 0, 0, now.Location())
+}
+
+// nextClock returns the first time after now that the clock reads clock
+func nextClock(clock string, now time.Time) (time.Time, error) {
+	parsed, err := parseClock(clock)
+	if err != nil {
+		return time.Time{}, err
+	}
+	next := at(parsed, now)
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next, nil
+}
+
+// quietUntil returns when the quiet hours around now end, and false outside quiet hours
+func (p Preferences) quietUntil(now time.Time) (time.Time, bool) {
+	if p.QuietStart == "" || p.QuietEnd == "" {
+		return time.Time{}, false
+	}
+	startClock, err := parseClock(p.QuietStart)
+	if err != nil {
+		return time.Time{}, false
+	}
+	endClock, err := parseClock(p.QuietEnd)
+	if err != nil {
+		return time.Time{}, false
+	}
+	start, end := at(startClock, now), at(endClock, now)
+	switch {
+	case start.Before(end):
+		return end, !now.Before(start) && now.Before(end)
+	case !now.Before(start):
+		// Overnight quiet hours that started this evening end tomorrow
+		return end.AddDate(0, 0, 1), true
+	default:
+		return end, now.Before(end)
+	}
+}
+
+// validate reports settings that cannot be used
+func (p Preferences) validate() error {
+	var errs []error
+	for _, clock := range []string{p.QuietStart, p.QuietEnd, p.DigestAt} {
+		if clock != "" {
+			if _, err := parseClock(clock); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	if (p.QuietStart == "") != (p.QuietEnd == "") {
+		errs = append(errs, errors.New("quiet hours need a start and an end"))
+	}
+	if p.RateLimit > 0 && p.RateWindow <= 0 {
+		errs = append(errs, errors.New("rate limit needs a window"))
+	}
+	return errors.Join(errs...)
+}
+
+// parseQuietHours parses "22:00-07:00"
+func parseQuietHours(value string) (string, string, error) {
+	start, end, ok := strings.Cut(value, "-")
+	if !ok {
+		return "", "", fmt.Errorf("invalid quiet hours %q, use HH:MM-HH:MM", value)
+	}
+	return strings.TrimSpace(start), strings.TrimSpace(end), nil
+}
+
+// parseRateLimit parses "5/1h" as at most 5 notifications per hour
+func parseRateLimit(value string) (int, time.Duration, error) {
+	count, window, ok := strings.Cut(value, "/")
+	limit, err := strconv.Atoi(strings.TrimSpace(count))
+	if !ok || err != nil || limit < 1 {
+		return 0, 0, fmt.Errorf("invalid rate limit %q, use COUNT/DURATION such as 5/1h", value)
+	}
+	duration, err := time.ParseDuration(strings.TrimSpace(window))
+	if err != nil || duration <= 0 {
+		return 0, 0, fmt.Errorf("invalid rate limit %q, use COUNT/DURATION such as 5/1h", value)
+	}
+	return limit, duration, nil
+}
+
+// preferencesFromEnv reads the settings under prefix on top of defaults
+func preferencesFromEnv(prefix string, defaults Preferences) (Preferences, error) {
+	p := defaults
+	var errs []error
+	if value := os.Getenv(prefix + "_QUIET_HOURS"); value != "" {
+		start, end, err := parseQuietHours(value)
+		if err != nil {
+			errs = append(errs, err)
+		} else {
+			p.QuietStart, p.QuietEnd = start, end
+		}
+	}
+	if value := os.Getenv(prefix + "_RATE_LIMIT"); value != "" {
+		limit, window, err := parseRateLimit(value)
+		if err != nil {
+			errs = append(errs, err)
+		} else {
+			p.RateLimit, p.RateWindow = limit, window
+		}
+	}
+	if value := os.Getenv(prefix + "_DEDUP_WINDOW"); value != "" {
+		window, err := time.ParseDuration(value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid %s_DEDUP_WINDOW %q", prefix, value))
+		} else {
+			p.DedupWindow = window
+		}
+	}
+	if value, ok := os.LookupEnv(prefix + "_DIGEST"); ok {
+		p.DigestAt = strings.TrimSpace(value)
+	}
+	if err := p.validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if len(errs) > 0 {
+		return defaults, fmt.Errorf("%s: %w", prefix, errors.Join(errs...))
+	}
+	return p, nil
+}
+
+// PreferencesFromEnv reads the preferences of every topic. NOTIFY_QUIET_HOURS
+// ("22:00-07:00"), NOTIFY_RATE_LIMIT ("5/1h"), NOTIFY_DEDUP_WINDOW ("1h") and
+// NOTIFY_DIGEST ("18:00") apply to all topics, and NOTIFY_<TOPIC>_* override them for
+// one topic, such as NOTIFY_DINNER_DIGEST. Invalid settings are reported and ignored.
+func PreferencesFromEnv() (map[string]Preferences, error) {
+	defaults, err := preferencesFromEnv("NOTIFY", Preferences{})
+	errs := []error{err}
+	prefs := map[string]Preferences{}
+	for _, topic := range ntfy.Topics {
+		p, err := preferencesFromEnv("NOTIFY_"+strings.ToUpper(topic), defaults)
+		errs = append(errs, err)
+		prefs[topic] = p
+	}
+	return prefs, errors.Join(errs...)
+}
@@ -0,0 +1,162 @@
+package outbox
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rjhoppe/firelink/models"
+	"github.com/rjhoppe/firelink/ntfy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuietUntil(t *testing.T) {
+	overnight := Preferences{QuietStart: "22:00", QuietEnd: "07:00"}
+	day := time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)
+
+	until, quiet := overnight.quietUntil(day.Add(23 * time.Hour))
+	assert.True(t, quiet)
+	assert.Equal(t, day.Add(31*time.Hour), until)
+
+	until, quiet = overnight.quietUntil(day.Add(6 * time.Hour))
+	assert.True(t, quiet)
+	assert.Equal(t, day.Add(7*time.Hour), until)
+
+	_, quiet = overnight.quietUntil(day.Add(12 * time.Hour))
+	assert.False(t, quiet)
+
+	lunch := Preferences{QuietStart: "12:00", QuietEnd: "13:00"}
+	until, quiet = lunch.quietUntil(day.Add(12*time.Hour + 30*time.Minute))
+	assert.True(t, quiet)
+	assert.Equal(t, day.Add(13*time.Hour), until)
+}
+
+func TestPreferencesFromEnv(t *testing.T) {
+	t.Setenv("NOTIFY_QUIET_HOURS", "22:00-07:00")
+	t.Setenv("NOTIFY_DINNER_RATE_LIMIT", "1/1h")
+	t.Setenv("NOTIFY_DINNER_DEDUP_WINDOW", "30m")
+	t.Setenv("NOTIFY_DRINK_DIGEST", "18:00")
+	t.Setenv("NOTIFY_SYSTEM_QUIET_HOURS", "")
+	t.Setenv("NOTIFY_BOOKS_RATE_LIMIT", "lots")
+
+	prefs, err := PreferencesFromEnv()
+	assert.EqualError(t, err, "NOTIFY_BOOKS: invalid rate limit \"lots\", use COUNT/DURATION such as 5/1h")
+	assert.Equal(t, Preferences{QuietStart: "22:00", QuietEnd: "07:00", RateLimit: 1, RateWindow: time.Hour, DedupWindow: 30 * time.Minute}, prefs["dinner"])
+	assert.Equal(t, Preferences{QuietStart: "22:00", QuietEnd: "07:00", DigestAt: "18:00"}, prefs["drink"])
+	// Invalid settings fall back to the defaults
+	assert.Equal(t, Preferences{QuietStart: "22:00", QuietEnd: "07:00"}, prefs["books"])
+}
+
+func TestOutbox_QuietHoursAndRateLimit(t *testing.T) {
+	fail := false
+	o, store, delivered := newTestOutbox(&fail)
+	start := o.now() // 07:00
+	o.Preferences = map[string]Preferences{
+		"dinner": {QuietStart: "22:00", QuietEnd: "07:30", RateLimit: 2, RateWindow: time.Hour},
+	}
+	for _, title := range []string{"One", "Two", "Three"} {
+		require.NoError(t, o.Enqueue(context.Background(), ntfy.Envelope{Topic: "dinner", Message: ntfy.Message{Title: title}}))
+	}
+
+	// Quiet until 07:30, without using up an attempt
+	pass(o)
+	assert.Empty(t, *delivered)
+	n, _ := store.Get(1)
+	assert.Equal(t, start.Add(30*time.Minute), n.NextAttemptAt)
+	assert.Zero(t, n.Attempts)
+
+	o.now = func() time.Time { return start.Add(30 * time.Minute) }
+	pass(o)
+	require.Len(t, *delivered, 2)
+
+	// The third waits for the first delivery to leave the window
+	n, _ = store.Get(3)
+	assert.Equal(t, models.NotificationPending, n.Status)
+	assert.Equal(t, start.Add(90*time.Minute), n.NextAttemptAt)
+
+	o.now = func() time.Time { return start.Add(90 * time.Minute) }
+	pass(o)
+	require.Len(t, *delivered, 3)
+	assert.Equal(t, "Three", (*delivered)[2].Message.Title)
+}
+
+func TestOutbox_DedupAndDigest(t *testing.T) {
+	fail := false
+	o, store, delivered := newTestOutbox(&fail)
+	start := o.now() // 07:00
+	o.Preferences = map[string]Preferences{
+		"dinner": {DedupWindow: time.Hour, DigestAt: "18:00"},
+	}
+	recipe := func(body string) ntfy.Envelope {
+		return ntfy.Envelope{Topic: "dinner", Message: ntfy.Message{Title: "Recipe", Body: body}}
+	}
+	require.NoError(t, o.Enqueue(context.Background(), recipe("🍽️ Dinner 1: Soup")))
+	require.NoError(t, o.Enqueue(context.Background(), recipe("🍽️ Dinner 1: Soup")))
+	stew := recipe("🍽️ Dinner 2: Stew")
+	stew.Message.Click = "https://example.com/stew"
+	require.NoError(t, o.Enqueue(context.Background(), stew))
+	// Files are not held for the digest
+	require.NoError(t, o.Enqueue(context.Background(), ntfy.Envelope{Topic: "dinner", File: "/app/cache/dinner.json"}))
+
+	pass(o)
+	require.Len(t, *delivered, 1)
+	assert.Equal(t, "/app/cache/dinner.json", (*delivered)[0].File)
+	held, _ := store.List(models.NotificationHeld, 10)
+	require.Len(t, held, 2)
+	assert.Equal(t, start.Add(11*time.Hour), held[0].NextAttemptAt)
+
+	o.now = func() time.Time { return start.Add(11 * time.Hour) }
+	pass(o)
+	require.Len(t, *delivered, 2)
+	assert.Equal(t, "📬 dinner digest (2)", (*delivered)[1].Message.Title)
+	assert.Equal(t, "Recipe\n🍽️ Dinner 1: Soup\n\n---\n\nRecipe\n🍽️ Dinner 2: Stew\nhttps://example.com/stew", (*delivered)[1].Message.Body)
+	assert.Equal(t, "https://example.com/stew", (*delivered)[1].Message.Click)
+
+	digested, _ := store.List(models.NotificationDigested, 10)
+	assert.Len(t, digested, 2)
+
+	// The same recipe an hour later is no longer a duplicate
+	o.now = func() time.Time { return start.Add(12 * time.Hour) }
+	require.NoError(t, o.Enqueue(context.Background(), recipe("🍽️ Dinner 1: Soup")))
+	held, _ = store.List(models.NotificationHeld, 10)
+	assert.Len(t, held, 1)
+}
+
+func TestOutbox_DigestDeadLettersUndecodable(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	fail := false
+	o, store, delivered := newTestOutbox(&fail)
+	start := o.now()
+	o.Preferences = map[string]Preferences{"dinner": {DigestAt: "18:00"}}
+	require.NoError(t, o.Enqueue(context.Background(), ntfy.Envelope{Topic: "dinner", Message: ntfy.Message{Title: "Recipe", Body: "Soup"}}))
+	require.NoError(t, store.Save(&models.Notification{Topic: "dinner", Title: "Broken", Options: "{", Status: models.NotificationHeld, NextAttemptAt: start}))
+
+	replay := func(id string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("POST", "/admin/notifications/"+id+"/replay", nil)
+		o.ReplayNotification(c, id)
+		return w
+	}
+	// Held notifications are delivered by the digest, not replayed
+	assert.Equal(t, http.StatusConflict, replay("1").Code)
+
+	o.now = func() time.Time { return start.Add(11 * time.Hour) }
+	pass(o)
+	require.Len(t, *delivered, 1)
+	assert.Equal(t, "📬 dinner digest (1)", (*delivered)[0].Message.Title)
+
+	dead, _ := store.List(models.NotificationDead, 10)
+	require.Len(t, dead, 1)
+	assert.Equal(t, "Broken", dead[0].Title)
+	assert.Contains(t, dead[0].LastError, "invalid options")
+
+	// Nor are notifications already included in a digest
+	assert.Equal(t, http.StatusConflict, replay("1").Code)
+	pass(o)
+	assert.Len(t, *delivered, 1)
+}
@@ -0,0 +1,229 @@
+package replay
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Upstream modes selected with FIRELINK_UPSTREAM
+const (
+	ModeLive   = "live"
+	ModeRecord = "record"
+	ModeReplay = "replay"
+)
+
+// ErrNoFixture is returned in replay mode when a request was never recorded. It reports
+// itself as permanent so retrying transports neither retry it nor blame the host for it.
+var ErrNoFixture error = noFixtureError{}
+
+type noFixtureError struct{}
+
+func (noFixtureError) Error() string   { return "no recorded fixture for request" }
+func (noFixtureError) Permanent() bool { return true }
+
+// redacted replaces secrets before fixtures are written to disk
+const redacted = "REDACTED"
+
+// sensitiveHeaders are redacted from recorded requests
+var sensitiveHeaders = []string{"X-Api-Key", "Authorization"}
+
+// sensitiveParams are redacted from recorded URLs and left out of fixture names
+var sensitiveParams = []string{"apiKey", "api_key", "token"}
+
+// Fixture is a recorded request/response pair as stored on disk
+type Fixture struct {
+	Request  RecordedRequest  `json:"request"`
+	Response RecordedResponse `json:"response"`
+}
+
+type RecordedRequest struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header,omitempty"`
+}
+
+type RecordedResponse struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       string      `json:"body"`
+	BodyBase64 string      `json:"body_base64,omitempty"`
+}
+
+// Transport is an http.RoundTripper that passes requests through, records them to
+// fixture files, or replays previously recorded fixtures without touching the network
+type Transport struct {
+	Mode string
+	Dir  string
+	Base http.RoundTripper
+}
+
+// FromEnv builds the upstream transport from FIRELINK_UPSTREAM (live, record or replay)
+// and FIRELINK_FIXTURES_DIR (default "testdata/upstream")
+func FromEnv() http.RoundTripper {
+	mode := os.Getenv("FIRELINK_UPSTREAM")
+	if mode != ModeRecord && mode != ModeReplay {
+		if mode != "" && mode != ModeLive {
+			log.Printf("WARNING - unknown FIRELINK_UPSTREAM %q, using live upstreams", mode)
+		}
+		return http.DefaultTransport
+	}
+	dir := os.Getenv("FIRELINK_FIXTURES_DIR")
+	if dir == "" {
+		dir = filepath.Join("testdata", "upstream")
+	}
+	return &Transport{Mode: mode, Dir: dir, Base: http.DefaultTransport}
+}
+
+// redactURL blanks out secrets passed as query parameters
+func redactURL(u *url.URL) string {
+	clean := *u
+	query := clean.Query()
+	for _, param := range sensitiveParams {
+		if query.Has(param) {
+			query.Set(param, redacted)
+		}
+	}
+	clean.RawQuery = query.Encode()
+	return clean.String()
+}
+
+var unsafeChars = regexp.MustCompile(`[^a-zA-Z0-9]+`)
+
+// fixtureName derives a stable file name from the method, redacted URL and body
+func fixtureName(req *http.Request, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(req.Method + " " + redactURL(req.URL)))
+	// Multipart boundaries are random, so their bodies cannot identify a request
+	if !strings.HasPrefix(req.Header.Get("Content-Type"), "multipart/") {
+		hash.Write(body)
+	}
+	readable := strings.Trim(unsafeChars.ReplaceAllString(req.URL.Host+req.URL.Path, "_"), "_")
+	if len(readable) > 80 {
+		readable = readable[:80]
+	}
+	return fmt.Sprintf("%s_%s_%s.json", strings.ToLower(req.Method), readable, hex.EncodeToString(hash.Sum(nil))[:12])
+}
+
+// readBody consumes and restores a request body so it can be hashed and still sent
+func readBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	switch t.Mode {
+	case ModeRecord, ModeReplay:
+	default:
+		return t.Base.RoundTrip(req)
+	}
+
+	req = req.Clone(req.Context())
+	body, err := readBody(req)
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(t.Dir, fixtureName(req, body))
+
+	if t.Mode == ModeReplay {
+		return t.replay(req, path)
+	}
+	return t.record(req, path)
+}
+
+func (t *Transport) replay(req *http.Request, path string) (*http.Response, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s %s (%s)", ErrNoFixture, req.Method, redactURL(req.URL), filepath.Base(path))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var fixture Fixture
+	if err := json.Unmarshal(data, &fixture); err != nil {
+		return nil, fmt.Errorf("could not parse fixture %s: %w", path, err)
+	}
+
+	body := []byte(fixture.Response.Body)
+	if fixture.Response.BodyBase64 != "" {
+		if body, err = base64.StdEncoding.DecodeString(fixture.Response.BodyBase64); err != nil {
+			return nil, fmt.Errorf("could not decode fixture body %s: %w", path, err)
+		}
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", fixture.Response.StatusCode, http.StatusText(fixture.Response.StatusCode)),
+		StatusCode:    fixture.Response.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        fixture.Response.Header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+func (t *Transport) record(req *http.Request, path string) (*http.Response, error) {
+	resp, err := t.Base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	header := req.Header.Clone()
+	for _, name := range sensitiveHeaders {
+		if header.Get(name) != "" {
+			header.Set(name, redacted)
+		}
+	}
+	fixture := Fixture{
+		Request:  RecordedRequest{Method: req.Method, URL: redactURL(req.URL), Header: header},
+		Response: RecordedResponse{StatusCode: resp.StatusCode, Header: resp.Header},
+	}
+	if utf8.Valid(body) {
+		fixture.Response.Body = string(body)
+	} else {
+		fixture.Response.BodyBase64 = base64.StdEncoding.EncodeToString(body)
+	}
+
+	data, err := json.MarshalIndent(fixture, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("could not encode fixture: %w", err)
+	}
+	if err := os.MkdirAll(t.Dir, 0755); err != nil {
+		return nil, fmt.Errorf("could not create fixture directory: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return nil, fmt.Errorf("could not write fixture: %w", err)
+	}
+	return resp, nil
+}
@@ -0,0 +1,72 @@
+package replay
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransport_RecordThenReplay(t *testing.T) {
+	dir := t.TempDir()
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("X-API-Quota-Left", "149")
+		w.Write([]byte(`{"recipes": [{"id": 1, "title": "Recipe ` + r.URL.Query().Get("number") + `"}]}`))
+	}))
+
+	recorder := &http.Client{Transport: &Transport{Mode: ModeRecord, Dir: dir, Base: http.DefaultTransport}}
+	req, _ := http.NewRequest("GET", server.URL+"/recipes/random?number=1", nil)
+	req.Header.Set("x-api-key", "super-secret")
+	resp, err := recorder.Do(req)
+	assert.NoError(t, err)
+	recorded, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	server.Close()
+
+	// The api key never reaches the fixture files
+	files, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	assert.Len(t, files, 1)
+	data, _ := os.ReadFile(files[0])
+	assert.NotContains(t, string(data), "super-secret")
+	assert.Contains(t, string(data), redacted)
+
+	// Replay serves the recording even though the server is gone
+	replayer := &http.Client{Transport: &Transport{Mode: ModeReplay, Dir: dir}}
+	req, _ = http.NewRequest("GET", server.URL+"/recipes/random?number=1", nil)
+	req.Header.Set("x-api-key", "another-key")
+	resp, err = replayer.Do(req)
+	assert.NoError(t, err)
+	replayed, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "149", resp.Header.Get("X-API-Quota-Left"))
+	assert.Equal(t, string(recorded), string(replayed))
+}
+
+func TestTransport_ReplayMissingFixture(t *testing.T) {
+	replayer := &http.Client{Transport: &Transport{Mode: ModeReplay, Dir: t.TempDir()}}
+	_, err := replayer.Get("https://gutendex.com/books/?search=dracula")
+	assert.ErrorIs(t, err, ErrNoFixture)
+}
+
+func TestFixtureName_DependsOnBody(t *testing.T) {
+	first, _ := http.NewRequest("POST", "https://ntfy.sh/dinner", strings.NewReader("one"))
+	second, _ := http.NewRequest("POST", "https://ntfy.sh/dinner", strings.NewReader("two"))
+
+	assert.NotEqual(t, fixtureName(first, []byte("one")), fixtureName(second, []byte("two")))
+	assert.True(t, strings.HasPrefix(fixtureName(first, []byte("one")), "post_ntfy_sh_dinner_"))
+}
+
+func TestRedactURL(t *testing.T) {
+	req, _ := http.NewRequest("GET", "https://api.spoonacular.com/recipes/random?apiKey=secret&number=3", nil)
+	assert.Equal(t, "https://api.spoonacular.com/recipes/random?apiKey=REDACTED&number=3", redactURL(req.URL))
+}
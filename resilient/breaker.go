@@ -0,0 +1,126 @@
+package resilient
+
+import (
+	"sync"
+	"time"
+)
+
+// Circuit breaker states
+const (
+	StateClosed   = "closed"
+	StateOpen     = "open"
+	StateHalfOpen = "half-open"
+)
+
+// BreakerState is a snapshot of a host's circuit breaker, as shown by the healthcheck
+type BreakerState struct {
+	State    string     `json:"state"`
+	Failures int        `json:"failures"`
+	OpenedAt *time.Time `json:"opened_at,omitempty"`
+}
+
+// breaker opens after a run of consecutive failures, then lets a single trial request
+// through once the cooldown has passed
+type breaker struct {
+	mu        sync.Mutex
+	state     string
+	failures  int
+	openedAt  time.Time
+	trial     bool
+	threshold int
+	cooldown  time.Duration
+}
+
+var (
+	registryMu sync.Mutex
+	breakers   = map[string]*breaker{}
+)
+
+// breakerFor returns the shared breaker for a host, creating it on first use
+func breakerFor(host string, options Options) *breaker {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	b, found := breakers[host]
+	if !found {
+		b = &breaker{state: StateClosed, threshold: options.FailureThreshold, cooldown: options.Cooldown}
+		breakers[host] = b
+	}
+	return b
+}
+
+// States returns a snapshot of every host's circuit breaker
+func States() map[string]BreakerState {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	states := make(map[string]BreakerState, len(breakers))
+	for host, b := range breakers {
+		states[host] = b.snapshot()
+	}
+	return states
+}
+
+func (b *breaker) allow(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case StateOpen:
+		if now.Sub(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.state = StateHalfOpen
+		b.trial = true
+		return true
+	case StateHalfOpen:
+		if b.trial {
+			return false
+		}
+		b.trial = true
+		return true
+	default:
+		return true
+	}
+}
+
+func (b *breaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.state = StateClosed
+	b.failures = 0
+	b.trial = false
+}
+
+func (b *breaker) failure(now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	if b.state == StateHalfOpen || b.failures >= b.threshold {
+		b.state = StateOpen
+		b.openedAt = now
+		b.trial = false
+	}
+}
+
+// release gives up a half-open trial without judging the host
+func (b *breaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.trial = false
+}
+
+// tripped reports whether the breaker is open and further attempts should stop
+func (b *breaker) tripped() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state == StateOpen
+}
+
+func (b *breaker) snapshot() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	state := BreakerState{State: b.state, Failures: b.failures}
+	if b.state != StateClosed {
+		openedAt := b.openedAt
+		state.OpenedAt = &openedAt
+	}
+	return state
+}
@@ -0,0 +1,215 @@
+package resilient
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// ErrCircuitOpen is returned without contacting the host while its circuit breaker is open
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+// Options configures retries, timeouts and the circuit breaker of a Transport.
+// Zero values are replaced with the defaults noted on each field.
+type Options struct {
+	MaxRetries       int           // retries after the first attempt, default 3
+	BaseDelay        time.Duration // first backoff delay, default 200ms
+	MaxDelay         time.Duration // longest backoff or Retry-After honoured, default 10s
+	Timeout          time.Duration // per-attempt timeout, default 10s
+	FailureThreshold int           // consecutive failures that open the breaker, default 5
+	Cooldown         time.Duration // how long the breaker stays open, default 30s
+}
+
+func (o Options) withDefaults() Options {
+	if o.MaxRetries == 0 {
+		o.MaxRetries = 3
+	}
+	if o.BaseDelay == 0 {
+		o.BaseDelay = 200 * time.Millisecond
+	}
+	if o.MaxDelay == 0 {
+		o.MaxDelay = 10 * time.Second
+	}
+	if o.Timeout == 0 {
+		o.Timeout = 10 * time.Second
+	}
+	if o.FailureThreshold == 0 {
+		o.FailureThreshold = 5
+	}
+	if o.Cooldown == 0 {
+		o.Cooldown = 30 * time.Second
+	}
+	return o
+}
+
+// Transport is an http.RoundTripper that retries transient failures with jittered
+// exponential backoff and trips a per-host circuit breaker when a host keeps failing
+type Transport struct {
+	Base    http.RoundTripper
+	Options Options
+
+	// sleep waits between attempts, replaced in tests
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+// NewTransport wraps base (http.DefaultTransport when nil) with retries and a circuit breaker
+func NewTransport(base http.RoundTripper, options Options) *Transport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &Transport{Base: base, Options: options.withDefaults(), sleep: sleepContext}
+}
+
+// NewClient returns an http.Client using a resilient Transport over base
+func NewClient(base http.RoundTripper, options Options) *http.Client {
+	return &http.Client{Transport: NewTransport(base, options)}
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// permanent is implemented by errors a base transport knows no retry can fix, such as a
+// request that was never recorded when replaying fixtures
+type permanent interface {
+	Permanent() bool
+}
+
+// isPermanent reports whether err says retrying it is pointless
+func isPermanent(err error) bool {
+	var p permanent
+	return errors.As(err, &p) && p.Permanent()
+}
+
+// retryable reports whether an attempt failed in a way worth retrying
+func retryable(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+}
+
+// backoff returns a full-jitter exponential delay for the given attempt
+func (t *Transport) backoff(attempt int) time.Duration {
+	ceiling := t.Options.BaseDelay << attempt
+	if ceiling <= 0 || ceiling > t.Options.MaxDelay {
+		ceiling = t.Options.MaxDelay
+	}
+	return time.Duration(rand.Int63n(int64(ceiling) + 1))
+}
+
+// retryAfter parses a Retry-After header given in seconds or as an HTTP date
+func retryAfter(resp *http.Response, now time.Time) (time.Duration, bool) {
+	if resp == nil {
+		return 0, false
+	}
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return date.Sub(now), true
+	}
+	return 0, false
+}
+
+// cancelBody cancels the attempt's context once the caller is done with the body
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	breaker := breakerFor(req.URL.Host, t.Options)
+	if !breaker.allow(time.Now()) {
+		return nil, ErrCircuitOpen
+	}
+
+	// Requests with a body can only be retried if it can be replayed
+	maxRetries := t.Options.MaxRetries
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		maxRetries = 0
+	}
+
+	for attempt := 0; ; attempt++ {
+		attemptReq := req.Clone(req.Context())
+		if attempt > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			attemptReq.Body = body
+		}
+
+		ctx, cancel := context.WithTimeout(req.Context(), t.Options.Timeout)
+		resp, err := t.Base.RoundTrip(attemptReq.WithContext(ctx))
+
+		// The caller gave up, so neither retry nor blame the host
+		if req.Context().Err() != nil {
+			breaker.release()
+			cancel()
+			if resp != nil {
+				resp.Body.Close()
+			}
+			return nil, req.Context().Err()
+		}
+
+		// Nothing is wrong with the host, so give the error back without a retry or a failure
+		if isPermanent(err) {
+			breaker.release()
+			cancel()
+			return nil, err
+		}
+
+		if !retryable(resp, err) {
+			breaker.success()
+			resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+			return resp, nil
+		}
+		breaker.failure(time.Now())
+
+		delay, fromHeader := retryAfter(resp, time.Now())
+		if !fromHeader {
+			delay = t.backoff(attempt)
+		}
+		if attempt >= maxRetries || delay > t.Options.MaxDelay || breaker.tripped() {
+			if err != nil {
+				cancel()
+				return nil, err
+			}
+			resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+			return resp, nil
+		}
+
+		if resp != nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		cancel()
+
+		if err := t.sleep(req.Context(), delay); err != nil {
+			return nil, err
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package resilient
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/rjhoppe/firelink/replay"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestTransport returns a Transport that records delays instead of sleeping
+func newTestTransport(options Options) (*Transport, *[]time.Duration) {
+	var delays []time.Duration
+	transport := NewTransport(nil, options)
+	transport.sleep = func(ctx context.Context, d time.Duration) error {
+		delays = append(delays, d)
+		return nil
+	}
+	return transport, &delays
+}
+
+func TestTransport_RetriesTransientErrors(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	transport, delays := newTestTransport(Options{BaseDelay: time.Millisecond})
+	client := &http.Client{Transport: transport}
+
+	resp, err := client.Get(server.URL)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, 3, calls)
+	assert.Len(t, *delays, 2)
+	for _, delay := range *delays {
+		assert.LessOrEqual(t, delay, 2*time.Millisecond)
+	}
+}
+
+func TestTransport_HonorsRetryAfter(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			w.Header().Set("Retry-After", "2")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	transport, delays := newTestTransport(Options{})
+	client := &http.Client{Transport: transport}
+
+	resp, err := client.Get(server.URL)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, []time.Duration{2 * time.Second}, *delays)
+}
+
+func TestTransport_DoesNotRetryClientErrors(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	transport, _ := newTestTransport(Options{})
+	client := &http.Client{Transport: transport}
+
+	resp, err := client.Get(server.URL)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	assert.Equal(t, 1, calls)
+}
+
+func TestTransport_CircuitBreaker(t *testing.T) {
+	calls := 0
+	healthy := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if !healthy {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+	host, _ := url.Parse(server.URL)
+
+	transport, _ := newTestTransport(Options{MaxRetries: 5, FailureThreshold: 3, Cooldown: time.Hour})
+	client := &http.Client{Transport: transport}
+
+	// Retries stop as soon as the breaker opens
+	resp, err := client.Get(server.URL)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, 3, calls)
+	assert.Equal(t, StateOpen, States()[host.Host].State)
+
+	// While open, the host is not contacted at all
+	_, err = client.Get(server.URL)
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+	assert.Equal(t, 3, calls)
+
+	// After the cooldown a single trial closes the breaker again
+	healthy = true
+	breakerFor(host.Host, transport.Options).openedAt = time.Now().Add(-2 * time.Hour)
+	resp, err = client.Get(server.URL)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, StateClosed, States()[host.Host].State)
+}
+
+func TestTransport_PerAttemptTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	defer server.Close()
+
+	transport, delays := newTestTransport(Options{Timeout: 20 * time.Millisecond, MaxRetries: 1, FailureThreshold: 10})
+	client := &http.Client{Transport: transport}
+
+	_, err := client.Get(server.URL)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Len(t, *delays, 1)
+}
+
+func TestTransport_ReplayMissIsPermanent(t *testing.T) {
+	transport, delays := newTestTransport(Options{FailureThreshold: 2})
+	transport.Base = &replay.Transport{Mode: replay.ModeReplay, Dir: t.TempDir()}
+	client := &http.Client{Transport: transport}
+
+	for range 3 {
+		_, err := client.Get("https://gutendex.com/books/?search=dracula")
+		assert.ErrorIs(t, err, replay.ErrNoFixture)
+	}
+	assert.Empty(t, *delays)
+	assert.Equal(t, BreakerState{State: StateClosed}, States()["gutendex.com"])
+}
@@ -20,6 +20,34 @@ func (a *SpoonacularAdapter) GetRandomRecipes(ctx context.Context, count int) (*
 	return a.RealClient.GetRandomRecipes(ctx, count)
 }
 
+func (a *SpoonacularAdapter) SearchRecipes(ctx context.Context, params SearchParams) (*SearchRecipesResponse, error) {
+	return a.RealClient.SearchRecipes(ctx, params)
+}
+
+func (a *SpoonacularAdapter) GetSimilarRecipes(ctx context.Context, id int32, number int) ([]SimilarRecipe, error) {
+	return a.RealClient.GetSimilarRecipes(ctx, id, number)
+}
+
+func (a *SpoonacularAdapter) AutocompleteRecipeSearch(ctx context.Context, query string, number int) ([]AutocompleteResult, error) {
+	return a.RealClient.AutocompleteRecipeSearch(ctx, query, number)
+}
+
+func (a *SpoonacularAdapter) GetRecipeInformationBulk(ctx context.Context, ids []int32) ([]RecipeInformationOverride, error) {
+	return a.RealClient.GetRecipeInformationBulk(ctx, ids)
+}
+
+func (a *SpoonacularAdapter) Quota() Quota {
+	return a.RealClient.Quota()
+}
+
+func (a *SpoonacularAdapter) QuotaThreshold() float64 {
+	return a.RealClient.QuotaThreshold()
+}
+
+func (a *SpoonacularAdapter) Exhausted() bool {
+	return a.RealClient.Exhausted()
+}
+
 func ConvertToOverride(resp *RecipeInformationResponse) *RecipeInformationOverride {
 	if resp == nil {
 		return nil
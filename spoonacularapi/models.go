@@ -95,3 +95,44 @@ type WineProduct struct {
 	Score         float64 `json:"score"`
 	Link          string  `json:"link"`
 }
+
+// SearchParams are the filters accepted by the complexSearch endpoint
+type SearchParams struct {
+	Query        string
+	Cuisine      string
+	Diet         string
+	Intolerances string
+	Type         string
+	MaxReadyTime int
+	Number       int
+	Offset       int
+}
+
+type SearchResult struct {
+	ID        int    `json:"id"`
+	Title     string `json:"title"`
+	Image     string `json:"image"`
+	ImageType string `json:"imageType"`
+}
+
+type SearchRecipesResponse struct {
+	Results      []SearchResult `json:"results"`
+	Offset       int            `json:"offset"`
+	Number       int            `json:"number"`
+	TotalResults int            `json:"totalResults"`
+}
+
+type SimilarRecipe struct {
+	ID             int    `json:"id"`
+	Title          string `json:"title"`
+	ImageType      string `json:"imageType"`
+	ReadyInMinutes int    `json:"readyInMinutes"`
+	Servings       int    `json:"servings"`
+	SourceURL      string `json:"sourceUrl"`
+}
+
+type AutocompleteResult struct {
+	ID        int    `json:"id"`
+	Title     string `json:"title"`
+	ImageType string `json:"imageType"`
+}
@@ -3,10 +3,15 @@ package spoonacularapi
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	spoonacular "github.com/ddsky/spoonacular-api-clients/go"
 )
@@ -30,12 +35,33 @@ type RecipeInformationResponse struct {
 	Recipe RecipeInformationOverride `json:"recipe"`
 }
 
+// ErrQuotaExhausted is returned instead of calling the API when the remaining daily quota is
+// below the configured threshold, or Spoonacular has answered 402 earlier in the UTC day
+var ErrQuotaExhausted = errors.New("spoonacular daily quota exhausted")
+
+// Quota is the point usage Spoonacular reports on every response
+type Quota struct {
+	Request   float64   `json:"request"`
+	Used      float64   `json:"used"`
+	Left      float64   `json:"left"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Known     bool      `json:"known"`
+}
+
 // Client wraps the official Spoonacular client and adds custom methods
 type Client struct {
 	apiKey     string
 	apiClient  *spoonacular.APIClient
 	httpClient *http.Client
 	baseURL    string
+
+	mu           sync.Mutex
+	quota        Quota
+	minQuotaLeft float64
+	onLowQuota   func(Quota)
+	lowQuotaDay  string
+	// paymentDay is the UTC day Spoonacular last answered 402, refusing requests until it ends
+	paymentDay string
 }
 
 // ClientOption is a function that configures a Client
@@ -55,6 +81,20 @@ func WithHTTPClient(client *http.Client) ClientOption {
 	}
 }
 
+// WithQuotaThreshold refuses requests once fewer than min quota points are left for the day
+func WithQuotaThreshold(min float64) ClientOption {
+	return func(c *Client) {
+		c.minQuotaLeft = min
+	}
+}
+
+// WithLowQuotaHandler sets a callback invoked at most once per day when the quota runs low
+func WithLowQuotaHandler(handler func(Quota)) ClientOption {
+	return func(c *Client) {
+		c.onLowQuota = handler
+	}
+}
+
 // NewClient creates a new Spoonacular client wrapper
 func NewClient(apiKey string, options ...ClientOption) *Client {
 	// Create official client for endpoints that work correctly
@@ -87,15 +127,86 @@ func (c *Client) SetBaseURL(url string) {
 	c.baseURL = url
 }
 
-// GetRandomRecipes gets random recipes from the Spoonacular API
-// This is a custom implementation that doesn't rely on the official client
-func (c *Client) GetRandomRecipes(ctx context.Context, number int) (*RandomRecipesResponse, error) {
-	hardcodedTag := "main course" // Change this to your desired tag
-	endpoint := fmt.Sprintf("%s/recipes/random?number=%d&tags=%s", c.baseURL, number, url.QueryEscape(hardcodedTag))
+// Quota returns the most recently reported quota usage
+func (c *Client) Quota() Quota {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.quota
+}
+
+// QuotaThreshold returns the number of points below which requests are refused
+func (c *Client) QuotaThreshold() float64 {
+	return c.minQuotaLeft
+}
+
+// Exhausted reports whether requests are currently being refused to protect the quota.
+// The quota resets at midnight UTC, so a reading from a previous day never blocks.
+func (c *Client) Exhausted() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.exhausted(time.Now())
+}
+
+func (c *Client) exhausted(now time.Time) bool {
+	today := now.UTC().Format(time.DateOnly)
+	if c.paymentDay == today {
+		return true
+	}
+	if !c.quota.Known || c.quota.Left >= c.minQuotaLeft {
+		return false
+	}
+	return c.quota.UpdatedAt.UTC().Format(time.DateOnly) == today
+}
+
+// notifyLowQuota fires the low quota handler once per day while the quota is exhausted.
+// It must be called with mu held and returns the callback to run after unlocking.
+func (c *Client) notifyLowQuota(now time.Time) func() {
+	today := now.UTC().Format(time.DateOnly)
+	if c.onLowQuota == nil || !c.exhausted(now) || c.lowQuotaDay == today {
+		return func() {}
+	}
+	c.lowQuotaDay = today
+	quota, handler := c.quota, c.onLowQuota
+	return func() { handler(quota) }
+}
+
+// paymentRequired records a 402, which means the daily points are used up, so no further
+// requests are made until the quota resets at midnight UTC
+func (c *Client) paymentRequired() {
+	now := time.Now()
+	c.mu.Lock()
+	c.paymentDay = now.UTC().Format(time.DateOnly)
+	notify := c.notifyLowQuota(now)
+	c.mu.Unlock()
+	notify()
+}
+
+// captureQuota records the quota headers of a response and fires the low quota handler
+func (c *Client) captureQuota(header http.Header) {
+	left, err := strconv.ParseFloat(header.Get("X-API-Quota-Left"), 64)
+	if err != nil {
+		return
+	}
+	used, _ := strconv.ParseFloat(header.Get("X-API-Quota-Used"), 64)
+	request, _ := strconv.ParseFloat(header.Get("X-API-Quota-Request"), 64)
+
+	now := time.Now()
+	c.mu.Lock()
+	c.quota = Quota{Request: request, Used: used, Left: left, UpdatedAt: now, Known: true}
+	notify := c.notifyLowQuota(now)
+	c.mu.Unlock()
+	notify()
+}
+
+// get performs a GET request against the API and decodes the JSON response into out
+func (c *Client) get(ctx context.Context, endpoint string, out any) error {
+	if c.Exhausted() {
+		return ErrQuotaExhausted
+	}
 
 	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
 	if err != nil {
-		return nil, fmt.Errorf("error creating request: %w", err)
+		return fmt.Errorf("error creating request: %w", err)
 	}
 
 	// Add headers
@@ -104,46 +215,122 @@ func (c *Client) GetRandomRecipes(ctx context.Context, number int) (*RandomRecip
 	// Execute request
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("error executing request: %w", err)
+		return fmt.Errorf("error executing request: %w", err)
 	}
 	defer resp.Body.Close()
+	c.captureQuota(resp.Header)
+
+	// Spoonacular answers 402 once the daily points are used up
+	if resp.StatusCode == http.StatusPaymentRequired {
+		c.paymentRequired()
+		return ErrQuotaExhausted
+	}
 
 	// Check response status
 	if resp.StatusCode != 200 {
 		bodyBytes, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("API returned status code %d: %s", resp.StatusCode, string(bodyBytes))
+		return fmt.Errorf("API returned status code %d: %s", resp.StatusCode, string(bodyBytes))
 	}
 
 	// Read and parse response
-	var randomRecipes RandomRecipesResponse
-	decoder := json.NewDecoder(resp.Body)
-	if err := decoder.Decode(&randomRecipes); err != nil {
-		return nil, fmt.Errorf("error parsing JSON: %w", err)
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("error parsing JSON: %w", err)
 	}
+	return nil
+}
 
+// GetRandomRecipes gets random recipes from the Spoonacular API
+// This is a custom implementation that doesn't rely on the official client
+func (c *Client) GetRandomRecipes(ctx context.Context, number int) (*RandomRecipesResponse, error) {
+	hardcodedTag := "main course" // Change this to your desired tag
+	endpoint := fmt.Sprintf("%s/recipes/random?number=%d&tags=%s", c.baseURL, number, url.QueryEscape(hardcodedTag))
+
+	var randomRecipes RandomRecipesResponse
+	if err := c.get(ctx, endpoint, &randomRecipes); err != nil {
+		return nil, err
+	}
 	return &randomRecipes, nil
 }
 
 // GetRecipeInformation gets information about a specific recipe
 func (c *Client) GetRecipeInformation(ctx context.Context, id int32) (*RecipeInformationResponse, error) {
-	url := fmt.Sprintf("%s/recipes/%d/information", c.baseURL, id)
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
-	if err != nil {
+	endpoint := fmt.Sprintf("%s/recipes/%d/information", c.baseURL, id)
+
+	var recipeInfo RecipeInformationOverride
+	if err := c.get(ctx, endpoint, &recipeInfo); err != nil {
 		return nil, err
 	}
-	req.Header.Add("x-api-key", c.apiKey)
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
+	return &RecipeInformationResponse{Recipe: recipeInfo}, nil
+}
+
+// SearchRecipes searches recipes with the complexSearch endpoint
+func (c *Client) SearchRecipes(ctx context.Context, params SearchParams) (*SearchRecipesResponse, error) {
+	query := url.Values{}
+	query.Set("query", params.Query)
+	for key, value := range map[string]string{
+		"cuisine":      params.Cuisine,
+		"diet":         params.Diet,
+		"intolerances": params.Intolerances,
+		"type":         params.Type,
+	} {
+		if value != "" {
+			query.Set(key, value)
+		}
+	}
+	if params.MaxReadyTime > 0 {
+		query.Set("maxReadyTime", strconv.Itoa(params.MaxReadyTime))
+	}
+	if params.Number > 0 {
+		query.Set("number", strconv.Itoa(params.Number))
+	}
+	if params.Offset > 0 {
+		query.Set("offset", strconv.Itoa(params.Offset))
+	}
+	endpoint := fmt.Sprintf("%s/recipes/complexSearch?%s", c.baseURL, query.Encode())
+
+	var results SearchRecipesResponse
+	if err := c.get(ctx, endpoint, &results); err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode != 200 {
-		bodyBytes, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("API returned status code %d: %s", resp.StatusCode, string(bodyBytes))
+	return &results, nil
+}
+
+// GetSimilarRecipes gets recipes similar to the given recipe
+func (c *Client) GetSimilarRecipes(ctx context.Context, id int32, number int) ([]SimilarRecipe, error) {
+	endpoint := fmt.Sprintf("%s/recipes/%d/similar?number=%d", c.baseURL, id, number)
+
+	var similar []SimilarRecipe
+	if err := c.get(ctx, endpoint, &similar); err != nil {
+		return nil, err
 	}
-	var recipeInfo RecipeInformationOverride
-	if err := json.NewDecoder(resp.Body).Decode(&recipeInfo); err != nil {
+	return similar, nil
+}
+
+// AutocompleteRecipeSearch suggests recipe titles for a partial query
+func (c *Client) AutocompleteRecipeSearch(ctx context.Context, query string, number int) ([]AutocompleteResult, error) {
+	endpoint := fmt.Sprintf("%s/recipes/autocomplete?query=%s&number=%d", c.baseURL, url.QueryEscape(query), number)
+
+	var suggestions []AutocompleteResult
+	if err := c.get(ctx, endpoint, &suggestions); err != nil {
 		return nil, err
 	}
-	return &RecipeInformationResponse{Recipe: recipeInfo}, nil
+	return suggestions, nil
+}
+
+// GetRecipeInformationBulk gets information about several recipes in a single request
+func (c *Client) GetRecipeInformationBulk(ctx context.Context, ids []int32) ([]RecipeInformationOverride, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	idStrings := make([]string, len(ids))
+	for i, id := range ids {
+		idStrings[i] = strconv.Itoa(int(id))
+	}
+	endpoint := fmt.Sprintf("%s/recipes/informationBulk?ids=%s", c.baseURL, strings.Join(idStrings, ","))
+
+	var recipes []RecipeInformationOverride
+	if err := c.get(ctx, endpoint, &recipes); err != nil {
+		return nil, err
+	}
+	return recipes, nil
 }
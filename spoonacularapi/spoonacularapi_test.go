@@ -0,0 +1,96 @@
+package spoonacularapi
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newQuotaServer(t *testing.T, left *string, calls *int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*calls++
+		assert.Equal(t, "fake-api-key", r.Header.Get("x-api-key"))
+		w.Header().Set("X-API-Quota-Request", "1")
+		w.Header().Set("X-API-Quota-Used", "140")
+		w.Header().Set("X-API-Quota-Left", *left)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"recipes": [{"id": 1, "title": "Recipe 1"}]}`))
+	}))
+}
+
+func TestClient_CapturesQuota(t *testing.T) {
+	left, calls := "10", 0
+	server := newQuotaServer(t, &left, &calls)
+	defer server.Close()
+
+	client := NewClient("fake-api-key", WithBaseURL(server.URL))
+	assert.False(t, client.Quota().Known)
+
+	_, err := client.GetRandomRecipes(context.Background(), 1)
+	assert.NoError(t, err)
+
+	quota := client.Quota()
+	assert.True(t, quota.Known)
+	assert.Equal(t, 140.0, quota.Used)
+	assert.Equal(t, 10.0, quota.Left)
+	assert.Equal(t, 1.0, quota.Request)
+	assert.False(t, client.Exhausted())
+}
+
+func TestClient_QuotaGuard(t *testing.T) {
+	left, calls := "4", 0
+	server := newQuotaServer(t, &left, &calls)
+	defer server.Close()
+
+	var warnings []Quota
+	client := NewClient("fake-api-key",
+		WithBaseURL(server.URL),
+		WithQuotaThreshold(5),
+		WithLowQuotaHandler(func(q Quota) { warnings = append(warnings, q) }),
+	)
+
+	// The first call goes through and reveals the quota is below the threshold
+	_, err := client.GetRandomRecipes(context.Background(), 1)
+	assert.NoError(t, err)
+	assert.True(t, client.Exhausted())
+
+	// Further calls are refused without reaching the API
+	_, err = client.GetRecipeInformation(context.Background(), 1)
+	assert.ErrorIs(t, err, ErrQuotaExhausted)
+	assert.Equal(t, 1, calls)
+
+	// The warning is only sent once per day
+	client.captureQuota(http.Header{"X-Api-Quota-Left": []string{"3"}})
+	assert.Len(t, warnings, 1)
+	assert.Equal(t, 4.0, warnings[0].Left)
+}
+
+func TestClient_PaymentRequired(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusPaymentRequired)
+	}))
+	defer server.Close()
+
+	var warnings []Quota
+	client := NewClient("fake-api-key", WithBaseURL(server.URL), WithLowQuotaHandler(func(q Quota) { warnings = append(warnings, q) }))
+	_, err := client.GetRandomRecipes(context.Background(), 1)
+	assert.ErrorIs(t, err, ErrQuotaExhausted)
+	assert.True(t, client.Exhausted())
+	assert.Len(t, warnings, 1)
+
+	// The rest of the day is refused without calling the API
+	_, err = client.GetRecipeInformation(context.Background(), 1)
+	assert.ErrorIs(t, err, ErrQuotaExhausted)
+	assert.Equal(t, 1, calls)
+
+	// A new UTC day lifts the block
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	assert.False(t, client.exhausted(time.Now().UTC().AddDate(0, 0, 1)))
+}
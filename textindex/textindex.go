@@ -0,0 +1,448 @@
+package textindex
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// This package is a small on-disk inverted index for plain-text books. A catalog file
+// maps every term to the documents containing it, and each document has its own file
+// with term positions, token offsets and chapter headings, so only the documents that
+// can match a query are loaded when searching.
+
+// proximity is how many tokens apart the terms of a query may be and still match
+const proximity = 12
+
+// maxHitsPerDoc bounds how many hits a single document contributes to a search
+const maxHitsPerDoc = 3
+
+// snippetContext is how many bytes of text are shown around a match
+const snippetContext = 80
+
+// Doc is an indexed document
+type Doc struct {
+	ID     uint
+	Title  string
+	Path   string
+	Tokens int
+}
+
+// Chapter is a heading found in a document and where it starts
+type Chapter struct {
+	Title  string
+	Offset int
+}
+
+// docFile is what is stored on disk for each document
+type docFile struct {
+	Postings map[string][]int32 // term -> token positions
+	Offsets  []int32            // token position -> byte offset
+	Lengths  []int32            // token position -> byte length
+	Chapters []Chapter
+}
+
+// catalog is what is stored on disk for the whole index
+type catalog struct {
+	Terms map[string][]uint // term -> ids of documents containing it
+	Docs  map[uint]Doc
+}
+
+// Hit is a place in a document matching a query
+type Hit struct {
+	BookId  uint   `json:"book_id"`
+	Title   string `json:"title"`
+	Chapter string `json:"chapter,omitempty"`
+	Offset  int    `json:"offset"`
+	Snippet string `json:"snippet"` // matched terms are wrapped in ** **
+	Phrase  bool   `json:"phrase"`  // the terms appear together in query order
+}
+
+// Index is an inverted index stored in Dir
+type Index struct {
+	Dir string
+
+	mu      sync.RWMutex
+	catalog catalog
+}
+
+// Open loads the index in dir, creating an empty one if it does not exist yet
+func Open(dir string) (*Index, error) {
+	if err := os.MkdirAll(filepath.Join(dir, "docs"), 0755); err != nil {
+		return nil, fmt.Errorf("could not create index directory: %w", err)
+	}
+	index := &Index{Dir: dir, catalog: catalog{Terms: map[string][]uint{}, Docs: map[uint]Doc{}}}
+	err := readGob(index.catalogPath(), &index.catalog)
+	if errors.Is(err, os.ErrNotExist) {
+		return index, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not load index: %w", err)
+	}
+	return index, nil
+}
+
+func (ix *Index) catalogPath() string {
+	return filepath.Join(ix.Dir, "catalog.gob")
+}
+
+func (ix *Index) docPath(id uint) string {
+	return filepath.Join(ix.Dir, "docs", strconv.FormatUint(uint64(id), 10)+".gob")
+}
+
+func readGob(path string, v any) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return gob.NewDecoder(file).Decode(v)
+}
+
+// writeGob writes v to a temporary file first so a crash never leaves a truncated index
+func writeGob(path string, v any) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".index-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := gob.NewEncoder(tmp).Encode(v); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// token is a word found in a text
+type token struct {
+	term   string
+	offset int
+	length int
+}
+
+// tokenize splits text into lower-cased runs of letters and digits
+func tokenize(text string) []token {
+	var tokens []token
+	start := -1
+	for i, r := range text {
+		wordRune := unicode.IsLetter(r) || unicode.IsDigit(r)
+		if wordRune && start < 0 {
+			start = i
+		}
+		if !wordRune && start >= 0 {
+			tokens = append(tokens, newToken(text, start, i))
+			start = -1
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, newToken(text, start, len(text)))
+	}
+	return tokens
+}
+
+func newToken(text string, start, end int) token {
+	return token{term: strings.ToLower(text[start:end]), offset: start, length: end - start}
+}
+
+// Terms returns the lower-cased search terms of a query, in order
+func Terms(query string) []string {
+	var terms []string
+	for _, t := range tokenize(query) {
+		terms = append(terms, t.term)
+	}
+	return terms
+}
+
+// chapterHeading matches the headings Gutenberg texts use to start chapters and parts
+var chapterHeading = regexp.MustCompile(`(?m)^[ \t]*((?:CHAPTER|Chapter|BOOK|Book|PART|Part|ACT|Act|STAVE|Stave|LETTER|Letter)[ \t]+[IVXLCDM0-9]+\b[^\r\n]*)`)
+
+// chapters finds the chapter headings of a text
+func chapters(text string) []Chapter {
+	var found []Chapter
+	for _, match := range chapterHeading.FindAllStringSubmatchIndex(text, -1) {
+		title := text[match[2]:match[3]]
+		if len(title) > 80 {
+			title = title[:80]
+		}
+		found = append(found, Chapter{Title: strings.TrimRight(title, " \t."), Offset: match[2]})
+	}
+	return found
+}
+
+// Add indexes the plain-text file at path, replacing any earlier version of the document
+func (ix *Index) Add(id uint, title, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("could not read %s: %w", path, err)
+	}
+	text := string(data)
+	tokens := tokenize(text)
+
+	doc := docFile{
+		Postings: map[string][]int32{},
+		Offsets:  make([]int32, len(tokens)),
+		Lengths:  make([]int32, len(tokens)),
+		Chapters: chapters(text),
+	}
+	for i, t := range tokens {
+		doc.Postings[t.term] = append(doc.Postings[t.term], int32(i))
+		doc.Offsets[i] = int32(t.offset)
+		doc.Lengths[i] = int32(t.length)
+	}
+
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	if err := writeGob(ix.docPath(id), doc); err != nil {
+		return fmt.Errorf("could not write document index: %w", err)
+	}
+	ix.removeTerms(id)
+	for term := range doc.Postings {
+		ix.catalog.Terms[term] = append(ix.catalog.Terms[term], id)
+	}
+	ix.catalog.Docs[id] = Doc{ID: id, Title: title, Path: path, Tokens: len(tokens)}
+	return writeGob(ix.catalogPath(), ix.catalog)
+}
+
+// removeTerms drops a document from the term lists, the caller holds the lock
+func (ix *Index) removeTerms(id uint) {
+	if _, ok := ix.catalog.Docs[id]; !ok {
+		return
+	}
+	for term, ids := range ix.catalog.Terms {
+		kept := ids[:0]
+		for _, docId := range ids {
+			if docId != id {
+				kept = append(kept, docId)
+			}
+		}
+		if len(kept) == 0 {
+			delete(ix.catalog.Terms, term)
+		} else {
+			ix.catalog.Terms[term] = kept
+		}
+	}
+}
+
+// Has reports whether a document is indexed
+func (ix *Index) Has(id uint) bool {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	_, ok := ix.catalog.Docs[id]
+	return ok
+}
+
+// Len returns the number of indexed documents
+func (ix *Index) Len() int {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	return len(ix.catalog.Docs)
+}
+
+// candidates returns the documents containing every term, the caller holds the read lock
+func (ix *Index) candidates(terms []string) []uint {
+	counts := map[uint]int{}
+	for _, term := range terms {
+		for _, id := range ix.catalog.Terms[term] {
+			counts[id]++
+		}
+	}
+	var ids []uint
+	for id, count := range counts {
+		if count == len(terms) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// match is a run of tokens containing every query term
+type match struct {
+	start, end int32 // first and last token position
+	phrase     bool
+}
+
+// findMatches returns phrase matches, or proximity matches when the terms never
+// appear together in order
+func findMatches(doc *docFile, terms []string) []match {
+	first := doc.Postings[terms[0]]
+	var matches []match
+
+	positions := make([]map[int32]bool, len(terms))
+	for i, term := range terms {
+		positions[i] = map[int32]bool{}
+		for _, p := range doc.Postings[term] {
+			positions[i][p] = true
+		}
+	}
+
+	for _, p := range first {
+		phrase := true
+		for i := 1; i < len(terms); i++ {
+			if !positions[i][p+int32(i)] {
+				phrase = false
+				break
+			}
+		}
+		if phrase {
+			matches = append(matches, match{start: p, end: p + int32(len(terms)) - 1, phrase: true})
+			if len(matches) == maxHitsPerDoc {
+				return matches
+			}
+		}
+	}
+	if len(matches) > 0 {
+		return matches
+	}
+
+	for _, p := range first {
+		start, end := p, p
+		found := true
+		for i := 1; i < len(terms); i++ {
+			nearest := int32(-1)
+			for _, q := range doc.Postings[terms[i]] {
+				if q >= p-proximity && q <= p+proximity && (nearest < 0 || abs(q-p) < abs(nearest-p)) {
+					nearest = q
+				}
+			}
+			if nearest < 0 {
+				found = false
+				break
+			}
+			start, end = min(start, nearest), max(end, nearest)
+		}
+		if found {
+			matches = append(matches, match{start: start, end: end})
+			if len(matches) == maxHitsPerDoc {
+				break
+			}
+		}
+	}
+	return matches
+}
+
+func abs(v int32) int32 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// chapterAt returns the heading of the chapter containing offset
+func chapterAt(chapters []Chapter, offset int) string {
+	i := sort.Search(len(chapters), func(i int) bool { return chapters[i].Offset > offset })
+	if i == 0 {
+		return ""
+	}
+	return chapters[i-1].Title
+}
+
+// snippet cuts the text around a match and wraps the matched terms in ** **
+func snippet(text []byte, doc *docFile, m match, terms map[string]bool) string {
+	matchStart := int(doc.Offsets[m.start])
+	matchEnd := int(doc.Offsets[m.end] + doc.Lengths[m.end])
+	from, to := max(0, matchStart-snippetContext), min(len(text), matchEnd+snippetContext)
+	// Do not cut through a multi-byte character
+	for from > 0 && !utf8.RuneStart(text[from]) {
+		from--
+	}
+	for to < len(text) && !utf8.RuneStart(text[to]) {
+		to++
+	}
+
+	var out []byte
+	cursor := from
+	for _, t := range tokenize(string(text[from:to])) {
+		if !terms[t.term] {
+			continue
+		}
+		start := from + t.offset
+		out = append(out, text[cursor:start]...)
+		out = append(out, "**"...)
+		out = append(out, text[start:start+t.length]...)
+		out = append(out, "**"...)
+		cursor = start + t.length
+	}
+	out = append(out, text[cursor:to]...)
+	return collapseSpace(string(out))
+}
+
+// collapseSpace joins the hard-wrapped lines of Gutenberg texts into one line
+func collapseSpace(s string) string {
+	var out []rune
+	space := false
+	for _, r := range s {
+		if unicode.IsSpace(r) {
+			space = true
+			continue
+		}
+		if space && len(out) > 0 {
+			out = append(out, ' ')
+		}
+		space = false
+		out = append(out, r)
+	}
+	return string(out)
+}
+
+// Search returns up to limit places where the query's terms appear together,
+// phrase matches first
+func (ix *Index) Search(query string, limit int) ([]Hit, error) {
+	terms := Terms(query)
+	if len(terms) == 0 {
+		return nil, nil
+	}
+	termSet := map[string]bool{}
+	for _, term := range terms {
+		termSet[term] = true
+	}
+
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	var hits []Hit
+	for _, id := range ix.candidates(terms) {
+		var doc docFile
+		if err := readGob(ix.docPath(id), &doc); err != nil {
+			return nil, fmt.Errorf("could not load document index: %w", err)
+		}
+		matches := findMatches(&doc, terms)
+		if len(matches) == 0 {
+			continue
+		}
+		info := ix.catalog.Docs[id]
+		text, err := os.ReadFile(info.Path)
+		if err != nil {
+			return nil, fmt.Errorf("could not read %s: %w", info.Path, err)
+		}
+		for _, m := range matches {
+			offset := int(doc.Offsets[m.start])
+			hits = append(hits, Hit{
+				BookId:  id,
+				Title:   info.Title,
+				Chapter: chapterAt(doc.Chapters, offset),
+				Offset:  offset,
+				Snippet: snippet(text, &doc, m, termSet),
+				Phrase:  m.phrase,
+			})
+		}
+	}
+
+	sort.SliceStable(hits, func(i, j int) bool { return hits[i].Phrase && !hits[j].Phrase })
+	if limit > 0 && len(hits) > limit {
+		hits = hits[:limit]
+	}
+	return hits, nil
+}
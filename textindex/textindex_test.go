@@ -0,0 +1,103 @@
+package textindex
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const mobyDick = `MOBY-DICK
+
+CHAPTER 1. Loomings.
+
+Call me Ishmael. Some years ago—never mind how long precisely—having
+little or no money in my purse, and nothing particular to interest me on
+shore, I thought I would sail about a little and see the watery part of
+the world.
+
+CHAPTER 2. The Carpet-Bag.
+
+I stuffed a shirt or two into my old carpet-bag, tucked it under my arm,
+and started for Cape Horn and the Pacific.
+`
+
+const prideAndPrejudice = `Chapter I
+
+It is a truth universally acknowledged, that a single man in possession
+of a good fortune, must be in want of a wife.
+`
+
+func writeText(t *testing.T, dir, name, text string) string {
+	path := filepath.Join(dir, name)
+	require.NoError(t, os.WriteFile(path, []byte(text), 0644))
+	return path
+}
+
+func newTestIndex(t *testing.T) *Index {
+	dir := t.TempDir()
+	index, err := Open(filepath.Join(dir, "index"))
+	require.NoError(t, err)
+	require.NoError(t, index.Add(1, "Moby Dick", writeText(t, dir, "moby.txt", mobyDick)))
+	require.NoError(t, index.Add(2, "Pride and Prejudice", writeText(t, dir, "pride.txt", prideAndPrejudice)))
+	return index
+}
+
+func TestSearch_Phrase(t *testing.T) {
+	index := newTestIndex(t)
+
+	hits, err := index.Search("call me ISHMAEL", 10)
+	require.NoError(t, err)
+	require.Len(t, hits, 1)
+	assert.Equal(t, uint(1), hits[0].BookId)
+	assert.Equal(t, "CHAPTER 1. Loomings", hits[0].Chapter)
+	assert.True(t, hits[0].Phrase)
+	assert.Contains(t, hits[0].Snippet, "**Call** **me** **Ishmael**. Some years ago")
+	assert.Equal(t, "Call", mobyDick[hits[0].Offset:hits[0].Offset+4])
+}
+
+func TestSearch_ProximityAndChapters(t *testing.T) {
+	index := newTestIndex(t)
+
+	// The words are near each other but not in this order
+	hits, err := index.Search("pacific cape horn", 10)
+	require.NoError(t, err)
+	require.Len(t, hits, 1)
+	assert.False(t, hits[0].Phrase)
+	assert.Equal(t, "CHAPTER 2. The Carpet-Bag", hits[0].Chapter)
+	// Hard-wrapped lines are joined in snippets
+	assert.Contains(t, hits[0].Snippet, "arm, and started for **Cape** **Horn**")
+
+	hits, err = index.Search("truth universally acknowledged", 10)
+	require.NoError(t, err)
+	require.Len(t, hits, 1)
+	assert.Equal(t, "Pride and Prejudice", hits[0].Title)
+	assert.Equal(t, "Chapter I", hits[0].Chapter)
+
+	hits, err = index.Search("ishmael fortune", 10)
+	require.NoError(t, err)
+	assert.Empty(t, hits)
+}
+
+func TestIndex_Persists(t *testing.T) {
+	index := newTestIndex(t)
+
+	reopened, err := Open(index.Dir)
+	require.NoError(t, err)
+	assert.Equal(t, 2, reopened.Len())
+	hits, err := reopened.Search("watery part", 10)
+	require.NoError(t, err)
+	assert.Len(t, hits, 1)
+}
+
+func TestTokenize(t *testing.T) {
+	tokens := tokenize("Café—au lait, 1851!")
+	var terms []string
+	for _, token := range tokens {
+		terms = append(terms, token.term)
+	}
+	assert.Equal(t, []string{"café", "au", "lait", "1851"}, terms)
+	assert.Equal(t, len("Café—"), tokens[1].offset)
+}
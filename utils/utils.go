@@ -1,7 +1,13 @@
 package utils
 
 import (
+	"context"
+	"os"
 	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
 )
 
 func ContainsString(slice []string, value string) bool {
@@ -13,6 +19,33 @@ func ContainsString(slice []string, value string) bool {
 	return false
 }
 
+// GetEnvInt reads an integer environment variable, falling back to def when unset or invalid
+func GetEnvInt(key string, def int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return def
+	}
+	return value
+}
+
+// GetEnvDuration reads a duration environment variable such as "15s", falling back to def when unset or invalid
+func GetEnvDuration(key string, def time.Duration) time.Duration {
+	value, err := time.ParseDuration(os.Getenv(key))
+	if err != nil {
+		return def
+	}
+	return value
+}
+
+// RequestContext returns the context of the request being handled, so upstream work is
+// cancelled when the client disconnects or the server shuts down
+func RequestContext(c *gin.Context) context.Context {
+	if c == nil || c.Request == nil {
+		return context.Background()
+	}
+	return c.Request.Context()
+}
+
 func GetFieldValue(dataStruct interface{}, field string) string {
 	val := reflect.ValueOf(dataStruct)
 	f := val.FieldByName(field)
@@ -25,15 +58,64 @@ func GetFieldValue(dataStruct interface{}, field string) string {
 func ListAllEndpoints() []string {
 	return []string{
 		"/help",
+		"/metrics",
 		"/ebook/find/:title",
-		"/ebook/download/:title",
+		"/ebook/search",
+		"/ebook/download/:id",
+		"/ebook/upload",
+		"/ebook/library",
+		"/ebook/library/search",
+		"/ebook/library/reindex",
+		"/ebook/library/:id/file",
+		"/ebook/library/:id/cover",
+		"/ebook/library/:id/metadata",
+		"/ebook/library/:id/send",
+		"/ebook/devices",
+		"/ebook/devices/:id",
+		"/ebook/reading",
+		"/ebook/reading/:id",
+		"/ebook/reading/stats",
+		"/ebook/passage",
+		"/ebook/passage/pause",
+		"/ebook/passage/resume",
+		"/ebook/passage/skip",
+		"/ebook/passage/send",
+		"/ebook/passage/book",
+		"/opds",
+		"/opds/recent",
+		"/opds/all",
+		"/opds/authors",
+		"/opds/subjects",
+		"/opds/search",
+		"/opds/opensearch.xml",
 		"/bartender/random",
 		"/bartender/cache/backup",
 		"/bartender/history",
 		"/bartender/save",
+		"/bartender/drink/:id/export",
+		"/bartender/drinks",
+		"/bartender/drinks/:id",
 		"/dinner/random",
 		"/dinner/cache/backup",
 		"/dinner/recipe/:id",
+		"/dinner/recipe/:id/export",
+		"/dinner/recipe/:id/cooked",
+		"/dinner/history",
+		"/dinner/quota",
+		"/dinner/search",
+		"/dinner/autocomplete",
+		"/dinner/recipe/:id/similar",
+		"/dinner/recipes",
+		"/dinner/recipes/:id",
 		"/database/backup",
+		"/admin/export",
+		"/admin/import",
+		"/admin/notifications",
+		"/admin/notifications/replay",
+		"/admin/notifications/preferences",
+		"/admin/notifications/templates",
+		"/admin/notifications/templates/:name/preview",
+		"/admin/notifications/:id",
+		"/admin/notifications/:id/replay",
 	}
 }